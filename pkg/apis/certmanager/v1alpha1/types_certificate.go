@@ -50,8 +50,44 @@ type CertificateList struct {
 type KeyAlgorithm string
 
 const (
-	RSAKeyAlgorithm   KeyAlgorithm = "rsa"
-	ECDSAKeyAlgorithm KeyAlgorithm = "ecdsa"
+	RSAKeyAlgorithm     KeyAlgorithm = "rsa"
+	ECDSAKeyAlgorithm   KeyAlgorithm = "ecdsa"
+	Ed25519KeyAlgorithm KeyAlgorithm = "ed25519"
+)
+
+type KeyEncoding string
+
+const (
+	// PKCS1 encodes RSA keys as PKCS#1 and ECDSA keys as SEC 1. Ed25519 keys,
+	// which have no such encoding, are encoded as PKCS#8.
+	PKCS1 KeyEncoding = "pkcs1"
+
+	// PKCS8 encodes all keys as PKCS#8.
+	PKCS8 KeyEncoding = "pkcs8"
+)
+
+// KeyUsage is a key usage or extended key usage of a Certificate, named as
+// in RFC 5280.
+// +kubebuilder:validation:Enum=digitalSignature,contentCommitment,keyEncipherment,dataEncipherment,keyAgreement,keyCertSign,cRLSign,encipherOnly,decipherOnly,serverAuth,clientAuth,codeSigning,emailProtection,timeStamping,OCSPSigning
+type KeyUsage string
+
+const (
+	UsageDigitalSignature  KeyUsage = "digitalSignature"
+	UsageContentCommitment KeyUsage = "contentCommitment"
+	UsageKeyEncipherment   KeyUsage = "keyEncipherment"
+	UsageDataEncipherment  KeyUsage = "dataEncipherment"
+	UsageKeyAgreement      KeyUsage = "keyAgreement"
+	UsageCertSign          KeyUsage = "keyCertSign"
+	UsageCRLSign           KeyUsage = "cRLSign"
+	UsageEncipherOnly      KeyUsage = "encipherOnly"
+	UsageDecipherOnly      KeyUsage = "decipherOnly"
+
+	UsageServerAuth      KeyUsage = "serverAuth"
+	UsageClientAuth      KeyUsage = "clientAuth"
+	UsageCodeSigning     KeyUsage = "codeSigning"
+	UsageEmailProtection KeyUsage = "emailProtection"
+	UsageTimeStamping    KeyUsage = "timeStamping"
+	UsageOCSPSigning     KeyUsage = "OCSPSigning"
 )
 
 // CertificateSpec defines the desired state of Certificate
@@ -64,6 +100,11 @@ type CertificateSpec struct {
 	// +optional
 	Organization []string `json:"organization,omitempty"`
 
+	// Subject is the full X.509 subject, other than the common name and
+	// organization, to be used on the Certificate
+	// +optional
+	Subject *X509Subject `json:"subject,omitempty"`
+
 	// Certificate default Duration
 	// +optional
 	Duration *metav1.Duration `json:"duration,omitempty"`
@@ -72,6 +113,12 @@ type CertificateSpec struct {
 	// +optional
 	RenewBefore *metav1.Duration `json:"renewBefore,omitempty"`
 
+	// NotBeforeSkew moves the start of the Certificate's validity into the
+	// past by the given amount, to tolerate clock skew between the issuer and
+	// clients. It does not change when the Certificate expires.
+	// +optional
+	NotBeforeSkew *metav1.Duration `json:"notBeforeSkew,omitempty"`
+
 	// DNSNames is a list of subject alt names to be used on the Certificate
 	// +optional
 	DNSNames []string `json:"dnsNames,omitempty"`
@@ -80,6 +127,50 @@ type CertificateSpec struct {
 	// +optional
 	IPAddresses []string `json:"ipAddresses,omitempty"`
 
+	// EmailAddresses is a list of email subject alt names to be used on the
+	// Certificate
+	// +optional
+	EmailAddresses []string `json:"emailAddresses,omitempty"`
+
+	// URISANs is a list of URI subject alt names, such as SPIFFE IDs, to be
+	// used on the Certificate. Each must be an absolute URI.
+	// +optional
+	URISANs []string `json:"uriSANs,omitempty"`
+
+	// OtherNames is a list of otherName subject alt names to be used on the
+	// Certificate, such as the Microsoft user principal name used for
+	// Windows smartcard logon.
+	// +optional
+	OtherNames []OtherName `json:"otherNames,omitempty"`
+
+	// CRLDistributionPoints is a list of URLs at which the certificate
+	// revocation list of the issuer can be fetched, to be used in the CRL
+	// distribution points extension of the Certificate. Each must be an
+	// absolute URL.
+	// +optional
+	CRLDistributionPoints []string `json:"crlDistributionPoints,omitempty"`
+
+	// OCSPServers is a list of URLs of OCSP responders for the issuer, to be
+	// used in the authority information access extension of the Certificate.
+	// Each must be an absolute URL.
+	// +optional
+	OCSPServers []string `json:"ocspServers,omitempty"`
+
+	// IssuingCertificateURLs is a list of URLs at which the issuer's
+	// certificate can be fetched, to be used as the CA issuers in the
+	// authority information access extension of the Certificate. Each must be
+	// an absolute URL.
+	// +optional
+	IssuingCertificateURLs []string `json:"issuingCertificateURLs,omitempty"`
+
+	// SerialNumber is the serial number to be used on the Certificate, for
+	// environments where serial numbers are assigned by an external
+	// allocator. It may be decimal, or hex if prefixed with "0x" or written
+	// as colon separated octets, and must be positive and no longer than 20
+	// octets. If not set, a random serial number is used.
+	// +optional
+	SerialNumber string `json:"serialNumber,omitempty"`
+
 	// SecretName is the name of the secret resource to store this secret in
 	SecretName string `json:"secretName"`
 
@@ -96,6 +187,18 @@ type CertificateSpec struct {
 	// +optional
 	IsCA bool `json:"isCA,omitempty"`
 
+	// MaxPathLen is the maximum number of intermediate CA certificates that
+	// may follow a CA Certificate in a chain. Zero means the CA may only issue
+	// leaf certificates. If not set, the path length is unconstrained. It is
+	// ignored unless IsCA is set.
+	// +optional
+	MaxPathLen *int `json:"maxPathLen,omitempty"`
+
+	// NameConstraints limits the names for which a CA Certificate may issue
+	// certificates. It is ignored unless IsCA is set.
+	// +optional
+	NameConstraints *NameConstraints `json:"nameConstraints,omitempty"`
+
 	// ACME contains configuration specific to ACME Certificates.
 	// Notably, this contains details on how the domain names listed on this
 	// Certificate resource should be 'solved', i.e. mapping HTTP01 and DNS01
@@ -106,18 +209,103 @@ type CertificateSpec struct {
 	// KeySize is the key bit size of the corresponding private key for this certificate.
 	// If provided, value must be between 2048 and 8192 inclusive when KeyAlgorithm is
 	// empty or is set to "rsa", and value must be one of (256, 384, 521) when
-	// KeyAlgorithm is set to "ecdsa".
+	// KeyAlgorithm is set to "ecdsa". It is ignored when KeyAlgorithm is set
+	// to "ed25519", which has a fixed key size.
 	// +optional
 	KeySize int `json:"keySize,omitempty"`
 
 	// KeyAlgorithm is the private key algorithm of the corresponding private key
-	// for this certificate. If provided, allowed values are either "rsa" or "ecdsa"
-	// If KeyAlgorithm is specified and KeySize is not provided,
+	// for this certificate. If provided, allowed values are "rsa", "ecdsa" or
+	// "ed25519". If KeyAlgorithm is specified and KeySize is not provided,
 	// key size of 256 will be used for "ecdsa" key algorithm and
 	// key size of 2048 will be used for "rsa" key algorithm.
-	// +kubebuilder:validation:Enum=rsa,ecdsa
+	// +kubebuilder:validation:Enum=rsa,ecdsa,ed25519
 	// +optional
 	KeyAlgorithm KeyAlgorithm `json:"keyAlgorithm,omitempty"`
+
+	// KeyEncoding is the encoding of the private key stored for this
+	// certificate. If provided, allowed values are "pkcs1" and "pkcs8".
+	// Defaults to "pkcs1" if not specified.
+	// +kubebuilder:validation:Enum=pkcs1,pkcs8
+	// +optional
+	KeyEncoding KeyEncoding `json:"keyEncoding,omitempty"`
+
+	// SignatureAlgorithm overrides the signature algorithm that is otherwise
+	// chosen based on KeyAlgorithm and KeySize, e.g. to use SHA-384 with a
+	// 2048 bit RSA key. It must be compatible with KeyAlgorithm.
+	// +kubebuilder:validation:Enum=SHA256WithRSA,SHA384WithRSA,SHA512WithRSA,SHA256WithRSAPSS,SHA384WithRSAPSS,SHA512WithRSAPSS,ECDSAWithSHA256,ECDSAWithSHA384,ECDSAWithSHA512,PureEd25519
+	// +optional
+	SignatureAlgorithm string `json:"signatureAlgorithm,omitempty"`
+
+	// Usages is the set of key usages and extended key usages to be used on
+	// the Certificate.
+	// If no key usages are listed, digitalSignature and keyEncipherment are
+	// used. If Usages is not set, the serverAuth and clientAuth extended key
+	// usages are used, unless the Certificate is a CA, whose extended key
+	// usages are left unset so as not to constrain the certificates it issues.
+	// keyCertSign is always used if IsCA is set.
+	// +optional
+	Usages []KeyUsage `json:"usages,omitempty"`
+}
+
+// OtherName is an otherName subject alt name of a Certificate
+type OtherName struct {
+	// OID is the type of the otherName in dotted decimal form, such as
+	// "1.3.6.1.4.1.311.20.2.3" for a Microsoft user principal name
+	OID string `json:"oid"`
+
+	// UTF8Value is the value of the otherName, encoded as a UTF8String
+	UTF8Value string `json:"utf8Value"`
+}
+
+// NameConstraints are the X.509 name constraints of a CA Certificate
+type NameConstraints struct {
+	// PermittedDNSDomains are the DNS domains, and their subdomains, that the
+	// CA may issue certificates for
+	// +optional
+	PermittedDNSDomains []string `json:"permittedDNSDomains,omitempty"`
+
+	// ExcludedDNSDomains are the DNS domains, and their subdomains, that the
+	// CA may not issue certificates for
+	// +optional
+	ExcludedDNSDomains []string `json:"excludedDNSDomains,omitempty"`
+
+	// PermittedIPRanges are the IP ranges, in CIDR notation, that the CA may
+	// issue certificates for
+	// +optional
+	PermittedIPRanges []string `json:"permittedIPRanges,omitempty"`
+
+	// ExcludedIPRanges are the IP ranges, in CIDR notation, that the CA may
+	// not issue certificates for
+	// +optional
+	ExcludedIPRanges []string `json:"excludedIPRanges,omitempty"`
+}
+
+// X509Subject is the full X.509 subject of a Certificate
+type X509Subject struct {
+	// OrganizationalUnits to be used on the Certificate
+	// +optional
+	OrganizationalUnits []string `json:"organizationalUnits,omitempty"`
+
+	// Countries to be used on the Certificate
+	// +optional
+	Countries []string `json:"countries,omitempty"`
+
+	// Localities (cities) to be used on the Certificate
+	// +optional
+	Localities []string `json:"localities,omitempty"`
+
+	// Provinces (states) to be used on the Certificate
+	// +optional
+	Provinces []string `json:"provinces,omitempty"`
+
+	// StreetAddresses to be used on the Certificate
+	// +optional
+	StreetAddresses []string `json:"streetAddresses,omitempty"`
+
+	// PostalCodes to be used on the Certificate
+	// +optional
+	PostalCodes []string `json:"postalCodes,omitempty"`
 }
 
 // ACMECertificateConfig contains the configuration for the ACME certificate provider
@@ -137,6 +325,11 @@ type CertificateStatus struct {
 	// by this resource in spec.secretName.
 	// +optional
 	NotAfter *metav1.Time `json:"notAfter,omitempty"`
+
+	// The serial number of the certificate stored in the secret named by
+	// this resource in spec.secretName, as colon separated hex octets.
+	// +optional
+	SerialNumber string `json:"serialNumber,omitempty"`
 }
 
 // CertificateCondition contains condition information for an Certificate.
@@ -72,6 +72,11 @@ type IssuerList struct {
 // configuration required for the issuer.
 type IssuerSpec struct {
 	IssuerConfig `json:",inline"`
+
+	// Duration is the default duration of certificates issued by this
+	// issuer, used when a Certificate does not specify a duration.
+	// +optional
+	Duration *metav1.Duration `json:"duration,omitempty"`
 }
 
 type IssuerConfig struct {
@@ -19,10 +19,13 @@ package validation
 import (
 	"fmt"
 	"net"
+	"net/url"
+	"strings"
 
 	"k8s.io/apimachinery/pkg/util/validation/field"
 
 	"github.com/jetstack/cert-manager/pkg/apis/certmanager/v1alpha1"
+	"github.com/jetstack/cert-manager/pkg/util/x509util"
 )
 
 // Validation functions for cert-manager v1alpha1 Certificate types
@@ -47,8 +50,21 @@ func ValidateCertificateSpec(crt *v1alpha1.CertificateSpec, fldPath *field.Path)
 	default:
 		el = append(el, field.Invalid(issuerRefPath.Child("kind"), crt.IssuerRef.Kind, "must be one of Issuer or ClusterIssuer"))
 	}
-	if len(crt.CommonName) == 0 && len(crt.DNSNames) == 0 {
-		el = append(el, field.Required(fldPath.Child("dnsNames"), "at least one dnsName is required if commonName is not set"))
+	if len(crt.CommonName) == 0 && len(crt.DNSNames) == 0 && len(crt.IPAddresses) == 0 && len(crt.EmailAddresses) == 0 && len(crt.URISANs) == 0 && len(crt.OtherNames) == 0 {
+		el = append(el, field.Required(fldPath.Child("dnsNames"), "at least one dnsName, ipAddress, emailAddress, uriSAN or otherName is required if commonName is not set"))
+	}
+	for i, name := range crt.OtherNames {
+		if _, err := x509util.ParseObjectIdentifier(name.OID); err != nil {
+			el = append(el, field.Invalid(fldPath.Child("otherNames").Index(i).Child("oid"), name.OID, err.Error()))
+		}
+	}
+	if len(crt.CommonName) > 0 && strings.TrimSpace(crt.CommonName) == "" {
+		el = append(el, field.Invalid(fldPath.Child("commonName"), crt.CommonName, "must not be only whitespace"))
+	}
+	for i, d := range crt.DNSNames {
+		if strings.TrimSpace(d) == "" {
+			el = append(el, field.Invalid(fldPath.Child("dnsNames").Index(i), d, "must not be empty or only whitespace"))
+		}
 	}
 	if len(crt.IPAddresses) > 0 {
 		el = append(el, validateIPAddresses(crt, fldPath)...)
@@ -70,17 +86,118 @@ func ValidateCertificateSpec(crt *v1alpha1.CertificateSpec, fldPath *field.Path)
 		if crt.KeySize > 0 && crt.KeySize != 256 && crt.KeySize != 384 && crt.KeySize != 521 {
 			el = append(el, field.NotSupported(fldPath.Child("keySize"), crt.KeySize, []string{"256", "384", "521"}))
 		}
+	case v1alpha1.Ed25519KeyAlgorithm:
+		// ed25519 keys have a fixed size, so keySize is ignored
 	default:
-		el = append(el, field.Invalid(fldPath.Child("keyAlgorithm"), crt.KeyAlgorithm, "must be either empty or one of rsa or ecdsa"))
+		el = append(el, field.Invalid(fldPath.Child("keyAlgorithm"), crt.KeyAlgorithm, "must be either empty or one of rsa, ecdsa or ed25519"))
+	}
+	switch crt.KeyEncoding {
+	case v1alpha1.KeyEncoding(""), v1alpha1.PKCS1, v1alpha1.PKCS8:
+	default:
+		el = append(el, field.Invalid(fldPath.Child("keyEncoding"), crt.KeyEncoding, "must be either empty or one of pkcs1 or pkcs8"))
 	}
 
 	if crt.Duration != nil || crt.RenewBefore != nil {
 		el = append(el, ValidateDuration(crt, fldPath)...)
 	}
+	if crt.NotBeforeSkew != nil && crt.NotBeforeSkew.Duration < 0 {
+		el = append(el, field.Invalid(fldPath.Child("notBeforeSkew"), crt.NotBeforeSkew.Duration, "must not be negative"))
+	}
+	if len(crt.Usages) > 0 {
+		el = append(el, validateUsages(crt, fldPath)...)
+	}
+	if crt.MaxPathLen != nil && *crt.MaxPathLen < 0 {
+		el = append(el, field.Invalid(fldPath.Child("maxPathLen"), *crt.MaxPathLen, "must not be negative"))
+	}
+	if crt.NameConstraints != nil {
+		el = append(el, validateNameConstraints(crt.NameConstraints, fldPath.Child("nameConstraints"))...)
+	}
+	if len(crt.SignatureAlgorithm) > 0 {
+		if _, err := x509util.ParseSignatureAlgorithm(crt.SignatureAlgorithm); err != nil {
+			el = append(el, field.Invalid(fldPath.Child("signatureAlgorithm"), crt.SignatureAlgorithm, err.Error()))
+		}
+	}
+	if len(crt.SerialNumber) > 0 {
+		if _, err := x509util.ParseSerialNumber(crt.SerialNumber); err != nil {
+			el = append(el, field.Invalid(fldPath.Child("serialNumber"), crt.SerialNumber, err.Error()))
+		}
+	}
+	el = append(el, validateURLs(crt.CRLDistributionPoints, fldPath.Child("crlDistributionPoints"))...)
+	el = append(el, validateURLs(crt.OCSPServers, fldPath.Child("ocspServers"))...)
+	el = append(el, validateURLs(crt.IssuingCertificateURLs, fldPath.Child("issuingCertificateURLs"))...)
 
 	return el
 }
 
+func validateNameConstraints(nc *v1alpha1.NameConstraints, fldPath *field.Path) field.ErrorList {
+	el := field.ErrorList{}
+	for _, ranges := range []struct {
+		name   string
+		ranges []string
+	}{
+		{"permittedIPRanges", nc.PermittedIPRanges},
+		{"excludedIPRanges", nc.ExcludedIPRanges},
+	} {
+		for i, r := range ranges.ranges {
+			if _, _, err := net.ParseCIDR(strings.TrimSpace(r)); err != nil {
+				el = append(el, field.Invalid(fldPath.Child(ranges.name).Index(i), r, "must be an IP range in CIDR notation"))
+			}
+		}
+	}
+	return el
+}
+
+func validateURLs(urls []string, fldPath *field.Path) field.ErrorList {
+	el := field.ErrorList{}
+	for i, raw := range urls {
+		if u, err := url.Parse(raw); err != nil || !u.IsAbs() || len(u.Host) == 0 {
+			el = append(el, field.Invalid(fldPath.Index(i), raw, "must be an absolute url with a scheme and host"))
+		}
+	}
+	return el
+}
+
+var supportedUsages = []v1alpha1.KeyUsage{
+	v1alpha1.UsageDigitalSignature,
+	v1alpha1.UsageContentCommitment,
+	v1alpha1.UsageKeyEncipherment,
+	v1alpha1.UsageDataEncipherment,
+	v1alpha1.UsageKeyAgreement,
+	v1alpha1.UsageCertSign,
+	v1alpha1.UsageCRLSign,
+	v1alpha1.UsageEncipherOnly,
+	v1alpha1.UsageDecipherOnly,
+	v1alpha1.UsageServerAuth,
+	v1alpha1.UsageClientAuth,
+	v1alpha1.UsageCodeSigning,
+	v1alpha1.UsageEmailProtection,
+	v1alpha1.UsageTimeStamping,
+	v1alpha1.UsageOCSPSigning,
+}
+
+func validateUsages(a *v1alpha1.CertificateSpec, fldPath *field.Path) field.ErrorList {
+	el := field.ErrorList{}
+	for i, u := range a.Usages {
+		if !isSupportedUsage(u) {
+			supported := make([]string, len(supportedUsages))
+			for j, s := range supportedUsages {
+				supported[j] = string(s)
+			}
+			el = append(el, field.NotSupported(fldPath.Child("usages").Index(i), u, supported))
+		}
+	}
+	return el
+}
+
+func isSupportedUsage(u v1alpha1.KeyUsage) bool {
+	for _, s := range supportedUsages {
+		if u == s {
+			return true
+		}
+	}
+	return false
+}
+
 // validateACMEConfigForAllDNSNames will ensure that if the provided Certificate
 // specifies any ACME configuration, all domains listed on the Certificate have
 // a configuration entry.
@@ -114,7 +231,7 @@ func validateIPAddresses(a *v1alpha1.CertificateSpec, fldPath *field.Path) field
 	}
 	el := field.ErrorList{}
 	for i, d := range a.IPAddresses {
-		ip := net.ParseIP(d)
+		ip := net.ParseIP(strings.TrimSpace(d))
 		if ip == nil {
 			el = append(el, field.Invalid(fldPath.Child("ipAddresses").Index(i), d, "invalid IP address"))
 		}
@@ -121,7 +121,16 @@ func TestValidateCertificate(t *testing.T) {
 				},
 			},
 			errs: []*field.Error{
-				field.Required(fldPath.Child("dnsNames"), "at least one dnsName is required if commonName is not set"),
+				field.Required(fldPath.Child("dnsNames"), "at least one dnsName, ipAddress, emailAddress, uriSAN or otherName is required if commonName is not set"),
+			},
+		},
+		"certificate with only ipAddresses": {
+			cfg: &v1alpha1.Certificate{
+				Spec: v1alpha1.CertificateSpec{
+					SecretName:  "abc",
+					IssuerRef:   validIssuerRef,
+					IPAddresses: []string{"127.0.0.1"},
+				},
 			},
 		},
 		"certificate with no issuerRef": {
@@ -369,7 +378,209 @@ func TestValidateCertificate(t *testing.T) {
 				},
 			},
 			errs: []*field.Error{
-				field.Invalid(fldPath.Child("keyAlgorithm"), v1alpha1.KeyAlgorithm("blah"), "must be either empty or one of rsa or ecdsa"),
+				field.Invalid(fldPath.Child("keyAlgorithm"), v1alpha1.KeyAlgorithm("blah"), "must be either empty or one of rsa, ecdsa or ed25519"),
+			},
+		},
+		"valid certificate with pkcs8 keyEncoding": {
+			cfg: &v1alpha1.Certificate{
+				Spec: v1alpha1.CertificateSpec{
+					CommonName:  "testcn",
+					SecretName:  "abc",
+					IssuerRef:   validIssuerRef,
+					KeyEncoding: v1alpha1.PKCS8,
+				},
+			},
+		},
+		"certificate with negative notBeforeSkew": {
+			cfg: &v1alpha1.Certificate{
+				Spec: v1alpha1.CertificateSpec{
+					CommonName:    "testcn",
+					SecretName:    "abc",
+					IssuerRef:     validIssuerRef,
+					NotBeforeSkew: &metav1.Duration{Duration: -time.Minute},
+				},
+			},
+			errs: []*field.Error{
+				field.Invalid(fldPath.Child("notBeforeSkew"), -time.Minute, "must not be negative"),
+			},
+		},
+		"certificate with crlDistributionPoints": {
+			cfg: &v1alpha1.Certificate{
+				Spec: v1alpha1.CertificateSpec{
+					CommonName:            "testcn",
+					SecretName:            "abc",
+					IssuerRef:             validIssuerRef,
+					CRLDistributionPoints: []string{"http://crl.example.com/ca.crl"},
+				},
+			},
+		},
+		"certificate with invalid crlDistributionPoints": {
+			cfg: &v1alpha1.Certificate{
+				Spec: v1alpha1.CertificateSpec{
+					CommonName:            "testcn",
+					SecretName:            "abc",
+					IssuerRef:             validIssuerRef,
+					CRLDistributionPoints: []string{"http://crl.example.com/ca.crl", "/ca.crl"},
+				},
+			},
+			errs: []*field.Error{
+				field.Invalid(fldPath.Child("crlDistributionPoints").Index(1), "/ca.crl", "must be an absolute url with a scheme and host"),
+			},
+		},
+		"certificate with invalid authority information access urls": {
+			cfg: &v1alpha1.Certificate{
+				Spec: v1alpha1.CertificateSpec{
+					CommonName:             "testcn",
+					SecretName:             "abc",
+					IssuerRef:              validIssuerRef,
+					OCSPServers:            []string{"ocsp.example.com"},
+					IssuingCertificateURLs: []string{"http://ca.example.com/ca.crt", "ca.crt"},
+				},
+			},
+			errs: []*field.Error{
+				field.Invalid(fldPath.Child("ocspServers").Index(0), "ocsp.example.com", "must be an absolute url with a scheme and host"),
+				field.Invalid(fldPath.Child("issuingCertificateURLs").Index(1), "ca.crt", "must be an absolute url with a scheme and host"),
+			},
+		},
+		"certificate with serialNumber": {
+			cfg: &v1alpha1.Certificate{
+				Spec: v1alpha1.CertificateSpec{
+					CommonName:   "testcn",
+					SecretName:   "abc",
+					IssuerRef:    validIssuerRef,
+					SerialNumber: "0x3039",
+				},
+			},
+		},
+		"certificate with invalid serialNumber": {
+			cfg: &v1alpha1.Certificate{
+				Spec: v1alpha1.CertificateSpec{
+					CommonName:   "testcn",
+					SecretName:   "abc",
+					IssuerRef:    validIssuerRef,
+					SerialNumber: "0",
+				},
+			},
+			errs: []*field.Error{
+				field.Invalid(fldPath.Child("serialNumber"), "0", `invalid serial number "0": must be positive`),
+			},
+		},
+		"certificate with negative maxPathLen": {
+			cfg: &v1alpha1.Certificate{
+				Spec: v1alpha1.CertificateSpec{
+					CommonName: "testcn",
+					SecretName: "abc",
+					IssuerRef:  validIssuerRef,
+					IsCA:       true,
+					MaxPathLen: func(i int) *int { return &i }(-1),
+				},
+			},
+			errs: []*field.Error{
+				field.Invalid(fldPath.Child("maxPathLen"), -1, "must not be negative"),
+			},
+		},
+		"certificate with invalid nameConstraints": {
+			cfg: &v1alpha1.Certificate{
+				Spec: v1alpha1.CertificateSpec{
+					CommonName: "testcn",
+					SecretName: "abc",
+					IssuerRef:  validIssuerRef,
+					IsCA:       true,
+					NameConstraints: &v1alpha1.NameConstraints{
+						PermittedDNSDomains: []string{"example.com"},
+						PermittedIPRanges:   []string{"10.0.0.0/8"},
+						ExcludedIPRanges:    []string{"10.1.0.0"},
+					},
+				},
+			},
+			errs: []*field.Error{
+				field.Invalid(fldPath.Child("nameConstraints", "excludedIPRanges").Index(0), "10.1.0.0", "must be an IP range in CIDR notation"),
+			},
+		},
+		"certificate with unsupported signatureAlgorithm": {
+			cfg: &v1alpha1.Certificate{
+				Spec: v1alpha1.CertificateSpec{
+					CommonName:         "testcn",
+					SecretName:         "abc",
+					IssuerRef:          validIssuerRef,
+					SignatureAlgorithm: "MD5WithRSA",
+				},
+			},
+			errs: []*field.Error{
+				field.Invalid(fldPath.Child("signatureAlgorithm"), "MD5WithRSA", `unsupported signature algorithm "MD5WithRSA": must be one of ECDSAWithSHA256, ECDSAWithSHA384, ECDSAWithSHA512, PureEd25519, SHA256WithRSA, SHA256WithRSAPSS, SHA384WithRSA, SHA384WithRSAPSS, SHA512WithRSA, SHA512WithRSAPSS`),
+			},
+		},
+		"certificate with only an otherName": {
+			cfg: &v1alpha1.Certificate{
+				Spec: v1alpha1.CertificateSpec{
+					SecretName: "abc",
+					IssuerRef:  validIssuerRef,
+					OtherNames: []v1alpha1.OtherName{{OID: "1.3.6.1.4.1.311.20.2.3", UTF8Value: "alice@example.com"}},
+				},
+			},
+		},
+		"certificate with invalid otherName oid": {
+			cfg: &v1alpha1.Certificate{
+				Spec: v1alpha1.CertificateSpec{
+					CommonName: "testcn",
+					SecretName: "abc",
+					IssuerRef:  validIssuerRef,
+					OtherNames: []v1alpha1.OtherName{{OID: "upn", UTF8Value: "alice@example.com"}},
+				},
+			},
+			errs: []*field.Error{
+				field.Invalid(fldPath.Child("otherNames").Index(0).Child("oid"), "upn", "must have at least two components"),
+			},
+		},
+		"certificate with invalid keyEncoding": {
+			cfg: &v1alpha1.Certificate{
+				Spec: v1alpha1.CertificateSpec{
+					CommonName:  "testcn",
+					SecretName:  "abc",
+					IssuerRef:   validIssuerRef,
+					KeyEncoding: v1alpha1.KeyEncoding("der"),
+				},
+			},
+			errs: []*field.Error{
+				field.Invalid(fldPath.Child("keyEncoding"), v1alpha1.KeyEncoding("der"), "must be either empty or one of pkcs1 or pkcs8"),
+			},
+		},
+		"valid certificate with ed25519 keyAlgorithm and ignored keySize": {
+			cfg: &v1alpha1.Certificate{
+				Spec: v1alpha1.CertificateSpec{
+					CommonName:   "testcn",
+					SecretName:   "abc",
+					IssuerRef:    validIssuerRef,
+					KeyAlgorithm: v1alpha1.Ed25519KeyAlgorithm,
+					KeySize:      256,
+				},
+			},
+		},
+		"valid certificate with usages": {
+			cfg: &v1alpha1.Certificate{
+				Spec: v1alpha1.CertificateSpec{
+					CommonName: "testcn",
+					SecretName: "abc",
+					IssuerRef:  validIssuerRef,
+					Usages:     []v1alpha1.KeyUsage{v1alpha1.UsageDigitalSignature, v1alpha1.UsageServerAuth},
+				},
+			},
+		},
+		"certificate with unknown usage": {
+			cfg: &v1alpha1.Certificate{
+				Spec: v1alpha1.CertificateSpec{
+					CommonName: "testcn",
+					SecretName: "abc",
+					IssuerRef:  validIssuerRef,
+					Usages:     []v1alpha1.KeyUsage{v1alpha1.UsageServerAuth, "blah"},
+				},
+			},
+			errs: []*field.Error{
+				field.NotSupported(fldPath.Child("usages").Index(1), v1alpha1.KeyUsage("blah"), []string{
+					"digitalSignature", "contentCommitment", "keyEncipherment", "dataEncipherment", "keyAgreement",
+					"keyCertSign", "cRLSign", "encipherOnly", "decipherOnly", "serverAuth", "clientAuth",
+					"codeSigning", "emailProtection", "timeStamping", "OCSPSigning",
+				}),
 			},
 		},
 		"valid certificate with ipAddresses": {
@@ -395,6 +606,31 @@ func TestValidateCertificate(t *testing.T) {
 				field.Invalid(fldPath.Child("ipAddresses").Index(0), "blah", "invalid IP address"),
 			},
 		},
+		"valid certificate with padded names": {
+			cfg: &v1alpha1.Certificate{
+				Spec: v1alpha1.CertificateSpec{
+					CommonName:  " testcn ",
+					DNSNames:    []string{"example.com "},
+					IPAddresses: []string{" 127.0.0.1"},
+					SecretName:  "abc",
+					IssuerRef:   validIssuerRef,
+				},
+			},
+		},
+		"certificate with whitespace only names": {
+			cfg: &v1alpha1.Certificate{
+				Spec: v1alpha1.CertificateSpec{
+					CommonName: " ",
+					DNSNames:   []string{"example.com", "\t"},
+					SecretName: "abc",
+					IssuerRef:  validIssuerRef,
+				},
+			},
+			errs: []*field.Error{
+				field.Invalid(fldPath.Child("commonName"), " ", "must not be only whitespace"),
+				field.Invalid(fldPath.Child("dnsNames").Index(1), "\t", "must not be empty or only whitespace"),
+			},
+		},
 	}
 	for n, s := range scenarios {
 		t.Run(n, func(t *testing.T) {
@@ -39,6 +39,9 @@ func ValidateIssuer(iss *v1alpha1.Issuer) field.ErrorList {
 func ValidateIssuerSpec(iss *v1alpha1.IssuerSpec, fldPath *field.Path) field.ErrorList {
 	el := field.ErrorList{}
 	el = ValidateIssuerConfig(&iss.IssuerConfig, fldPath)
+	if iss.Duration != nil && iss.Duration.Duration < v1alpha1.MinimumCertificateDuration {
+		el = append(el, field.Invalid(fldPath.Child("duration"), iss.Duration.Duration, fmt.Sprintf("certificate duration must be greater than %s", v1alpha1.MinimumCertificateDuration)))
+	}
 	return el
 }
 
@@ -17,10 +17,13 @@ limitations under the License.
 package validation
 
 import (
+	"fmt"
 	"reflect"
 	"testing"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/validation/field"
 
 	"github.com/jetstack/cert-manager/pkg/apis/certmanager/v1alpha1"
@@ -262,6 +265,25 @@ func TestValidateIssuerSpec(t *testing.T) {
 				},
 			},
 		},
+		"valid issuer with default duration": {
+			spec: &v1alpha1.IssuerSpec{
+				IssuerConfig: v1alpha1.IssuerConfig{
+					SelfSigned: &v1alpha1.SelfSignedIssuer{},
+				},
+				Duration: &metav1.Duration{Duration: 24 * time.Hour},
+			},
+		},
+		"issuer with default duration less than the minimum": {
+			spec: &v1alpha1.IssuerSpec{
+				IssuerConfig: v1alpha1.IssuerConfig{
+					SelfSigned: &v1alpha1.SelfSignedIssuer{},
+				},
+				Duration: &metav1.Duration{Duration: time.Minute},
+			},
+			errs: []*field.Error{
+				field.Invalid(fldPath.Child("duration"), time.Minute, fmt.Sprintf("certificate duration must be greater than %s", v1alpha1.MinimumCertificateDuration)),
+			},
+		},
 		"missing issuer config": {
 			spec: &v1alpha1.IssuerSpec{
 				IssuerConfig: v1alpha1.IssuerConfig{},
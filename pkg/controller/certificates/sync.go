@@ -176,6 +176,7 @@ func (c *Controller) setCertificateStatus(crt *v1alpha1.Certificate, key crypto.
 
 	metaNotAfter := metav1.NewTime(cert.NotAfter)
 	crt.Status.NotAfter = &metaNotAfter
+	crt.Status.SerialNumber = pki.SerialNumberString(cert)
 
 	// Derive & set 'Ready' condition on Certificate resource
 	matches, matchErrs := c.certificateMatchesSpec(crt, key, cert)
@@ -186,8 +187,10 @@ func (c *Controller) setCertificateStatus(crt *v1alpha1.Certificate, key crypto.
 	case isTemporaryCertificate(cert):
 		reason = "TemporaryCertificate"
 		message = "Certificate issuance in progress. Temporary certificate issued."
-		// clear the NotAfter field as it is not relevant to the user
+		// clear the NotAfter and SerialNumber fields as they are not
+		// relevant to the user
 		crt.Status.NotAfter = nil
+		crt.Status.SerialNumber = ""
 	case cert.NotAfter.Before(c.clock.Now()):
 		reason = "Expired"
 		message = fmt.Sprintf("Certificate has expired on %s", cert.NotAfter.Format(time.RFC822))
@@ -450,7 +453,7 @@ func isTemporaryCertificate(cert *x509.Certificate) bool {
 }
 
 func generateSelfSignedTemporaryCertificate(crt *v1alpha1.Certificate, pk []byte) ([]byte, error) {
-	template, err := pki.GenerateTemplate(crt)
+	template, err := pki.GenerateTemplate(nil, crt)
 	template.SerialNumber = big.NewInt(staticTemporarySerialNumber)
 
 	signer, err := pki.DecodePrivateKeyBytes(pk)
@@ -478,7 +481,7 @@ func generateLocallySignedTemporaryCertificate(crt *v1alpha1.Certificate, pk []b
 	if err != nil {
 		return nil, err
 	}
-	caCertTemplate, err := pki.GenerateTemplate(&v1alpha1.Certificate{
+	caCertTemplate, err := pki.GenerateTemplate(nil, &v1alpha1.Certificate{
 		Spec: v1alpha1.CertificateSpec{
 			CommonName: "cert-manager.local",
 			IsCA:       true,
@@ -493,7 +496,7 @@ func generateLocallySignedTemporaryCertificate(crt *v1alpha1.Certificate, pk []b
 	}
 
 	// sign a temporary certificate using the root CA
-	template, err := pki.GenerateTemplate(crt)
+	template, err := pki.GenerateTemplate(nil, crt)
 	if err != nil {
 		return nil, err
 	}
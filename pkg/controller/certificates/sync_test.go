@@ -479,6 +479,7 @@ func TestSync(t *testing.T) {
 								LastTransitionTime: nowMetaTime,
 							}),
 							gen.SetCertificateNotAfter(metav1.NewTime(cert2.NotAfter)),
+							gen.SetCertificateSerialNumber(pki.SerialNumberString(cert2)),
 						),
 					)),
 					testpkg.NewAction(coretesting.NewUpdateAction(
@@ -568,6 +569,7 @@ func TestSync(t *testing.T) {
 								LastTransitionTime: nowMetaTime,
 							}),
 							gen.SetCertificateNotAfter(metav1.NewTime(cert1.NotAfter)),
+							gen.SetCertificateSerialNumber(pki.SerialNumberString(cert1)),
 						),
 					)),
 				},
@@ -61,7 +61,7 @@ func (a *Acme) Issue(ctx context.Context, crt *v1alpha1.Certificate) (*issuer.Is
 		klog.V(4).Infof("Storing new certificate private key for %s/%s", crt.Namespace, crt.Name)
 		a.Recorder.Eventf(crt, corev1.EventTypeNormal, "Generated", "Generated new private key")
 
-		keyPem, err := pki.EncodePrivateKey(key)
+		keyPem, err := pki.EncodePrivateKeyForCertificate(crt, key)
 		if err != nil {
 			return nil, err
 		}
@@ -197,7 +197,7 @@ func (a *Acme) Issue(ctx context.Context, crt *v1alpha1.Certificate) (*issuer.Is
 	}
 
 	// encode the private key and return
-	keyPem, err := pki.EncodePrivateKey(key)
+	keyPem, err := pki.EncodePrivateKeyForCertificate(crt, key)
 	if err != nil {
 		// TODO: this is probably an internal error - we should fail safer here
 		return nil, err
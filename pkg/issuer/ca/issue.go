@@ -77,32 +77,21 @@ func (c *CA) Issue(ctx context.Context, crt *v1alpha1.Certificate) (*issuer.Issu
 	}
 
 	// generate a x509 certificate template for this Certificate
-	template, err := pki.GenerateTemplate(crt)
+	template, err := pki.GenerateTemplate(c.issuer, crt)
 	if err != nil {
 		c.Recorder.Eventf(crt, corev1.EventTypeWarning, "ErrorSigning", "Error signing certificate: %v", err)
 		return nil, err
 	}
 
-	caCert := caCerts[0]
-
-	// sign and encode the certificate
-	certPem, _, err := pki.SignCertificate(template, caCert, signeePublicKey, caKey)
+	// sign and encode the certificate along with its chain
+	certPem, _, err := pki.SignCertificateWithChain(template, caCerts, signeePublicKey, caKey)
 	if err != nil {
 		c.Recorder.Eventf(crt, corev1.EventTypeWarning, "ErrorSigning", "Error signing certificate: %v", err)
 		return nil, err
 	}
 
-	// encode the chain
-	// TODO: replace caCerts with caCerts[1:]?
-	chainPem, err := pki.EncodeX509Chain(caCerts)
-	if err != nil {
-		return nil, err
-	}
-
-	certPem = append(certPem, chainPem...)
-
 	// Encode output private key and CA cert ready for return
-	keyPem, err := pki.EncodePrivateKey(signeeKey)
+	keyPem, err := pki.EncodePrivateKeyForCertificate(crt, signeeKey)
 	if err != nil {
 		c.Recorder.Eventf(crt, corev1.EventTypeWarning, "ErrorPrivateKey", "Error encoding private key: %v", err)
 		return nil, err
@@ -58,7 +58,7 @@ func generateECDSAPrivateKey(t *testing.T) *ecdsa.PrivateKey {
 }
 
 func generateSelfSignedCert(t *testing.T, crt *v1alpha1.Certificate, key crypto.Signer, duration time.Duration) (derBytes, pemBytes []byte) {
-	template, err := pki.GenerateTemplate(crt)
+	template, err := pki.GenerateTemplate(nil, crt)
 	if err != nil {
 		t.Errorf("error generating template: %v", err)
 	}
@@ -88,10 +88,7 @@ func (v *Vault) Issue(ctx context.Context, crt *v1alpha1.Certificate) (*issuer.I
 	/// END building CSR
 
 	/// BEGIN requesting certificate
-	certDuration := v1alpha1.DefaultCertificateDuration
-	if crt.Spec.Duration != nil {
-		certDuration = crt.Spec.Duration.Duration
-	}
+	certDuration := pki.DurationForCertificate(v.issuer, crt)
 
 	certPem, caPem, err := v.requestVaultCert(template.Subject.CommonName, certDuration, template.DNSNames, pki.IPAddressesToString(template.IPAddresses), pemRequestBuf.Bytes())
 	if err != nil {
@@ -100,7 +97,7 @@ func (v *Vault) Issue(ctx context.Context, crt *v1alpha1.Certificate) (*issuer.I
 	}
 	/// END requesting certificate
 
-	key, err := pki.EncodePrivateKey(signeePrivateKey)
+	key, err := pki.EncodePrivateKeyForCertificate(crt, signeePrivateKey)
 	if err != nil {
 		v.Recorder.Eventf(crt, corev1.EventTypeWarning, "ErrorPrivateKey", "Error encoding private key: %v", err)
 		return nil, err
@@ -30,3 +30,33 @@ func IsInvalidData(err error) bool {
 	}
 	return true
 }
+
+type warningError struct{ error }
+
+// NewWarning returns an error describing a likely misconfiguration that
+// should be reported to the user, but need not prevent the operation.
+func NewWarning(str string, obj ...interface{}) error {
+	return &warningError{error: fmt.Errorf(str, obj...)}
+}
+
+func IsWarning(err error) bool {
+	if _, ok := err.(*warningError); !ok {
+		return false
+	}
+	return true
+}
+
+type unsupportedKeyTypeError struct{ error }
+
+// NewUnsupportedKeyType returns an error for a key whose type is not
+// supported, as distinct from a supported key that is invalid.
+func NewUnsupportedKeyType(str string, obj ...interface{}) error {
+	return &unsupportedKeyTypeError{error: fmt.Errorf(str, obj...)}
+}
+
+func IsUnsupportedKeyType(err error) bool {
+	if _, ok := err.(*unsupportedKeyTypeError); !ok {
+		return false
+	}
+	return true
+}
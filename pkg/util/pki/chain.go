@@ -0,0 +1,384 @@
+/*
+Copyright 2019 The Jetstack cert-manager contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pki
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"time"
+
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+// maxChainLength is the maximum number of certificates CompleteChain and
+// IntermediatesForRoot will follow before giving up, to protect against issuer
+// loops.
+const maxChainLength = 10
+
+// CompleteChain builds a complete chain for the given leaf certificate,
+// fetching any missing intermediates from the caIssuers URLs in the
+// certificates' Authority Information Access extensions.
+// fetch is used to retrieve each URL, so that callers control how requests
+// are made. Fetched data may be DER or PEM encoded.
+// The returned chain starts with the leaf and ends with a root in roots. An
+// error is returned if no chain to a root in roots can be built.
+func CompleteChain(leaf *x509.Certificate, fetch func(url string) ([]byte, error), roots *x509.CertPool) ([]*x509.Certificate, error) {
+	intermediates := x509.NewCertPool()
+
+	current := leaf
+	for i := 0; i < maxChainLength && !bytes.Equal(current.RawIssuer, current.RawSubject); i++ {
+		issuer, err := fetchIssuer(current, fetch)
+		if err != nil {
+			return nil, err
+		}
+		if issuer == nil {
+			break
+		}
+		intermediates.AddCert(issuer)
+		current = issuer
+	}
+
+	chains, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error completing certificate chain: %s", err.Error())
+	}
+	return chains[0], nil
+}
+
+// fetchIssuer fetches the issuer of the given certificate from its caIssuers
+// URLs. nil is returned if the certificate has no caIssuers URLs.
+func fetchIssuer(cert *x509.Certificate, fetch func(url string) ([]byte, error)) (*x509.Certificate, error) {
+	for _, url := range cert.IssuingCertificateURL {
+		data, err := fetch(url)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching issuer certificate from %q: %s", url, err.Error())
+		}
+		candidates, err := parseFetchedCertificates(data)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing issuer certificate from %q: %s", url, err.Error())
+		}
+		for _, candidate := range candidates {
+			if cert.CheckSignatureFrom(candidate) == nil {
+				return candidate, nil
+			}
+		}
+	}
+	if len(cert.IssuingCertificateURL) > 0 {
+		return nil, fmt.Errorf("no issuer of %q found at caIssuers URLs %q", cert.Subject.String(), cert.IssuingCertificateURL)
+	}
+	return nil, nil
+}
+
+// parseFetchedCertificates parses DER or PEM encoded certificates.
+func parseFetchedCertificates(data []byte) ([]*x509.Certificate, error) {
+	if block, _ := pem.Decode(data); block != nil {
+		return DecodeX509CertificateChainBytes(data)
+	}
+	return x509.ParseCertificates(data)
+}
+
+// IntermediatesForRoot returns the intermediates from pool that are needed to
+// chain the given leaf certificate to root, ordered from the issuer of the
+// leaf up to the certificate issued by root. Intermediates in pool that are
+// not part of the path are omitted.
+// Issuers are matched by authority and subject key identifiers, falling back
+// to the issuer and subject names if either is not set, and each signature in
+// the path is checked. If there is more than one path, e.g. because of a
+// cross-signed intermediate, the shortest is returned.
+// An error is returned if there is no path from the leaf to root.
+func IntermediatesForRoot(leaf *x509.Certificate, pool []*x509.Certificate, root *x509.Certificate) ([]*x509.Certificate, error) {
+	if issuedBy(leaf, root) {
+		return []*x509.Certificate{}, nil
+	}
+
+	// breadth first search, so that the shortest path is found first
+	type path struct {
+		last  *x509.Certificate
+		certs []*x509.Certificate
+	}
+	paths := []path{{last: leaf}}
+	for i := 0; i < maxChainLength && len(paths) > 0; i++ {
+		var next []path
+		for _, p := range paths {
+			for _, candidate := range pool {
+				if containsCertificate(p.certs, candidate) || candidate.Equal(leaf) || !issuedBy(p.last, candidate) {
+					continue
+				}
+				certs := append(append([]*x509.Certificate{}, p.certs...), candidate)
+				if issuedBy(candidate, root) {
+					return certs, nil
+				}
+				next = append(next, path{last: candidate, certs: certs})
+			}
+		}
+		paths = next
+	}
+	return nil, fmt.Errorf("no chain from %q to root %q found", leaf.Subject.String(), root.Subject.String())
+}
+
+// issuedBy returns true if child was signed by parent.
+func issuedBy(child, parent *x509.Certificate) bool {
+	if len(child.AuthorityKeyId) > 0 && len(parent.SubjectKeyId) > 0 {
+		if !bytes.Equal(child.AuthorityKeyId, parent.SubjectKeyId) {
+			return false
+		}
+	} else if !bytes.Equal(child.RawIssuer, parent.RawSubject) {
+		return false
+	}
+	return child.CheckSignatureFrom(parent) == nil
+}
+
+func containsCertificate(certs []*x509.Certificate, cert *x509.Certificate) bool {
+	for _, c := range certs {
+		if c.Equal(cert) {
+			return true
+		}
+	}
+	return false
+}
+
+// OrderCertificateChain sorts the given certificates into a chain, starting
+// with the leaf and followed by each certificate's issuer up to the root, as
+// expected by EncodeX509ChainVerbatim. The root may be omitted, in which case the
+// chain ends with the last intermediate. Issuers are matched as for
+// IntermediatesForRoot, and duplicate certificates are dropped.
+// An error is returned if the certificates do not form a single unbroken
+// chain, identifying the certificates whose issuer is missing, or where the
+// chain branches.
+func OrderCertificateChain(certs []*x509.Certificate) ([]*x509.Certificate, error) {
+	var unique []*x509.Certificate
+	for _, cert := range certs {
+		if !containsCertificate(unique, cert) {
+			unique = append(unique, cert)
+		}
+	}
+	if len(unique) == 0 {
+		return nil, fmt.Errorf("no certificates provided")
+	}
+
+	// issuers[i] is the index of the issuer of unique[i], or -1 if its issuer
+	// is not in the set
+	issuers := make([]int, len(unique))
+	var tops []int
+	for i, cert := range unique {
+		issuers[i] = -1
+		for j, candidate := range unique {
+			if i != j && issuedBy(cert, candidate) {
+				issuers[i] = j
+				break
+			}
+		}
+		if issuers[i] == -1 {
+			tops = append(tops, i)
+		}
+	}
+
+	switch {
+	case len(tops) == 0:
+		return nil, fmt.Errorf("certificate chain contains an issuer loop")
+	case len(tops) > 1:
+		var errs []error
+		for _, i := range tops {
+			if !bytes.Equal(unique[i].RawIssuer, unique[i].RawSubject) {
+				errs = append(errs, fmt.Errorf("issuer %q of %q not found", unique[i].Issuer.String(), unique[i].Subject.String()))
+			}
+		}
+		if len(errs) == 0 {
+			errs = append(errs, fmt.Errorf("more than one root certificate found"))
+		}
+		return nil, fmt.Errorf("certificates do not form a single chain: %s", utilerrors.NewAggregate(errs).Error())
+	}
+
+	// walk down from the top of the chain to the leaf
+	chain := []*x509.Certificate{unique[tops[0]]}
+	for current := tops[0]; ; {
+		var children []int
+		for i := range unique {
+			if issuers[i] == current {
+				children = append(children, i)
+			}
+		}
+		if len(children) == 0 {
+			break
+		}
+		if len(children) > 1 {
+			return nil, fmt.Errorf("certificate chain branches: %q issued both %q and %q", unique[current].Subject.String(), unique[children[0]].Subject.String(), unique[children[1]].Subject.String())
+		}
+		current = children[0]
+		chain = append(chain, unique[current])
+	}
+	if len(chain) != len(unique) {
+		return nil, fmt.Errorf("certificate chain contains an issuer loop")
+	}
+
+	for i, j := 0, len(chain)-1; i < j; i, j = i+1, j-1 {
+		chain[i], chain[j] = chain[j], chain[i]
+	}
+	return chain, nil
+}
+
+// ValidateKeyIdentifierLinkage checks that the AuthorityKeyId of each
+// certificate in the given chain matches the SubjectKeyId of the certificate
+// after it, which is expected to be its issuer. Pairs where either identifier
+// is absent, as on some older certificates, are skipped. An error naming the
+// subjects of each mismatched pair is returned.
+func ValidateKeyIdentifierLinkage(chain []*x509.Certificate) error {
+	var errs []error
+	for i := 0; i+1 < len(chain); i++ {
+		child, parent := chain[i], chain[i+1]
+		if len(child.AuthorityKeyId) == 0 || len(parent.SubjectKeyId) == 0 {
+			continue
+		}
+		if !bytes.Equal(child.AuthorityKeyId, parent.SubjectKeyId) {
+			errs = append(errs, fmt.Errorf("authority key identifier %x of %q does not match subject key identifier %x of %q", child.AuthorityKeyId, child.Subject.String(), parent.SubjectKeyId, parent.Subject.String()))
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// SameTrustAnchor verifies both of the given chains against roots and reports
+// whether they chain to the same root certificate, e.g. to confirm that
+// serving a cross-signed bundle in place of another will not break trust.
+// Each chain starts with its leaf, followed by any intermediates. If a chain
+// verifies to more than one root, e.g. because of a cross-signed
+// intermediate, the chains share an anchor if any of their roots match.
+// An error is returned if either chain is empty or cannot be verified.
+func SameTrustAnchor(chainA, chainB []*x509.Certificate, roots *x509.CertPool) (bool, error) {
+	anchorsA, err := trustAnchors(chainA, roots)
+	if err != nil {
+		return false, err
+	}
+	anchorsB, err := trustAnchors(chainB, roots)
+	if err != nil {
+		return false, err
+	}
+	for _, anchor := range anchorsA {
+		if containsCertificate(anchorsB, anchor) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// trustAnchors returns the roots that the given chain verifies to.
+func trustAnchors(chain []*x509.Certificate, roots *x509.CertPool) ([]*x509.Certificate, error) {
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("certificate chain is empty")
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range chain[1:] {
+		intermediates.AddCert(cert)
+	}
+	chains, err := chain[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error verifying certificate chain for %q: %s", chain[0].Subject.String(), err.Error())
+	}
+	var anchors []*x509.Certificate
+	for _, c := range chains {
+		if root := c[len(c)-1]; !containsCertificate(anchors, root) {
+			anchors = append(anchors, root)
+		}
+	}
+	return anchors, nil
+}
+
+// VerifyCertificateChain returns an error if the given leaf certificate does
+// not verify against the given roots, using the given intermediates to build
+// the chain, or if it is not valid for dnsName. It is intended to check a
+// signed certificate before it is stored.
+// dnsName is not checked if it is empty, and the extended key usages of the
+// chain are not checked. The chain is verified at the current time.
+func VerifyCertificateChain(leaf *x509.Certificate, intermediates, roots []*x509.Certificate, dnsName string) error {
+	return VerifyCertificateChainAt(leaf, intermediates, roots, dnsName, time.Time{})
+}
+
+// VerifyCertificateChainAt verifies a certificate chain as
+// VerifyCertificateChain does, but at the given time, such as the time the
+// leaf was issued. The zero time means the current time.
+func VerifyCertificateChainAt(leaf *x509.Certificate, intermediates, roots []*x509.Certificate, dnsName string, at time.Time) error {
+	if len(roots) == 0 {
+		return fmt.Errorf("no root certificates to verify against")
+	}
+	opts := x509.VerifyOptions{
+		DNSName:       dnsName,
+		Intermediates: x509.NewCertPool(),
+		Roots:         x509.NewCertPool(),
+		CurrentTime:   at,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}
+	for _, cert := range intermediates {
+		opts.Intermediates.AddCert(cert)
+	}
+	for _, cert := range roots {
+		opts.Roots.AddCert(cert)
+	}
+	_, err := leaf.Verify(opts)
+	return err
+}
+
+// CertRole is the role of a certificate within a chain.
+type CertRole int
+
+const (
+	// CertRoleLeaf is an end entity certificate, which is not a CA.
+	CertRoleLeaf CertRole = iota
+
+	// CertRoleIntermediate is a CA certificate issued by another CA.
+	CertRoleIntermediate
+
+	// CertRoleRoot is a self signed CA certificate.
+	CertRoleRoot
+)
+
+// ClassifyCertificate returns the role of the given certificate: a root if
+// it is a self signed CA, an intermediate if it is a CA that is not self
+// signed, and otherwise a leaf.
+func ClassifyCertificate(cert *x509.Certificate) CertRole {
+	switch {
+	case !cert.IsCA:
+		return CertRoleLeaf
+	case IsSelfSigned(cert):
+		return CertRoleRoot
+	default:
+		return CertRoleIntermediate
+	}
+}
+
+// IsSelfSigned returns true if the given certificate is signed by its own
+// key. Its issuer must match its subject, by key identifier if both are set
+// or otherwise by name, and its signature is checked. Unlike issuedBy, the
+// certificate does not need to be a CA.
+func IsSelfSigned(cert *x509.Certificate) bool {
+	if len(cert.AuthorityKeyId) > 0 && len(cert.SubjectKeyId) > 0 {
+		if !bytes.Equal(cert.AuthorityKeyId, cert.SubjectKeyId) {
+			return false
+		}
+	} else if !bytes.Equal(cert.RawIssuer, cert.RawSubject) {
+		return false
+	}
+	return cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature) == nil
+}
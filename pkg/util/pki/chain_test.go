@@ -0,0 +1,462 @@
+/*
+Copyright 2019 The Jetstack cert-manager contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pki
+
+import (
+	"crypto/x509"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompleteChain(t *testing.T) {
+	const (
+		rootURL         = "http://ca.example.com/root.crt"
+		intermediateURL = "http://ca.example.com/intermediate.crt"
+	)
+	root, rootKey := signTestCertificate(t, buildCACertificate("root"), nil, nil)
+	intermediate, intermediateKey := signTestCertificate(t, buildCACertificate("intermediate"), root, rootKey, withSignTestTemplateOptions(WithIssuingCertificateURLs(rootURL)))
+	leaf, _ := signTestCertificate(t, buildCertificate("leaf"), intermediate, intermediateKey, withSignTestTemplateOptions(WithIssuingCertificateURLs(intermediateURL)))
+	otherRoot, _ := signTestCertificate(t, buildCACertificate("other-root"), nil, nil)
+
+	fetch := func(url string) ([]byte, error) {
+		switch url {
+		case rootURL:
+			return root.Raw, nil
+		case intermediateURL:
+			return mustEncodeX509(t, intermediate), nil
+		default:
+			return nil, fmt.Errorf("not found")
+		}
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+	chain, err := CompleteChain(leaf, fetch, roots)
+	if err != nil {
+		t.Fatalf("expected chain to be completed but got: %v", err)
+	}
+	expected := []*x509.Certificate{leaf, intermediate, root}
+	if len(chain) != len(expected) {
+		t.Fatalf("expected chain of length %d but got %d", len(expected), len(chain))
+	}
+	for i := range expected {
+		if !chain[i].Equal(expected[i]) {
+			t.Errorf("expected certificate %d to be %q but got %q", i, expected[i].Subject.CommonName, chain[i].Subject.CommonName)
+		}
+	}
+
+	// the fetched root is not trusted
+	untrusted := x509.NewCertPool()
+	untrusted.AddCert(otherRoot)
+	if _, err := CompleteChain(leaf, fetch, untrusted); err == nil {
+		t.Errorf("expected an error completing a chain to an untrusted root")
+	}
+
+	// the intermediate cannot be fetched
+	failingFetch := func(url string) ([]byte, error) {
+		return nil, fmt.Errorf("connection refused")
+	}
+	if _, err := CompleteChain(leaf, failingFetch, roots); err == nil {
+		t.Errorf("expected an error when the intermediate cannot be fetched")
+	}
+}
+
+func TestIntermediatesForRoot(t *testing.T) {
+	root, rootKey := signTestCertificate(t, buildCACertificate("root"), nil, nil)
+	otherRoot, otherRootKey := signTestCertificate(t, buildCACertificate("other-root"), nil, nil)
+	intermediateA, intermediateAKey := signTestCertificate(t, buildCACertificate("intermediate-a"), root, rootKey)
+	intermediateB, intermediateBKey := signTestCertificate(t, buildCACertificate("intermediate-b"), intermediateA, intermediateAKey)
+	sibling, _ := signTestCertificate(t, buildCACertificate("sibling"), root, rootKey)
+	other, _ := signTestCertificate(t, buildCACertificate("other"), otherRoot, otherRootKey)
+	leaf, _ := signTestCertificate(t, buildCertificate("leaf"), intermediateB, intermediateBKey)
+	directLeaf, _ := signTestCertificate(t, buildCertificate("direct-leaf"), root, rootKey)
+
+	pool := []*x509.Certificate{other, intermediateA, sibling, intermediateB}
+
+	type testT struct {
+		name        string
+		leaf        *x509.Certificate
+		root        *x509.Certificate
+		expected    []*x509.Certificate
+		expectedErr bool
+	}
+	tests := []testT{
+		{
+			name:     "extraneous intermediates are omitted",
+			leaf:     leaf,
+			root:     root,
+			expected: []*x509.Certificate{intermediateB, intermediateA},
+		},
+		{
+			name:     "leaf issued directly by the root",
+			leaf:     directLeaf,
+			root:     root,
+			expected: []*x509.Certificate{},
+		},
+		{
+			name:        "no path to the root",
+			leaf:        leaf,
+			root:        otherRoot,
+			expectedErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			intermediates, err := IntermediatesForRoot(test.leaf, pool, test.root)
+			if test.expectedErr {
+				if err == nil {
+					t.Errorf("expected an error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error but got: %v", err)
+			}
+			if len(intermediates) != len(test.expected) {
+				t.Fatalf("expected %d intermediates but got %d", len(test.expected), len(intermediates))
+			}
+			for i := range test.expected {
+				if !intermediates[i].Equal(test.expected[i]) {
+					t.Errorf("expected intermediate %d to be %q but got %q", i, test.expected[i].Subject.CommonName, intermediates[i].Subject.CommonName)
+				}
+			}
+		})
+	}
+}
+
+func TestSameTrustAnchor(t *testing.T) {
+	root, rootKey := signTestCertificate(t, buildCACertificate("root"), nil, nil)
+	otherRoot, otherRootKey := signTestCertificate(t, buildCACertificate("other-root"), nil, nil)
+	intermediate, intermediateKey := signTestCertificate(t, buildCACertificate("intermediate"), root, rootKey)
+	leaf, _ := signTestCertificate(t, buildCertificate("leaf"), intermediate, intermediateKey)
+	directLeaf, _ := signTestCertificate(t, buildCertificate("direct-leaf"), root, rootKey)
+	otherLeaf, _ := signTestCertificate(t, buildCertificate("other-leaf"), otherRoot, otherRootKey)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+	roots.AddCert(otherRoot)
+
+	type testT struct {
+		name        string
+		chainA      []*x509.Certificate
+		chainB      []*x509.Certificate
+		expected    bool
+		expectedErr bool
+	}
+	tests := []testT{
+		{
+			name:     "same anchor",
+			chainA:   []*x509.Certificate{leaf, intermediate},
+			chainB:   []*x509.Certificate{directLeaf},
+			expected: true,
+		},
+		{
+			name:   "different anchors",
+			chainA: []*x509.Certificate{leaf, intermediate},
+			chainB: []*x509.Certificate{otherLeaf},
+		},
+		{
+			name:        "missing intermediate",
+			chainA:      []*x509.Certificate{leaf},
+			chainB:      []*x509.Certificate{directLeaf},
+			expectedErr: true,
+		},
+		{
+			name:        "empty chain",
+			chainA:      []*x509.Certificate{directLeaf},
+			expectedErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			same, err := SameTrustAnchor(test.chainA, test.chainB, roots)
+			if test.expectedErr {
+				if err == nil {
+					t.Errorf("expected an error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error but got: %v", err)
+			}
+			if same != test.expected {
+				t.Errorf("expected %t but got %t", test.expected, same)
+			}
+		})
+	}
+}
+
+func TestClassifyCertificate(t *testing.T) {
+	root, rootKey := signTestCertificate(t, buildCACertificate("root"), nil, nil)
+	intermediate, intermediateKey := signTestCertificate(t, buildCACertificate("intermediate"), root, rootKey)
+	leaf, _ := signTestCertificate(t, buildCertificate("leaf"), intermediate, intermediateKey)
+	selfSignedLeaf, _ := signTestCertificate(t, buildCertificate("self-signed-leaf"), nil, nil)
+
+	tests := map[string]struct {
+		cert       *x509.Certificate
+		expected   CertRole
+		selfSigned bool
+	}{
+		"root":             {cert: root, expected: CertRoleRoot, selfSigned: true},
+		"intermediate":     {cert: intermediate, expected: CertRoleIntermediate},
+		"leaf":             {cert: leaf, expected: CertRoleLeaf},
+		"self signed leaf": {cert: selfSignedLeaf, expected: CertRoleLeaf, selfSigned: true},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if role := ClassifyCertificate(test.cert); role != test.expected {
+				t.Errorf("expected role %d but got %d", test.expected, role)
+			}
+			if selfSigned := IsSelfSigned(test.cert); selfSigned != test.selfSigned {
+				t.Errorf("expected self signed to be %t but got %t", test.selfSigned, selfSigned)
+			}
+		})
+	}
+}
+
+func TestValidateKeyIdentifierLinkage(t *testing.T) {
+	root, rootKey := signTestCertificate(t, buildCACertificate("root"), nil, nil)
+	intermediate, intermediateKey := signTestCertificate(t, buildCACertificate("intermediate"), root, rootKey)
+	leaf, _ := signTestCertificate(t, buildCertificate("leaf"), intermediate, intermediateKey)
+
+	mismatched := *leaf
+	mismatched.AuthorityKeyId = []byte{1, 2, 3, 4}
+	noSubjectKeyId := *intermediate
+	noSubjectKeyId.SubjectKeyId = nil
+
+	tests := map[string]struct {
+		chain       []*x509.Certificate
+		expectedErr string
+	}{
+		"valid chain":                 {chain: []*x509.Certificate{leaf, intermediate, root}},
+		"single certificate":          {chain: []*x509.Certificate{leaf}},
+		"missing subject key id":      {chain: []*x509.Certificate{&mismatched, &noSubjectKeyId}},
+		"mismatched authority key id": {chain: []*x509.Certificate{&mismatched, intermediate, root}, expectedErr: `"CN=leaf,O=cert-manager"`},
+		"out of order chain":          {chain: []*x509.Certificate{leaf, root}, expectedErr: `"CN=root,O=cert-manager"`},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := ValidateKeyIdentifierLinkage(test.chain)
+			if test.expectedErr == "" {
+				if err != nil {
+					t.Errorf("expected no error but got: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.expectedErr) {
+				t.Errorf("expected error naming %s but got: %v", test.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestVerifyCertificateChain(t *testing.T) {
+	root, rootKey := signTestCertificate(t, buildCACertificate("root"), nil, nil)
+	intermediate, intermediateKey := signTestCertificate(t, buildCACertificate("intermediate"), root, rootKey)
+	leaf, _ := signTestCertificate(t, buildCertificate("leaf", "leaf.example.com"), intermediate, intermediateKey)
+	otherRoot, _ := signTestCertificate(t, buildCACertificate("other-root"), nil, nil)
+	intermediates := []*x509.Certificate{intermediate}
+
+	tests := map[string]struct {
+		intermediates []*x509.Certificate
+		roots         []*x509.Certificate
+		dnsName       string
+		at            time.Time
+		expectedErr   bool
+	}{
+		"valid chain": {
+			intermediates: intermediates,
+			roots:         []*x509.Certificate{root},
+			dnsName:       "leaf.example.com",
+		},
+		"no dns name": {
+			intermediates: intermediates,
+			roots:         []*x509.Certificate{root},
+		},
+		"valid at issuance time": {
+			intermediates: intermediates,
+			roots:         []*x509.Certificate{root},
+			at:            leaf.NotBefore,
+		},
+		"expired": {
+			intermediates: intermediates,
+			roots:         []*x509.Certificate{root},
+			at:            leaf.NotAfter.Add(time.Minute),
+			expectedErr:   true,
+		},
+		"wrong host": {
+			intermediates: intermediates,
+			roots:         []*x509.Certificate{root},
+			dnsName:       "other.example.com",
+			expectedErr:   true,
+		},
+		"untrusted root": {
+			intermediates: intermediates,
+			roots:         []*x509.Certificate{otherRoot},
+			expectedErr:   true,
+		},
+		"missing intermediate": {
+			roots:       []*x509.Certificate{root},
+			expectedErr: true,
+		},
+		"no roots": {
+			intermediates: intermediates,
+			expectedErr:   true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := VerifyCertificateChainAt(leaf, test.intermediates, test.roots, test.dnsName, test.at)
+			if test.expectedErr != (err != nil) {
+				t.Errorf("expected error %t but got %v", test.expectedErr, err)
+			}
+			if test.at.IsZero() {
+				if err2 := VerifyCertificateChain(leaf, test.intermediates, test.roots, test.dnsName); (err2 != nil) != (err != nil) {
+					t.Errorf("expected VerifyCertificateChain to agree with VerifyCertificateChainAt, got %v and %v", err2, err)
+				}
+			}
+		})
+	}
+}
+
+func TestOrderCertificateChain(t *testing.T) {
+	root, rootKey := signTestCertificate(t, buildCACertificate("root"), nil, nil)
+	intermediate, intermediateKey := signTestCertificate(t, buildCACertificate("intermediate"), root, rootKey)
+	leaf, _ := signTestCertificate(t, buildCertificate("leaf"), intermediate, intermediateKey)
+	otherLeaf, _ := signTestCertificate(t, buildCertificate("other-leaf"), intermediate, intermediateKey)
+	otherRoot, _ := signTestCertificate(t, buildCACertificate("other-root"), nil, nil)
+
+	tests := map[string]struct {
+		certs       []*x509.Certificate
+		expected    []*x509.Certificate
+		expectedErr string
+	}{
+		"ordered chain": {
+			certs:    []*x509.Certificate{leaf, intermediate, root},
+			expected: []*x509.Certificate{leaf, intermediate, root},
+		},
+		"misordered chain": {
+			certs:    []*x509.Certificate{root, leaf, intermediate},
+			expected: []*x509.Certificate{leaf, intermediate, root},
+		},
+		"chain without root": {
+			certs:    []*x509.Certificate{intermediate, leaf},
+			expected: []*x509.Certificate{leaf, intermediate},
+		},
+		"duplicates are dropped": {
+			certs:    []*x509.Certificate{intermediate, leaf, intermediate, root, leaf},
+			expected: []*x509.Certificate{leaf, intermediate, root},
+		},
+		"single certificate": {
+			certs:    []*x509.Certificate{leaf},
+			expected: []*x509.Certificate{leaf},
+		},
+		"missing intermediate": {
+			certs:       []*x509.Certificate{root, leaf},
+			expectedErr: `issuer "CN=intermediate,O=cert-manager" of "CN=leaf,O=cert-manager" not found`,
+		},
+		"unrelated roots": {
+			certs:       []*x509.Certificate{root, otherRoot},
+			expectedErr: "more than one root certificate found",
+		},
+		"branching chain": {
+			certs:       []*x509.Certificate{leaf, otherLeaf, intermediate, root},
+			expectedErr: "certificate chain branches",
+		},
+		"no certificates": {
+			expectedErr: "no certificates provided",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			chain, err := OrderCertificateChain(test.certs)
+			if test.expectedErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.expectedErr) {
+					t.Fatalf("expected error containing %q but got %v", test.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(chain) != len(test.expected) {
+				t.Fatalf("expected %d certificates but got %d", len(test.expected), len(chain))
+			}
+			for i := range chain {
+				if !chain[i].Equal(test.expected[i]) {
+					t.Errorf("expected certificate %d to be %q but got %q", i, test.expected[i].Subject, chain[i].Subject)
+				}
+			}
+		})
+	}
+}
+
+func TestEncodeX509Chain(t *testing.T) {
+	root, rootKey := signTestCertificate(t, buildCACertificate("root"), nil, nil)
+	intermediate, intermediateKey := signTestCertificate(t, buildCACertificate("intermediate"), root, rootKey)
+	leaf, _ := signTestCertificate(t, buildCertificate("leaf"), intermediate, intermediateKey)
+
+	tests := map[string]struct {
+		encode   func([]*x509.Certificate) ([]byte, error)
+		chain    []*x509.Certificate
+		expected []*x509.Certificate
+	}{
+		"self signed root is dropped": {
+			encode:   EncodeX509Chain,
+			chain:    []*x509.Certificate{leaf, intermediate, root},
+			expected: []*x509.Certificate{leaf, intermediate},
+		},
+		"verbatim leaf to root": {
+			encode:   EncodeX509ChainVerbatim,
+			chain:    []*x509.Certificate{leaf, intermediate, root},
+			expected: []*x509.Certificate{leaf, intermediate, root},
+		},
+		"verbatim root to leaf": {
+			encode:   EncodeX509ChainVerbatim,
+			chain:    []*x509.Certificate{root, intermediate, leaf},
+			expected: []*x509.Certificate{root, intermediate, leaf},
+		},
+		"verbatim leaf only": {
+			encode:   EncodeX509ChainVerbatim,
+			chain:    []*x509.Certificate{leaf},
+			expected: []*x509.Certificate{leaf},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			pemBytes, err := test.encode(test.chain)
+			if err != nil {
+				t.Fatalf("error encoding chain: %v", err)
+			}
+			certs, err := DecodeX509CertificateChainBytes(pemBytes)
+			if err != nil {
+				t.Fatalf("error decoding chain: %v", err)
+			}
+			if len(certs) != len(test.expected) {
+				t.Fatalf("expected %d certificates but got %d", len(test.expected), len(certs))
+			}
+			for i := range certs {
+				if !certs[i].Equal(test.expected[i]) {
+					t.Errorf("expected certificate %d to be %q but got %q", i, test.expected[i].Subject, certs[i].Subject)
+				}
+			}
+		})
+	}
+}
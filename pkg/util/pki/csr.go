@@ -19,50 +19,186 @@ package pki
 import (
 	"bytes"
 	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rand"
+	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
 	"fmt"
+	"io"
 	"math/big"
 	"net"
+	"net/url"
+	"strings"
 	"time"
 
+	"k8s.io/klog"
+
 	"github.com/jetstack/cert-manager/pkg/apis/certmanager/v1alpha1"
+	"github.com/jetstack/cert-manager/pkg/util/errors"
+	"github.com/jetstack/cert-manager/pkg/util/x509util"
 )
 
 // CommonNameForCertificate returns the common name that should be used for the
 // given Certificate resource, by inspecting the CommonName and DNSNames fields.
+// Leading and trailing whitespace is trimmed.
 func CommonNameForCertificate(crt *v1alpha1.Certificate) string {
-	if crt.Spec.CommonName != "" {
-		return crt.Spec.CommonName
+	if cn := strings.TrimSpace(crt.Spec.CommonName); cn != "" {
+		return cn
 	}
-	if len(crt.Spec.DNSNames) == 0 {
+	dnsNames := trimNames(crt.Spec.DNSNames)
+	if len(dnsNames) == 0 {
 		return ""
 	}
-	return crt.Spec.DNSNames[0]
+	return dnsNames[0]
+}
+
+// trimNames returns the given names with leading and trailing whitespace
+// trimmed, omitting any that are empty or only whitespace.
+func trimNames(names []string) []string {
+	var trimmed []string
+	for _, name := range names {
+		if name = strings.TrimSpace(name); name != "" {
+			trimmed = append(trimmed, name)
+		}
+	}
+	return trimmed
 }
 
+// validateNames returns an error if the common name, or any DNS name, IP
+// address, email address or URI, of the given Certificate is set but only
+// whitespace, if the common name, any DNS name, email address or URI contains
+// invalid characters, if any IP address cannot be parsed, if any email
+// address does not contain an '@', or if any URI cannot be parsed or is not
+// absolute. All malformed email addresses are listed in the error.
+func validateNames(crt *v1alpha1.Certificate) error {
+	if crt.Spec.CommonName != "" && strings.TrimSpace(crt.Spec.CommonName) == "" {
+		return fmt.Errorf("common name must not be only whitespace")
+	}
+	if err := validateSANCharacters("common name", crt.Spec.CommonName); err != nil {
+		return err
+	}
+	for _, name := range crt.Spec.DNSNames {
+		if strings.TrimSpace(name) == "" {
+			return fmt.Errorf("dns names must not be empty or only whitespace")
+		}
+		if err := validateSANCharacters("dns name", name); err != nil {
+			return err
+		}
+	}
+	for _, ip := range crt.Spec.IPAddresses {
+		if strings.TrimSpace(ip) == "" {
+			return fmt.Errorf("ip addresses must not be empty or only whitespace")
+		}
+		if net.ParseIP(strings.TrimSpace(ip)) == nil {
+			return fmt.Errorf("invalid ip address: %q", ip)
+		}
+	}
+	var malformed []string
+	for _, email := range crt.Spec.EmailAddresses {
+		if strings.TrimSpace(email) == "" {
+			return fmt.Errorf("email addresses must not be empty or only whitespace")
+		}
+		if err := validateSANCharacters("email address", email); err != nil {
+			return err
+		}
+		if !strings.Contains(email, "@") {
+			malformed = append(malformed, fmt.Sprintf("%q", email))
+		}
+	}
+	if len(malformed) > 0 {
+		return fmt.Errorf("invalid email addresses: %s", strings.Join(malformed, ", "))
+	}
+	for _, uri := range crt.Spec.URISANs {
+		if strings.TrimSpace(uri) == "" {
+			return fmt.Errorf("uris must not be empty or only whitespace")
+		}
+		if err := validateSANCharacters("uri", uri); err != nil {
+			return err
+		}
+		u, err := url.Parse(strings.TrimSpace(uri))
+		if err != nil {
+			return fmt.Errorf("invalid uri %q: %s", uri, err.Error())
+		}
+		if !u.IsAbs() {
+			return fmt.Errorf("invalid uri %q: must be an absolute uri with a scheme", uri)
+		}
+	}
+	return nil
+}
+
+// CommonNameSANPolicy determines how the CommonName of a Certificate
+// resource is reflected in the DNS names of the issued certificate.
+type CommonNameSANPolicy int
+
+const (
+	// CommonNameSANPolicyInclude always includes the CommonName as the first
+	// DNS name, removing any duplicate of it from the remaining DNS names.
+	// This is the default.
+	CommonNameSANPolicyInclude CommonNameSANPolicy = iota
+
+	// CommonNameSANPolicyIncludeIfAbsent includes the CommonName as the first
+	// DNS name only if it is not already listed in DNSNames. If it is already
+	// listed, the DNSNames are used as specified, other than being lower
+	// cased and deduplicated.
+	CommonNameSANPolicyIncludeIfAbsent
+
+	// CommonNameSANPolicyOmit never includes the CommonName in the DNS names.
+	CommonNameSANPolicyOmit
+)
+
 // DNSNamesForCertificate returns the DNS names that should be used for the
 // given Certificate resource, by inspecting the CommonName and DNSNames fields.
 func DNSNamesForCertificate(crt *v1alpha1.Certificate) []string {
-	if len(crt.Spec.DNSNames) == 0 {
-		if crt.Spec.CommonName == "" {
+	return DNSNamesForCertificateWithPolicy(crt, CommonNameSANPolicyInclude)
+}
+
+// DNSNamesForCertificateWithPolicy returns the DNS names that should be used
+// for the given Certificate resource, by inspecting the CommonName and DNSNames
+// fields. The given policy determines how the CommonName is included.
+// Leading and trailing whitespace is trimmed, and names that are only
+// whitespace are omitted. As DNS names are case-insensitive, names are
+// lower cased and duplicates removed. The case of the CommonName in the
+// subject is not affected.
+func DNSNamesForCertificateWithPolicy(crt *v1alpha1.Certificate, policy CommonNameSANPolicy) []string {
+	commonName := strings.ToLower(strings.TrimSpace(crt.Spec.CommonName))
+	dnsNames := lowerNames(trimNames(crt.Spec.DNSNames))
+	if commonName == "" || policy == CommonNameSANPolicyOmit {
+		if len(dnsNames) == 0 {
 			return []string{}
 		}
-		return []string{crt.Spec.CommonName}
+		return removeDuplicates(dnsNames)
 	}
-	if crt.Spec.CommonName != "" {
-		return removeDuplicates(append([]string{crt.Spec.CommonName}, crt.Spec.DNSNames...))
+	if policy == CommonNameSANPolicyIncludeIfAbsent {
+		for _, dnsName := range dnsNames {
+			if dnsName == commonName {
+				return removeDuplicates(dnsNames)
+			}
+		}
+	}
+	return removeDuplicates(append([]string{commonName}, dnsNames...))
+}
+
+// lowerNames returns the given names in lower case.
+func lowerNames(names []string) []string {
+	lowered := make([]string, len(names))
+	for i, name := range names {
+		lowered[i] = strings.ToLower(name)
 	}
-	return crt.Spec.DNSNames
+	return lowered
 }
 
+// IPAddressesForCertificate returns the IP addresses that should be used for
+// the given Certificate resource. Invalid IP addresses are skipped, and cause
+// GenerateCSR and GenerateTemplate to return an error.
 func IPAddressesForCertificate(crt *v1alpha1.Certificate) []net.IP {
 	var ipAddresses []net.IP
 	var ip net.IP
 	for _, ipName := range crt.Spec.IPAddresses {
-		ip = net.ParseIP(ipName)
+		ip = net.ParseIP(strings.TrimSpace(ipName))
 		if ip != nil {
 			ipAddresses = append(ipAddresses, ip)
 		}
@@ -70,6 +206,27 @@ func IPAddressesForCertificate(crt *v1alpha1.Certificate) []net.IP {
 	return ipAddresses
 }
 
+// EmailAddressesForCertificate returns the email addresses that should be
+// used for the given Certificate resource. Leading and trailing whitespace is
+// trimmed, and empty or duplicate addresses are omitted.
+func EmailAddressesForCertificate(crt *v1alpha1.Certificate) []string {
+	return removeDuplicates(trimNames(crt.Spec.EmailAddresses))
+}
+
+// URIsForCertificate returns the URIs that should be used for the given
+// Certificate resource. Invalid or relative URIs are skipped, and cause
+// GenerateCSR and GenerateTemplate to return an error.
+func URIsForCertificate(crt *v1alpha1.Certificate) []*url.URL {
+	var uris []*url.URL
+	for _, uri := range removeDuplicates(trimNames(crt.Spec.URISANs)) {
+		u, err := url.Parse(uri)
+		if err == nil && u.IsAbs() {
+			uris = append(uris, u)
+		}
+	}
+	return uris
+}
+
 func IPAddressesToString(ipAddresses []net.IP) []string {
 	var ipNames []string
 	for _, ip := range ipAddresses {
@@ -97,6 +254,9 @@ const defaultOrganization = "cert-manager"
 // OrganizationForCertificate will return the Organization to set for the
 // Certificate resource.
 // If an Organization is not specifically set, a default will be used.
+// An empty Organization is treated as unset, as it cannot be told apart once
+// the resource has been serialized; issuers that should not set a default use
+// WithoutDefaultOrganization instead.
 func OrganizationForCertificate(crt *v1alpha1.Certificate) []string {
 	if len(crt.Spec.Organization) == 0 {
 		return []string{defaultOrganization}
@@ -105,39 +265,404 @@ func OrganizationForCertificate(crt *v1alpha1.Certificate) []string {
 	return crt.Spec.Organization
 }
 
-var serialNumberLimit = new(big.Int).Lsh(big.NewInt(1), 128)
+// subjectNamesForOptions returns the common name and organization to set for
+// the Certificate resource. Unless WithoutSubjectDefaults is set, these are
+// defaulted as by CommonNameForCertificate and OrganizationForCertificate.
+// WithoutDefaultOrganization leaves only the organization undefaulted.
+func subjectNamesForOptions(crt *v1alpha1.Certificate, o *templateOptions) (string, []string) {
+	if o.noSubjectDefaults {
+		return strings.TrimSpace(crt.Spec.CommonName), crt.Spec.Organization
+	}
+	if o.noDefaultOrganization {
+		return CommonNameForCertificate(crt), crt.Spec.Organization
+	}
+	return CommonNameForCertificate(crt), OrganizationForCertificate(crt)
+}
+
+// SubjectForCertificate returns the subject to set for the Certificate
+// resource, populated from its Subject field. The common name, organization
+// and serial number are left unset for the caller.
+// Blank values are dropped, so that empty fields are left unset rather than
+// producing empty attributes.
+func SubjectForCertificate(crt *v1alpha1.Certificate) pkix.Name {
+	s := crt.Spec.Subject
+	if s == nil {
+		return pkix.Name{}
+	}
+	return pkix.Name{
+		OrganizationalUnit: trimNames(s.OrganizationalUnits),
+		Country:            trimNames(s.Countries),
+		Locality:           trimNames(s.Localities),
+		Province:           trimNames(s.Provinces),
+		StreetAddress:      trimNames(s.StreetAddresses),
+		PostalCode:         trimNames(s.PostalCodes),
+	}
+}
+
+// DurationForCertificate returns the duration of certificates issued for the
+// given Certificate resource. The Certificate's duration takes precedence,
+// followed by the issuer's default duration, and then
+// v1alpha1.DefaultCertificateDuration.
+func DurationForCertificate(issuer v1alpha1.GenericIssuer, crt *v1alpha1.Certificate) time.Duration {
+	if crt.Spec.Duration != nil {
+		return crt.Spec.Duration.Duration
+	}
+	if issuer != nil {
+		if d := issuer.GetSpec().Duration; d != nil {
+			return d.Duration
+		}
+	}
+	return v1alpha1.DefaultCertificateDuration
+}
+
+// crlDistributionPointsForOptions returns the CRL distribution points that
+// should be used for the given Certificate. Those of the Certificate take
+// precedence over any set by WithCRLDistributionPoints. An error is returned
+// if any is not an absolute URL.
+func crlDistributionPointsForOptions(crt *v1alpha1.Certificate, o *templateOptions) ([]string, error) {
+	return urlsForOptions("crl distribution point", crt.Spec.CRLDistributionPoints, o.crlDistributionPoints)
+}
+
+// authorityInfoAccessForOptions returns the OCSP servers and CA issuers URLs
+// of the authority information access extension that should be used for the
+// given Certificate, with those of the Certificate taking precedence over
+// those set by WithOCSPServers and WithIssuingCertificateURLs.
+func authorityInfoAccessForOptions(crt *v1alpha1.Certificate, o *templateOptions) ([]string, []string, error) {
+	ocspServers, err := urlsForOptions("ocsp server", crt.Spec.OCSPServers, o.ocspServers)
+	if err != nil {
+		return nil, nil, err
+	}
+	issuingCertificateURLs, err := urlsForOptions("issuing certificate url", crt.Spec.IssuingCertificateURLs, o.issuingCertificateURLs)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ocspServers, issuingCertificateURLs, nil
+}
+
+// applyMaxPathLen sets the maximum path length of the given Certificate on
+// template, if it is a CA. crypto/x509 treats a MaxPathLen of zero as unset
+// unless MaxPathLenZero is also set, so that is set to distinguish the two.
+func applyMaxPathLen(template *x509.Certificate, crt *v1alpha1.Certificate) error {
+	if !crt.Spec.IsCA || crt.Spec.MaxPathLen == nil {
+		return nil
+	}
+	maxPathLen := *crt.Spec.MaxPathLen
+	if maxPathLen < 0 {
+		return fmt.Errorf("certificate maxPathLen %d must not be negative", maxPathLen)
+	}
+	template.MaxPathLen = maxPathLen
+	template.MaxPathLenZero = maxPathLen == 0
+	return nil
+}
+
+// applyNameConstraints sets the name constraints of the given Certificate on
+// template, if it is a CA. The extension is marked critical, as RFC 5280
+// requires. An error is returned if any IP range is not valid CIDR notation.
+func applyNameConstraints(template *x509.Certificate, crt *v1alpha1.Certificate) error {
+	nc := crt.Spec.NameConstraints
+	if !crt.Spec.IsCA || nc == nil {
+		return nil
+	}
+
+	permittedIPRanges, err := parseIPRanges(nc.PermittedIPRanges)
+	if err != nil {
+		return err
+	}
+	excludedIPRanges, err := parseIPRanges(nc.ExcludedIPRanges)
+	if err != nil {
+		return err
+	}
+
+	template.PermittedDNSDomains = removeDuplicates(lowerNames(trimNames(nc.PermittedDNSDomains)))
+	template.ExcludedDNSDomains = removeDuplicates(lowerNames(trimNames(nc.ExcludedDNSDomains)))
+	template.PermittedIPRanges = permittedIPRanges
+	template.ExcludedIPRanges = excludedIPRanges
+	// this marks the whole extension critical, and it is omitted by
+	// crypto/x509 if there are no constraints
+	template.PermittedDNSDomainsCritical = true
+	return nil
+}
+
+func parseIPRanges(ranges []string) ([]*net.IPNet, error) {
+	var ipNets []*net.IPNet
+	for _, r := range ranges {
+		_, ipNet, err := net.ParseCIDR(strings.TrimSpace(r))
+		if err != nil {
+			return nil, fmt.Errorf("invalid IP range %q: must be in CIDR notation", r)
+		}
+		ipNets = append(ipNets, ipNet)
+	}
+	return ipNets, nil
+}
+
+// urlsForOptions returns specURLs, or defaultURLs if there are none, once
+// checked to be absolute URLs. nil is returned if there are neither, so that
+// no empty extension is added to the certificate.
+func urlsForOptions(kind string, specURLs, defaultURLs []string) ([]string, error) {
+	urls := defaultURLs
+	if len(specURLs) > 0 {
+		urls = specURLs
+	}
+	if len(urls) == 0 {
+		return nil, nil
+	}
+	var out []string
+	for _, raw := range urls {
+		raw = strings.TrimSpace(raw)
+		u, err := url.Parse(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q: %s", kind, raw, err.Error())
+		}
+		if !u.IsAbs() || len(u.Host) == 0 {
+			return nil, fmt.Errorf("invalid %s %q: must be an absolute url with a scheme and host", kind, raw)
+		}
+		out = append(out, raw)
+	}
+	return removeDuplicates(out), nil
+}
+
+// backdateForOptions returns the amount by which the NotBefore of
+// certificates issued for the given Certificate resource is moved into the
+// past. The Certificate's NotBeforeSkew takes precedence over that of an
+// IssuanceProfile.
+func backdateForOptions(crt *v1alpha1.Certificate, o *templateOptions) time.Duration {
+	if crt.Spec.NotBeforeSkew != nil {
+		return crt.Spec.NotBeforeSkew.Duration
+	}
+	return o.backdate
+}
+
+// validateIdentity checks that a certificate has some identity, either a
+// common name or subject alternative names, or a subject serialNumber if the
+// certificate is a device identity certificate. If WithRequireSANs is set, a
+// certificate with a common name must also have subject alternative names.
+func validateIdentity(crt *v1alpha1.Certificate, commonName string, dnsNames []string, ipAddresses []net.IP, emailAddresses []string, uris []*url.URL, o *templateOptions) error {
+	if err := validateNames(crt); err != nil {
+		return err
+	}
+	if o.requireSANs && len(commonName) > 0 && len(dnsNames) == 0 && len(ipAddresses) == 0 && len(emailAddresses) == 0 && len(uris) == 0 && len(o.directoryNameSANs) == 0 && len(o.otherNames) == 0 {
+		return fmt.Errorf("certificate with common name %q has no subject alternative names, which TLS clients require: add the common name to dnsNames", commonName)
+	}
+	if o.deviceIdentity {
+		if len(o.deviceSerialNumber) == 0 {
+			return fmt.Errorf("a subject serialNumber must be specified for a device identity certificate")
+		}
+		if crt.Spec.IsCA {
+			return fmt.Errorf("a device identity certificate must not be a CA")
+		}
+		return nil
+	}
+	if len(commonName) == 0 && len(dnsNames) == 0 && len(ipAddresses) == 0 && len(emailAddresses) == 0 && len(uris) == 0 && len(o.directoryNameSANs) == 0 && len(o.otherNames) == 0 {
+		return fmt.Errorf("no domains specified on certificate")
+	}
+	return nil
+}
+
+const (
+	// DefaultSerialNumberBits is the default length of randomly generated
+	// serial numbers.
+	DefaultSerialNumberBits = 128
+
+	// MinSerialNumberBits is the minimum length of randomly generated serial
+	// numbers, as required by the CA/Browser Forum Baseline Requirements.
+	MinSerialNumberBits = 64
+
+	// MaxSerialNumberBits is the maximum length of randomly generated serial
+	// numbers. RFC 5280 limits serial numbers to 20 octets, and they must be
+	// positive.
+	MaxSerialNumberBits = x509util.MaxSerialNumberBits
+)
+
+var serialNumberLimit = new(big.Int).Lsh(big.NewInt(1), DefaultSerialNumberBits)
+
+// MaxSerialNumberRetries is the number of times a serial number is
+// regenerated if it is reported as already used by the callback passed to
+// WithSerialNumberCollisionCheck.
+const MaxSerialNumberRetries = 10
+
+// ParseSerialNumber parses a certificate serial number, such as one assigned
+// by an external allocator. Serial numbers prefixed with "0x", or written as
+// colon separated hex octets as printed by openssl, are parsed as hex, and
+// all others as decimal. An error is returned if the serial number is
+// malformed, is not positive, or is longer than the 20 octets allowed by RFC
+// 5280.
+func ParseSerialNumber(s string) (*big.Int, error) {
+	return x509util.ParseSerialNumber(s)
+}
+
+// serialNumberForOptions returns the serial number of the given Certificate
+// if it has one, or otherwise a random serial number as configured by the
+// given options. A serial number from the Certificate cannot be regenerated,
+// so an error is returned if it has already been used.
+func serialNumberForOptions(crt *v1alpha1.Certificate, o *templateOptions) (*big.Int, error) {
+	if len(crt.Spec.SerialNumber) == 0 {
+		return generateUnusedSerialNumber(o)
+	}
+	serialNumber, err := ParseSerialNumber(crt.Spec.SerialNumber)
+	if err != nil {
+		return nil, err
+	}
+	if o.isSerialUsed != nil && o.isSerialUsed(serialNumber) {
+		return nil, fmt.Errorf("serial number %s has already been used", serialNumber)
+	}
+	return serialNumber, nil
+}
+
+// generateUnusedSerialNumber returns a random serial number as configured by
+// the given options, regenerating it if it has already been used.
+func generateUnusedSerialNumber(o *templateOptions) (*big.Int, error) {
+	for i := 0; ; i++ {
+		serialNumber, err := generateSerialNumber(o.rand, o.serialNumberBits)
+		if err != nil {
+			return nil, err
+		}
+		if o.isSerialUsed == nil || !o.isSerialUsed(serialNumber) {
+			return serialNumber, nil
+		}
+		if i == MaxSerialNumberRetries {
+			return nil, fmt.Errorf("failed to generate serial number: all %d generated serial numbers were already used", MaxSerialNumberRetries+1)
+		}
+	}
+}
+
+// generateSerialNumber returns a random serial number of up to the given
+// number of bits, read from the given source of randomness.
+// As a defensive check against a broken source of randomness, two serial
+// numbers are generated and an error is returned if either has an
+// implausible number of leading zero bits, or if they are implausibly close
+// to each other. For a working source either happens with a probability of
+// less than 2^-32.
+func generateSerialNumber(random io.Reader, bits int) (*big.Int, error) {
+	if bits < MinSerialNumberBits || bits > MaxSerialNumberBits {
+		return nil, fmt.Errorf("serial number length must be between %d and %d bits: %d", MinSerialNumberBits, MaxSerialNumberBits, bits)
+	}
+	limit := new(big.Int).Lsh(big.NewInt(1), uint(bits))
+
+	serialNumber, err := rand.Int(random, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serial number: %s", err.Error())
+	}
+	check, err := rand.Int(random, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serial number: %s", err.Error())
+	}
+
+	minBits := bits - 32
+	if serialNumber.BitLen() < minBits || check.BitLen() < minBits {
+		return nil, fmt.Errorf("failed to generate serial number: source of randomness produced too many leading zero bits")
+	}
+	if new(big.Int).Sub(serialNumber, check).BitLen() < minBits {
+		return nil, fmt.Errorf("failed to generate serial number: source of randomness produced consecutive values that are too similar")
+	}
+
+	return serialNumber, nil
+}
 
 // GenerateCSR will generate a new *x509.CertificateRequest template to be used
 // by issuers that utilise CSRs to obtain Certificates.
 // The CSR will not be signed, and should be passed to either EncodeCSR or
 // to the x509.CreateCertificateRequest function.
-func GenerateCSR(issuer v1alpha1.GenericIssuer, crt *v1alpha1.Certificate) (*x509.CertificateRequest, error) {
-	commonName := CommonNameForCertificate(crt)
-	dnsNames := DNSNamesForCertificate(crt)
+func GenerateCSR(issuer v1alpha1.GenericIssuer, crt *v1alpha1.Certificate, opts ...TemplateOption) (*x509.CertificateRequest, error) {
+	o := newTemplateOptions(opts)
+	commonName, organization := subjectNamesForOptions(crt, o)
+	dnsNames := DNSNamesForCertificateWithPolicy(crt, o.commonNameSANPolicy)
 	iPAddresses := IPAddressesForCertificate(crt)
-	organization := OrganizationForCertificate(crt)
+	emailAddresses := EmailAddressesForCertificate(crt)
+	uris := URIsForCertificate(crt)
+	if !o.verbatimSANs {
+		dnsNames, iPAddresses, emailAddresses = canonicalSANs(dnsNames, iPAddresses, emailAddresses)
+	}
+	// otherNames are encoded by subjectAltNameExtension along with the
+	// directory names from the options
+	otherNames, err := otherNamesForCertificate(crt)
+	if err != nil {
+		return nil, err
+	}
+	o.otherNames = otherNames
+
+	if err := validateIdentity(crt, commonName, dnsNames, iPAddresses, emailAddresses, uris, o); err != nil {
+		return nil, err
+	}
+
+	pubKeyAlgo, sigAlgo, err := signatureAlgorithmForOptions(crt, o)
+	if err != nil {
+		return nil, err
+	}
+	override, err := signatureAlgorithmOverride(crt, o, pubKeyAlgo)
+	if err != nil {
+		return nil, err
+	}
+	if override != x509.UnknownSignatureAlgorithm {
+		sigAlgo = override
+	}
+	if err := validateSignatureAlgorithm(sigAlgo, o.allowedSignatureAlgorithms); err != nil {
+		return nil, err
+	}
+	if err := validateAlgorithmPair(sigAlgo, pubKeyAlgo); err != nil {
+		return nil, err
+	}
 
-	if len(commonName) == 0 && len(dnsNames) == 0 {
-		return nil, fmt.Errorf("no domains specified on certificate")
+	subject := SubjectForCertificate(crt)
+	subject.Organization = organization
+	subject.CommonName = commonName
+	subject.SerialNumber = o.deviceSerialNumber
+	rawSubject, err := marshalSubject(subject, o.subjectEncoding, o.subjectRDNOrder)
+	if err != nil {
+		return nil, err
 	}
 
-	pubKeyAlgo, sigAlgo, err := SignatureAlgorithm(crt)
+	keyUsage, extKeyUsages, err := keyUsagesForOptions(crt, o)
 	if err != nil {
 		return nil, err
 	}
+	if err := ValidateKeyUsageConsistency(keyUsage, crt.Spec.IsCA); err != nil {
+		return nil, err
+	}
+	keyUsageExt, err := KeyUsageExtension(keyUsage, !o.keyUsageNonCritical)
+	if err != nil {
+		return nil, err
+	}
+	extensions := []pkix.Extension{keyUsageExt}
+	if len(extKeyUsages) > 0 {
+		extKeyUsageExt, err := ExtKeyUsageExtension(extKeyUsages, nil)
+		if err != nil {
+			return nil, err
+		}
+		extensions = append(extensions, extKeyUsageExt)
+	}
+	sanTemplate := &x509.Certificate{
+		Subject:        subject,
+		RawSubject:     rawSubject,
+		DNSNames:       dnsNames,
+		IPAddresses:    iPAddresses,
+		EmailAddresses: emailAddresses,
+		URIs:           uris,
+	}
+	if subjectIsEmpty(sanTemplate) || len(o.otherNames) > 0 {
+		// crypto/x509 does not mark the SubjectAltName extension of a CSR
+		// critical, nor encode otherNames, so it is built here instead
+		sanExt, ok, err := subjectAltNameExtension(sanTemplate, o)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			extensions = append(extensions, sanExt)
+		}
+	}
 
 	return &x509.CertificateRequest{
 		Version:            3,
 		SignatureAlgorithm: sigAlgo,
 		PublicKeyAlgorithm: pubKeyAlgo,
-		Subject: pkix.Name{
-			Organization: organization,
-			CommonName:   commonName,
-		},
-		DNSNames:    dnsNames,
-		IPAddresses: iPAddresses,
-		// TODO: work out how best to handle extensions/key usages here
-		ExtraExtensions: []pkix.Extension{},
+		Subject:            subject,
+		RawSubject:         rawSubject,
+		DNSNames:           dnsNames,
+		IPAddresses:        iPAddresses,
+		EmailAddresses:     emailAddresses,
+		URIs:               uris,
+		// crypto/x509 will include these alongside the subject alternative
+		// names in the pkcs#9 extensionRequest attribute of the CSR
+		ExtraExtensions: extensions,
 	}, nil
 }
 
@@ -145,53 +670,165 @@ func GenerateCSR(issuer v1alpha1.GenericIssuer, crt *v1alpha1.Certificate) (*x50
 // This should create a Certificate template that is equivalent to the CertificateRequest
 // generated by GenerateCSR.
 // The PublicKey field must be populated by the caller.
-func GenerateTemplate(crt *v1alpha1.Certificate) (*x509.Certificate, error) {
-	commonName := CommonNameForCertificate(crt)
-	dnsNames := DNSNamesForCertificate(crt)
+func GenerateTemplate(issuer v1alpha1.GenericIssuer, crt *v1alpha1.Certificate, opts ...TemplateOption) (*x509.Certificate, error) {
+	o := newTemplateOptions(opts)
+	commonName, organization := subjectNamesForOptions(crt, o)
+	dnsNames := DNSNamesForCertificateWithPolicy(crt, o.commonNameSANPolicy)
 	ipAddresses := IPAddressesForCertificate(crt)
-	organization := OrganizationForCertificate(crt)
+	emailAddresses := EmailAddressesForCertificate(crt)
+	uris := URIsForCertificate(crt)
+	if !o.verbatimSANs {
+		dnsNames, ipAddresses, emailAddresses = canonicalSANs(dnsNames, ipAddresses, emailAddresses)
+	}
+	// otherNames are encoded by subjectAltNameExtension along with the
+	// directory names from the options
+	otherNames, err := otherNamesForCertificate(crt)
+	if err != nil {
+		return nil, err
+	}
+	o.otherNames = otherNames
 
-	if len(commonName) == 0 && len(dnsNames) == 0 {
-		return nil, fmt.Errorf("no domains specified on certificate")
+	if err := validateIdentity(crt, commonName, dnsNames, ipAddresses, emailAddresses, uris, o); err != nil {
+		return nil, err
+	}
+	if o.rejectPublicSuffixWildcards {
+		if err := ValidateNoWildcardOnPublicSuffix(crt, o.publicSuffixes); err != nil {
+			return nil, err
+		}
 	}
 
-	serialNumber, err := rand.Int(rand.Reader, serialNumberLimit)
+	keyUsage, extKeyUsages, err := keyUsagesForOptions(crt, o)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate serial number: %s", err.Error())
+		return nil, err
+	}
+	if err := ValidateKeyUsageConsistency(keyUsage, crt.Spec.IsCA); err != nil {
+		return nil, err
 	}
 
-	certDuration := v1alpha1.DefaultCertificateDuration
-	if crt.Spec.Duration != nil {
-		certDuration = crt.Spec.Duration.Duration
+	serialNumber, err := serialNumberForOptions(crt, o)
+	if err != nil {
+		return nil, err
 	}
 
-	pubKeyAlgo, _, err := SignatureAlgorithm(crt)
+	certDuration := DurationForCertificate(issuer, crt)
+	if crt.Spec.Duration == nil && o.duration > 0 {
+		certDuration = o.duration
+	}
+	// the duration is also validated by the webhook, but that may not be
+	// deployed
+	if certDuration < v1alpha1.MinimumCertificateDuration {
+		return nil, fmt.Errorf("certificate duration %s must be at least %s", certDuration, v1alpha1.MinimumCertificateDuration)
+	}
+	if o.maxValidity > 0 && certDuration > o.maxValidity {
+		klog.Warningf("Clamping duration %s of certificate %s/%s to the maximum validity of %s", certDuration, crt.Namespace, crt.Name, o.maxValidity)
+		certDuration = o.maxValidity
+	}
+	if o.publicTrust {
+		if err := WouldExceedPublicTrustLimit(certDuration, o.publicTrustMaxValidity, time.Now()); err != nil {
+			return nil, err
+		}
+	}
+	backdate := backdateForOptions(crt, o)
+	if backdate < 0 {
+		return nil, fmt.Errorf("certificate notBeforeSkew %s must not be negative", backdate)
+	}
+	crlDistributionPoints, err := crlDistributionPointsForOptions(crt, o)
+	if err != nil {
+		return nil, err
+	}
+	ocspServers, issuingCertificateURLs, err := authorityInfoAccessForOptions(crt, o)
 	if err != nil {
 		return nil, err
 	}
 
-	keyUsages := x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment
-	if crt.Spec.IsCA {
-		keyUsages |= x509.KeyUsageCertSign
+	pubKeyAlgo, _, err := signatureAlgorithmForOptions(crt, o)
+	if err != nil {
+		return nil, err
+	}
+	// unless overridden, the signature algorithm is chosen by crypto/x509
+	// based on the type of the signer's key
+	sigAlgo, err := signatureAlgorithmOverride(crt, o, pubKeyAlgo)
+	if err != nil {
+		return nil, err
+	}
+	if sigAlgo != x509.UnknownSignatureAlgorithm {
+		if err := validateSignatureAlgorithm(sigAlgo, o.allowedSignatureAlgorithms); err != nil {
+			return nil, err
+		}
 	}
 
-	return &x509.Certificate{
+	subject := SubjectForCertificate(crt)
+	subject.Organization = organization
+	subject.CommonName = commonName
+	subject.SerialNumber = o.deviceSerialNumber
+	rawSubject, err := marshalSubject(subject, o.subjectEncoding, o.subjectRDNOrder)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
 		Version:               3,
 		BasicConstraintsValid: true,
 		SerialNumber:          serialNumber,
 		PublicKeyAlgorithm:    pubKeyAlgo,
+		PublicKey:             o.publicKey,
+		SignatureAlgorithm:    sigAlgo,
 		IsCA:                  crt.Spec.IsCA,
-		Subject: pkix.Name{
-			Organization: organization,
-			CommonName:   commonName,
-		},
-		NotBefore: time.Now(),
-		NotAfter:  time.Now().Add(certDuration),
+		Subject:               subject,
+		RawSubject:            rawSubject,
+		NotBefore:             now.Add(-backdate),
+		NotAfter:              now.Add(certDuration),
 		// see http://golang.org/pkg/crypto/x509/#KeyUsage
-		KeyUsage:    keyUsages,
-		DNSNames:    dnsNames,
-		IPAddresses: ipAddresses,
-	}, nil
+		KeyUsage:       keyUsage,
+		ExtKeyUsage:    extKeyUsages,
+		DNSNames:       dnsNames,
+		IPAddresses:    ipAddresses,
+		EmailAddresses: emailAddresses,
+		URIs:           uris,
+		// left nil when there are none so that no extensions are added
+		CRLDistributionPoints: crlDistributionPoints,
+		OCSPServer:            ocspServers,
+		IssuingCertificateURL: issuingCertificateURLs,
+	}
+
+	if err := applyMaxPathLen(template, crt); err != nil {
+		return nil, err
+	}
+	if err := applyNameConstraints(template, crt); err != nil {
+		return nil, err
+	}
+	if err := applyExtensionOptions(template, o); err != nil {
+		return nil, err
+	}
+	if err := ValidateCAExtKeyUsages(template, o.caLeafUsagePolicy); err != nil {
+		if !errors.IsWarning(err) {
+			return nil, err
+		}
+		klog.Warningf("Issuing certificate %s/%s: %v", crt.Namespace, crt.Name, err)
+	}
+
+	return template, nil
+}
+
+// GenerateCSRWithKey will generate a CSR template as GenerateCSR does, but
+// for an existing public key, such as one held in an HSM. The signature
+// algorithm is chosen based on the key, rather than the KeyAlgorithm and
+// KeySize of the Certificate. If the Certificate specifies a key algorithm
+// or size that does not match the key, it is handled according to the
+// KeyAlgorithmConflictPolicy.
+func GenerateCSRWithKey(issuer v1alpha1.GenericIssuer, crt *v1alpha1.Certificate, pub crypto.PublicKey, opts ...TemplateOption) (*x509.CertificateRequest, error) {
+	return GenerateCSR(issuer, crt, append(opts, withPublicKey(pub))...)
+}
+
+// GenerateTemplateWithKey will generate a certificate template as
+// GenerateTemplate does, but for an existing public key, such as one held in
+// an HSM. The PublicKeyAlgorithm and PublicKey fields of the template are
+// set from the key, rather than the KeyAlgorithm of the Certificate. If the
+// Certificate specifies a key algorithm or size that does not match the key,
+// it is handled according to the KeyAlgorithmConflictPolicy.
+func GenerateTemplateWithKey(issuer v1alpha1.GenericIssuer, crt *v1alpha1.Certificate, pub crypto.PublicKey, opts ...TemplateOption) (*x509.Certificate, error) {
+	return GenerateTemplate(issuer, crt, append(opts, withPublicKey(pub))...)
 }
 
 // SignCertificate returns a signed x509.Certificate object for the given
@@ -200,20 +837,81 @@ func GenerateTemplate(crt *v1alpha1.Certificate) (*x509.Certificate, error) {
 // key of the signer.
 // It returns a PEM encoded copy of the Certificate as well as a *x509.Certificate
 // which can be used for reading the encoded values.
-func SignCertificate(template *x509.Certificate, issuerCert *x509.Certificate, publicKey crypto.PublicKey, signerKey interface{}) ([]byte, *x509.Certificate, error) {
+// If the issuer certificate constrains its extended key usages, an error is
+// returned if template requests any extended key usage the issuer does not
+// permit.
+// If template does not have a SubjectKeyId set, one is computed from
+// publicKey.
+// If template would be valid before issuerCert, its NotBefore is clamped to
+// that of issuerCert unless NotBeforePolicyError is set.
+func SignCertificate(template *x509.Certificate, issuerCert *x509.Certificate, publicKey crypto.PublicKey, signerKey interface{}, opts ...SignOption) ([]byte, *x509.Certificate, error) {
+	o := newSignOptions(opts)
+
+	// copy the template so that the caller's template is not modified.
+	// A self signed certificate must remain its own parent so that the
+	// authority key identifier matches the subject key identifier.
+	selfSigned := template == issuerCert
+	t := *template
+	template = &t
+	if selfSigned {
+		issuerCert = template
+	}
+
+	if len(template.SubjectKeyId) == 0 {
+		ski, err := SubjectKeyId(publicKey, o.subjectKeyIdMethod)
+		if err != nil {
+			return nil, nil, err
+		}
+		template.SubjectKeyId = ski
+	}
+
+	if !selfSigned {
+		// self signed certificates have no issuer to delegate usages from
+		if err := validateExtKeyUsageDelegation(template, issuerCert); err != nil {
+			return nil, nil, err
+		}
+		if template.NotBefore.Before(issuerCert.NotBefore) {
+			if o.notBeforePolicy == NotBeforePolicyError {
+				return nil, nil, fmt.Errorf("certificate would be valid from %s, before its issuer is valid from %s",
+					template.NotBefore.UTC().Format(time.RFC3339), issuerCert.NotBefore.UTC().Format(time.RFC3339))
+			}
+			template.NotBefore = issuerCert.NotBefore
+		}
+	}
+
 	derBytes, err := x509.CreateCertificate(rand.Reader, template, issuerCert, publicKey, signerKey)
 
 	if err != nil {
 		return nil, nil, fmt.Errorf("error creating x509 certificate: %s", err.Error())
 	}
+	if o.maxCertificateSize > 0 && len(derBytes) > o.maxCertificateSize {
+		return nil, nil, fmt.Errorf("signed certificate is %d bytes, which exceeds the maximum size of %d bytes", len(derBytes), o.maxCertificateSize)
+	}
 
 	cert, err := x509.ParseCertificate(derBytes)
 	if err != nil {
 		return nil, nil, fmt.Errorf("error decoding DER certificate bytes: %s", err.Error())
 	}
 
+	if curve := lowSCurveForSigner(signerKey); o.lowSSignature && curve != nil {
+		cert, err = normalizeLowSSignature(cert, curve)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if err := ValidateEd25519Encoding(cert); err != nil {
+		return nil, nil, err
+	}
+
+	if o.verifyIssuer {
+		if err := verifyIssuerSignature(cert, template, issuerCert); err != nil {
+			return nil, nil, err
+		}
+	}
+
 	pemBytes := bytes.NewBuffer([]byte{})
-	err = pem.Encode(pemBytes, &pem.Block{Type: "CERTIFICATE", Bytes: derBytes})
+	err = pem.Encode(pemBytes, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
 	if err != nil {
 		return nil, nil, fmt.Errorf("error encoding certificate PEM: %s", err.Error())
 	}
@@ -221,6 +919,62 @@ func SignCertificate(template *x509.Certificate, issuerCert *x509.Certificate, p
 	return pemBytes.Bytes(), cert, err
 }
 
+// SignCertificateWithChain returns a signed x509.Certificate object for the
+// given template, signed by the first certificate in issuerChain.
+// It returns a PEM encoded bundle containing the signed Certificate followed by
+// the intermediate certificates in issuerChain. Self signed certificates in
+// the chain are not included in the bundle.
+func SignCertificateWithChain(template *x509.Certificate, issuerChain []*x509.Certificate, publicKey crypto.PublicKey, signerKey interface{}, opts ...SignOption) ([]byte, *x509.Certificate, error) {
+	if len(issuerChain) == 0 {
+		return nil, nil, fmt.Errorf("no issuer certificates provided")
+	}
+
+	o := newSignOptions(opts)
+	if o.maxIntermediates != nil && *o.maxIntermediates < 0 {
+		return nil, nil, fmt.Errorf("maximum number of intermediates must not be negative: %d", *o.maxIntermediates)
+	}
+
+	certPem, cert, err := SignCertificate(template, issuerChain[0], publicKey, signerKey, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var intermediates []*x509.Certificate
+	for _, c := range issuerChain {
+		if bytes.Equal(c.RawIssuer, c.RawSubject) {
+			continue
+		}
+		intermediates = append(intermediates, c)
+	}
+	if o.maxIntermediates != nil && len(intermediates) > *o.maxIntermediates {
+		intermediates = intermediates[:*o.maxIntermediates]
+	}
+
+	chainPem, err := EncodeX509Chain(intermediates)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error encoding certificate chain PEM: %s", err.Error())
+	}
+
+	return append(certPem, chainPem...), cert, nil
+}
+
+// verifyIssuerSignature checks the signature on cert was made by the key of
+// issuerCert. If the certificate is self signed (i.e. template and issuerCert
+// are the same), the signature is checked against the certificate's own
+// public key instead, as the template will not usually have one set.
+func verifyIssuerSignature(cert, template, issuerCert *x509.Certificate) error {
+	var err error
+	if template == issuerCert {
+		err = cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature)
+	} else {
+		err = cert.CheckSignatureFrom(issuerCert)
+	}
+	if err != nil {
+		return fmt.Errorf("signed certificate failed verification against issuer: %s", err.Error())
+	}
+	return nil
+}
+
 // EncodeCSR calls x509.CreateCertificateRequest to sign the given CSR template.
 // It returns a DER encoded signed CSR.
 func EncodeCSR(template *x509.CertificateRequest, key crypto.Signer) ([]byte, error) {
@@ -244,6 +998,8 @@ func EncodeX509(cert *x509.Certificate) ([]byte, error) {
 }
 
 // EncodeX509Chain will encode an *x509.Certificate chain into PEM format.
+// Self signed certificates are not included; use EncodeX509ChainVerbatim to
+// include them.
 func EncodeX509Chain(certs []*x509.Certificate) ([]byte, error) {
 	caPem := bytes.NewBuffer([]byte{})
 	for _, cert := range certs {
@@ -260,6 +1016,187 @@ func EncodeX509Chain(certs []*x509.Certificate) ([]byte, error) {
 	return caPem.Bytes(), nil
 }
 
+// EncodeX509ChainVerbatim will encode the given certificates into PEM format
+// exactly as given, in order, including any self signed root, so that callers
+// control the format of the bundle. Use OrderCertificateChain to sort
+// certificates from leaf to root first; a leaf-only or root-first bundle can
+// be produced by slicing or reversing the result.
+func EncodeX509ChainVerbatim(certs []*x509.Certificate) ([]byte, error) {
+	caPem := bytes.NewBuffer([]byte{})
+	for _, cert := range certs {
+		err := pem.Encode(caPem, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return caPem.Bytes(), nil
+}
+
+// signatureAlgorithmKeyTypes maps each signature algorithm to the type of key
+// that produces it.
+var signatureAlgorithmKeyTypes = map[x509.SignatureAlgorithm]x509.PublicKeyAlgorithm{
+	x509.MD2WithRSA:       x509.RSA,
+	x509.MD5WithRSA:       x509.RSA,
+	x509.SHA1WithRSA:      x509.RSA,
+	x509.SHA256WithRSA:    x509.RSA,
+	x509.SHA384WithRSA:    x509.RSA,
+	x509.SHA512WithRSA:    x509.RSA,
+	x509.SHA256WithRSAPSS: x509.RSA,
+	x509.SHA384WithRSAPSS: x509.RSA,
+	x509.SHA512WithRSAPSS: x509.RSA,
+	x509.DSAWithSHA1:      x509.DSA,
+	x509.DSAWithSHA256:    x509.DSA,
+	x509.ECDSAWithSHA1:    x509.ECDSA,
+	x509.ECDSAWithSHA256:  x509.ECDSA,
+	x509.ECDSAWithSHA384:  x509.ECDSA,
+	x509.ECDSAWithSHA512:  x509.ECDSA,
+	x509.PureEd25519:      x509.Ed25519,
+}
+
+// ValidateTemplateAlgorithms returns an error if the signature algorithm of
+// the given template cannot be produced by a key of the template's public
+// key algorithm.
+// This only applies to templates that will be signed by their own key, i.e.
+// self signed certificates, as the signature algorithm of a certificate
+// signed by an issuer is determined by the issuer's key. If either algorithm
+// is unset, the template is not checked.
+func ValidateTemplateAlgorithms(tmpl *x509.Certificate) error {
+	return validateAlgorithmPair(tmpl.SignatureAlgorithm, tmpl.PublicKeyAlgorithm)
+}
+
+func validateAlgorithmPair(sigAlgo x509.SignatureAlgorithm, pubKeyAlgo x509.PublicKeyAlgorithm) error {
+	if sigAlgo == x509.UnknownSignatureAlgorithm || pubKeyAlgo == x509.UnknownPublicKeyAlgorithm {
+		return nil
+	}
+	keyType, ok := signatureAlgorithmKeyTypes[sigAlgo]
+	if !ok {
+		return fmt.Errorf("unsupported signature algorithm: %s", sigAlgo)
+	}
+	if keyType != pubKeyAlgo {
+		return fmt.Errorf("signature algorithm %s requires a %s key, but the public key algorithm is %s", sigAlgo, keyType, pubKeyAlgo)
+	}
+	return nil
+}
+
+// KeyAlgorithmConflictPolicy determines how a conflict between the key
+// algorithm or size of a Certificate and an existing key is handled.
+type KeyAlgorithmConflictPolicy int
+
+const (
+	// KeyAlgorithmConflictError returns an error naming both the algorithm
+	// of the Certificate and that of the key.
+	KeyAlgorithmConflictError KeyAlgorithmConflictPolicy = iota
+
+	// KeyAlgorithmConflictUseKey trusts the key, using its algorithm and
+	// logging a warning.
+	KeyAlgorithmConflictUseKey
+)
+
+// signatureAlgorithmOverride returns the signature algorithm given on the
+// Certificate, or otherwise that set by WithSignatureAlgorithm, or
+// x509.UnknownSignatureAlgorithm if neither is set. An error is returned if
+// the Certificate names an unsupported signature algorithm, or one that
+// cannot be produced by a key of the given public key algorithm.
+func signatureAlgorithmOverride(crt *v1alpha1.Certificate, o *templateOptions, pubKeyAlgo x509.PublicKeyAlgorithm) (x509.SignatureAlgorithm, error) {
+	if len(crt.Spec.SignatureAlgorithm) == 0 {
+		return o.signatureAlgorithm, nil
+	}
+	sigAlgo, err := ParseSignatureAlgorithm(crt.Spec.SignatureAlgorithm)
+	if err != nil {
+		return x509.UnknownSignatureAlgorithm, err
+	}
+	if err := validateAlgorithmPair(sigAlgo, pubKeyAlgo); err != nil {
+		return x509.UnknownSignatureAlgorithm, err
+	}
+	return sigAlgo, nil
+}
+
+// signatureAlgorithmForOptions returns the public key and signature
+// algorithms for the given Certificate, or for the existing public key if
+// one is set in the options.
+func signatureAlgorithmForOptions(crt *v1alpha1.Certificate, o *templateOptions) (x509.PublicKeyAlgorithm, x509.SignatureAlgorithm, error) {
+	if o.publicKey == nil {
+		return SignatureAlgorithm(crt)
+	}
+
+	pubKeyAlgo, sigAlgo, err := SignatureAlgorithmForKey(o.publicKey)
+	if err != nil {
+		return x509.UnknownPublicKeyAlgorithm, x509.UnknownSignatureAlgorithm, err
+	}
+	if err := checkKeyAlgorithmConflict(crt, o.publicKey, pubKeyAlgo); err != nil {
+		if o.keyAlgorithmConflictPolicy != KeyAlgorithmConflictUseKey {
+			return x509.UnknownPublicKeyAlgorithm, x509.UnknownSignatureAlgorithm, err
+		}
+		klog.Warningf("Using key algorithm of existing key for certificate %s/%s: %v", crt.Namespace, crt.Name, err)
+	}
+	return pubKeyAlgo, sigAlgo, nil
+}
+
+// checkKeyAlgorithmConflict returns an error if the Certificate specifies a
+// key algorithm or size that does not match the given public key.
+// A Certificate that does not specify a key algorithm never conflicts.
+func checkKeyAlgorithmConflict(crt *v1alpha1.Certificate, pub crypto.PublicKey, pubKeyAlgo x509.PublicKeyAlgorithm) error {
+	if crt.Spec.KeyAlgorithm == "" {
+		return nil
+	}
+	specAlgo, _, err := SignatureAlgorithm(crt)
+	if err != nil {
+		return err
+	}
+	if specAlgo != pubKeyAlgo {
+		return fmt.Errorf("certificate specifies key algorithm %q, but the key is a %s key", crt.Spec.KeyAlgorithm, pubKeyAlgo)
+	}
+	if crt.Spec.KeySize == 0 || pubKeyAlgo == x509.Ed25519 {
+		return nil
+	}
+	keySize := 0
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		keySize = pub.N.BitLen()
+	case *ecdsa.PublicKey:
+		keySize = pub.Curve.Params().BitSize
+	}
+	if keySize != crt.Spec.KeySize {
+		return fmt.Errorf("certificate specifies a %s key size of %d, but the key size is %d", crt.Spec.KeyAlgorithm, crt.Spec.KeySize, keySize)
+	}
+	return nil
+}
+
+// SignatureAlgorithmForKey will determine the appropriate public key and
+// signature algorithms for the given public key, using the same rules as
+// SignatureAlgorithm.
+func SignatureAlgorithmForKey(pub crypto.PublicKey) (x509.PublicKeyAlgorithm, x509.SignatureAlgorithm, error) {
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		switch size := pub.N.BitLen(); {
+		case size >= 4096:
+			return x509.RSA, x509.SHA512WithRSA, nil
+		case size >= 3072:
+			return x509.RSA, x509.SHA384WithRSA, nil
+		case size >= MinRSAKeySize:
+			return x509.RSA, x509.SHA256WithRSA, nil
+		default:
+			return x509.UnknownPublicKeyAlgorithm, x509.UnknownSignatureAlgorithm, fmt.Errorf("unsupported rsa keysize: %d. min keysize %d", size, MinRSAKeySize)
+		}
+	case *ecdsa.PublicKey:
+		switch pub.Curve {
+		case elliptic.P521():
+			return x509.ECDSA, x509.ECDSAWithSHA512, nil
+		case elliptic.P384():
+			return x509.ECDSA, x509.ECDSAWithSHA384, nil
+		case elliptic.P256():
+			return x509.ECDSA, x509.ECDSAWithSHA256, nil
+		default:
+			return x509.UnknownPublicKeyAlgorithm, x509.UnknownSignatureAlgorithm, fmt.Errorf("unsupported ecdsa curve: %s", pub.Curve.Params().Name)
+		}
+	case ed25519.PublicKey:
+		return x509.Ed25519, x509.PureEd25519, nil
+	default:
+		return x509.UnknownPublicKeyAlgorithm, x509.UnknownSignatureAlgorithm, fmt.Errorf("unsupported public key type: %T", pub)
+	}
+}
+
 // SignatureAlgorithm will determine the appropriate signature algorithm for
 // the given certificate.
 // Adapted from https://github.com/cloudflare/cfssl/blob/master/csr/csr.go#L102
@@ -267,24 +1204,27 @@ func SignatureAlgorithm(crt *v1alpha1.Certificate) (x509.PublicKeyAlgorithm, x50
 	var sigAlgo x509.SignatureAlgorithm
 	var pubKeyAlgo x509.PublicKeyAlgorithm
 	switch crt.Spec.KeyAlgorithm {
-	case v1alpha1.KeyAlgorithm(""):
-		// If keyAlgorithm is not specified, we default to rsa with keysize 2048
-		pubKeyAlgo = x509.RSA
-		sigAlgo = x509.SHA256WithRSA
-	case v1alpha1.RSAKeyAlgorithm:
+	// If keyAlgorithm is not specified, we default to rsa
+	case v1alpha1.KeyAlgorithm(""), v1alpha1.RSAKeyAlgorithm:
 		pubKeyAlgo = x509.RSA
+		keySize := crt.Spec.KeySize
+		// 0 == not set
+		if keySize == 0 {
+			keySize = MinRSAKeySize
+		}
+		if keySize < MinRSAKeySize {
+			return x509.UnknownPublicKeyAlgorithm, x509.UnknownSignatureAlgorithm, fmt.Errorf("unsupported rsa keysize specified: %d. min keysize %d", crt.Spec.KeySize, MinRSAKeySize)
+		}
+		if keySize > MaxRSAKeySize {
+			return x509.UnknownPublicKeyAlgorithm, x509.UnknownSignatureAlgorithm, fmt.Errorf("unsupported rsa keysize specified: %d. max keysize %d", crt.Spec.KeySize, MaxRSAKeySize)
+		}
 		switch {
-		case crt.Spec.KeySize >= 4096:
+		case keySize >= 4096:
 			sigAlgo = x509.SHA512WithRSA
-		case crt.Spec.KeySize >= 3072:
+		case keySize >= 3072:
 			sigAlgo = x509.SHA384WithRSA
-		case crt.Spec.KeySize >= 2048:
-			sigAlgo = x509.SHA256WithRSA
-		// 0 == not set
-		case crt.Spec.KeySize == 0:
-			sigAlgo = x509.SHA256WithRSA
 		default:
-			return x509.UnknownPublicKeyAlgorithm, x509.UnknownSignatureAlgorithm, fmt.Errorf("unsupported rsa keysize specified: %d. min keysize %d", crt.Spec.KeySize, MinRSAKeySize)
+			sigAlgo = x509.SHA256WithRSA
 		}
 	case v1alpha1.ECDSAKeyAlgorithm:
 		pubKeyAlgo = x509.ECDSA
@@ -300,8 +1240,12 @@ func SignatureAlgorithm(crt *v1alpha1.Certificate) (x509.PublicKeyAlgorithm, x50
 		default:
 			return x509.UnknownPublicKeyAlgorithm, x509.UnknownSignatureAlgorithm, fmt.Errorf("unsupported ecdsa keysize specified: %d", crt.Spec.KeySize)
 		}
+	case v1alpha1.Ed25519KeyAlgorithm:
+		// Ed25519 keys have a fixed size, so KeySize is ignored
+		pubKeyAlgo = x509.Ed25519
+		sigAlgo = x509.PureEd25519
 	default:
-		return x509.UnknownPublicKeyAlgorithm, x509.UnknownSignatureAlgorithm, fmt.Errorf("unsupported algorithm specified: %s. should be either 'ecdsa' or 'rsa", crt.Spec.KeyAlgorithm)
+		return x509.UnknownPublicKeyAlgorithm, x509.UnknownSignatureAlgorithm, fmt.Errorf("unsupported algorithm specified: %s. should be one of 'rsa', 'ecdsa' or 'ed25519'", crt.Spec.KeyAlgorithm)
 	}
 	return pubKeyAlgo, sigAlgo, nil
 }
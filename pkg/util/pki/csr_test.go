@@ -17,8 +17,22 @@ limitations under the License.
 package pki
 
 import (
+	"bytes"
+	"crypto"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/url"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"github.com/jetstack/cert-manager/pkg/apis/certmanager/v1alpha1"
 	"github.com/jetstack/cert-manager/pkg/util"
@@ -62,6 +76,16 @@ func TestCommonNameForCertificate(t *testing.T) {
 			crtDNSNames: []string{"dnsname1", "dnsname2"},
 			expectedCN:  "dnsname1",
 		},
+		{
+			name:       "certificate with padded common name",
+			crtCN:      " cn\t",
+			expectedCN: "cn",
+		},
+		{
+			name:        "certificate with padded dns names and no common name",
+			crtDNSNames: []string{"  ", " dnsname1 "},
+			expectedCN:  "dnsname1",
+		},
 	}
 	testFn := func(test testT) func(*testing.T) {
 		return func(t *testing.T) {
@@ -118,6 +142,23 @@ func TestDNSNamesForCertificate(t *testing.T) {
 			crtDNSNames:    []string{"dnsname", "cn"},
 			expectDNSNames: []string{"cn", "dnsname"},
 		},
+		{
+			name:           "certificate with padded names collapsing to the same name",
+			crtCN:          "cn ",
+			crtDNSNames:    []string{" cn", "dnsname\n"},
+			expectDNSNames: []string{"cn", "dnsname"},
+		},
+		{
+			name:           "certificate with mixed case names collapsing to the same name",
+			crtCN:          "Example.com",
+			crtDNSNames:    []string{"example.com", "EXAMPLE.COM", "www.Example.com"},
+			expectDNSNames: []string{"example.com", "www.example.com"},
+		},
+		{
+			name:           "certificate with mixed case dns names only",
+			crtDNSNames:    []string{"Example.com", "example.COM"},
+			expectDNSNames: []string{"example.com"},
+		},
 	}
 	testFn := func(test testT) func(*testing.T) {
 		return func(t *testing.T) {
@@ -168,6 +209,13 @@ func TestSignatureAlgorithmForCertificate(t *testing.T) {
 			expectedSigAlgo: x509.SHA256WithRSA,
 			expectedKeyType: x509.RSA,
 		},
+		{
+			name:            "certificate with KeyAlgorithm not set and size 4096",
+			keyAlgo:         v1alpha1.KeyAlgorithm(""),
+			keySize:         4096,
+			expectedSigAlgo: x509.SHA512WithRSA,
+			expectedKeyType: x509.RSA,
+		},
 		{
 			name:            "certificate with KeyAlgorithm rsa and size 2048",
 			keyAlgo:         v1alpha1.RSAKeyAlgorithm,
@@ -189,6 +237,37 @@ func TestSignatureAlgorithmForCertificate(t *testing.T) {
 			expectedSigAlgo: x509.SHA512WithRSA,
 			expectedKeyType: x509.RSA,
 		},
+		{
+			name:      "certificate with KeyAlgorithm rsa and non-standard size 2047",
+			keyAlgo:   v1alpha1.RSAKeyAlgorithm,
+			keySize:   2047,
+			expectErr: true,
+		},
+		{
+			name:      "certificate with KeyAlgorithm rsa and negative size",
+			keyAlgo:   v1alpha1.RSAKeyAlgorithm,
+			keySize:   -2048,
+			expectErr: true,
+		},
+		{
+			name:            "certificate with KeyAlgorithm rsa and the maximum size",
+			keyAlgo:         v1alpha1.RSAKeyAlgorithm,
+			keySize:         MaxRSAKeySize,
+			expectedSigAlgo: x509.SHA512WithRSA,
+			expectedKeyType: x509.RSA,
+		},
+		{
+			name:      "certificate with KeyAlgorithm rsa and size above the maximum",
+			keyAlgo:   v1alpha1.RSAKeyAlgorithm,
+			keySize:   MaxRSAKeySize + 1,
+			expectErr: true,
+		},
+		{
+			name:      "certificate with KeyAlgorithm rsa and size 16384",
+			keyAlgo:   v1alpha1.RSAKeyAlgorithm,
+			keySize:   16384,
+			expectErr: true,
+		},
 		{
 			name:            "certificate with ecdsa key algorithm set and no key size default to ecdsa256",
 			keyAlgo:         v1alpha1.ECDSAKeyAlgorithm,
@@ -222,6 +301,19 @@ func TestSignatureAlgorithmForCertificate(t *testing.T) {
 			keySize:   100,
 			expectErr: true,
 		},
+		{
+			name:            "certificate with KeyAlgorithm ed25519",
+			keyAlgo:         v1alpha1.Ed25519KeyAlgorithm,
+			expectedSigAlgo: x509.PureEd25519,
+			expectedKeyType: x509.Ed25519,
+		},
+		{
+			name:            "certificate with KeyAlgorithm ed25519 ignores size",
+			keyAlgo:         v1alpha1.Ed25519KeyAlgorithm,
+			keySize:         4096,
+			expectedSigAlgo: x509.PureEd25519,
+			expectedKeyType: x509.Ed25519,
+		},
 		{
 			name:      "certificate with KeyAlgorithm set to unknown key algo",
 			keyAlgo:   v1alpha1.KeyAlgorithm("blah"),
@@ -293,3 +385,1643 @@ func TestRemoveDuplicates(t *testing.T) {
 		}
 	}
 }
+
+func TestSignCertificateIssuerVerification(t *testing.T) {
+	caKey, err := GenerateECPrivateKey(ECCurve256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := GenerateECPrivateKey(ECCurve256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafKey, err := GenerateECPrivateKey(ECCurve256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	caCrt := buildCertificate("ca")
+	caCrt.Spec.IsCA = true
+	caTemplate, err := GenerateTemplate(nil, caCrt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, caCert, err := SignCertificate(caTemplate, caTemplate, caKey.Public(), caKey, WithIssuerVerification())
+	if err != nil {
+		t.Fatalf("expected self signed CA to verify, but got: %v", err)
+	}
+
+	leafTemplate, err := GenerateTemplate(nil, buildCertificate("leaf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := SignCertificate(leafTemplate, caCert, leafKey.Public(), caKey, WithIssuerVerification()); err != nil {
+		t.Errorf("expected leaf to verify against issuer, but got: %v", err)
+	}
+
+	// the issuer template has no public key set, so crypto/x509 is unable to
+	// detect that the signer does not belong to it
+	if _, _, err := SignCertificate(leafTemplate, caTemplate, leafKey.Public(), otherKey); err != nil {
+		t.Errorf("expected no error without issuer verification, but got: %v", err)
+	}
+	if _, _, err := SignCertificate(leafTemplate, caTemplate, leafKey.Public(), otherKey, WithIssuerVerification()); err == nil {
+		t.Errorf("expected mismatched signer to fail issuer verification")
+	}
+
+	// a self signed certificate whose signer does not match its public key
+	if _, _, err := SignCertificate(leafTemplate, leafTemplate, leafKey.Public(), otherKey, WithIssuerVerification()); err == nil {
+		t.Errorf("expected mismatched self signed signer to fail issuer verification")
+	}
+}
+
+func TestGenerateIPAddressOnlyCertificate(t *testing.T) {
+	crt := &v1alpha1.Certificate{
+		Spec: v1alpha1.CertificateSpec{
+			IPAddresses: []string{"10.0.0.1", "::1"},
+		},
+	}
+
+	pk, err := GenerateECPrivateKey(ECCurve256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template, err := GenerateTemplate(nil, crt)
+	if err != nil {
+		t.Fatalf("expected ip address only template to be generated, but got: %v", err)
+	}
+	_, cert, err := SignCertificate(template, template, pk.Public(), pk)
+	if err != nil {
+		t.Fatalf("error signing certificate: %v", err)
+	}
+	if len(cert.DNSNames) != 0 {
+		t.Errorf("expected no dns names but got %q", cert.DNSNames)
+	}
+	if !util.EqualUnsorted(IPAddressesToString(cert.IPAddresses), []string{"10.0.0.1", "::1"}) {
+		t.Errorf("unexpected ip addresses on certificate: %q", IPAddressesToString(cert.IPAddresses))
+	}
+
+	if _, err := GenerateCSR(nil, crt); err != nil {
+		t.Errorf("expected ip address only csr to be generated, but got: %v", err)
+	}
+
+	if _, err := GenerateTemplate(nil, &v1alpha1.Certificate{}); err == nil {
+		t.Errorf("expected error generating template with no identity")
+	}
+	if _, err := GenerateCSR(nil, &v1alpha1.Certificate{}); err == nil {
+		t.Errorf("expected error generating csr with no identity")
+	}
+	invalid := crt.DeepCopy()
+	invalid.Spec.IPAddresses = append(invalid.Spec.IPAddresses, "10.0.0.256")
+	if _, err := GenerateTemplate(nil, invalid); err == nil || !strings.Contains(err.Error(), "10.0.0.256") {
+		t.Errorf("expected error naming the invalid ip address generating template, but got: %v", err)
+	}
+	if _, err := GenerateCSR(nil, invalid); err == nil || !strings.Contains(err.Error(), "10.0.0.256") {
+		t.Errorf("expected error naming the invalid ip address generating csr, but got: %v", err)
+	}
+}
+
+func TestGenerateEmailAddressOnlyCertificate(t *testing.T) {
+	crt := &v1alpha1.Certificate{
+		Spec: v1alpha1.CertificateSpec{
+			EmailAddresses: []string{"alice@example.com", " bob@example.com ", "alice@example.com"},
+		},
+	}
+	expected := []string{"alice@example.com", "bob@example.com"}
+
+	pk, err := GenerateECPrivateKey(ECCurve256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template, err := GenerateTemplate(nil, crt)
+	if err != nil {
+		t.Fatalf("expected email address only template to be generated, but got: %v", err)
+	}
+	_, cert, err := SignCertificate(template, template, pk.Public(), pk)
+	if err != nil {
+		t.Fatalf("error signing certificate: %v", err)
+	}
+	if !reflect.DeepEqual(cert.EmailAddresses, expected) {
+		t.Errorf("expected email addresses %q on certificate but got %q", expected, cert.EmailAddresses)
+	}
+
+	csr, err := GenerateCSR(nil, crt)
+	if err != nil {
+		t.Fatalf("expected email address only csr to be generated, but got: %v", err)
+	}
+	if !reflect.DeepEqual(csr.EmailAddresses, expected) {
+		t.Errorf("expected email addresses %q on csr but got %q", expected, csr.EmailAddresses)
+	}
+
+	invalid := crt.DeepCopy()
+	invalid.Spec.EmailAddresses = append(invalid.Spec.EmailAddresses, "carol", "example.org")
+	for _, err := range []error{
+		func() error { _, err := GenerateTemplate(nil, invalid); return err }(),
+		func() error { _, err := GenerateCSR(nil, invalid); return err }(),
+	} {
+		if err == nil || !strings.Contains(err.Error(), `"carol", "example.org"`) {
+			t.Errorf("expected error listing the malformed email addresses, but got: %v", err)
+		}
+	}
+}
+
+func TestGenerateURIOnlyCertificate(t *testing.T) {
+	crt := &v1alpha1.Certificate{
+		Spec: v1alpha1.CertificateSpec{
+			URISANs: []string{"spiffe://cluster.local/ns/default/sa/example"},
+		},
+	}
+	expected := []string{"spiffe://cluster.local/ns/default/sa/example"}
+	uriStrings := func(uris []*url.URL) []string {
+		var out []string
+		for _, u := range uris {
+			out = append(out, u.String())
+		}
+		return out
+	}
+
+	pk, err := GenerateECPrivateKey(ECCurve256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template, err := GenerateTemplate(nil, crt)
+	if err != nil {
+		t.Fatalf("expected uri only template to be generated, but got: %v", err)
+	}
+	_, cert, err := SignCertificate(template, template, pk.Public(), pk)
+	if err != nil {
+		t.Fatalf("error signing certificate: %v", err)
+	}
+	if !reflect.DeepEqual(uriStrings(cert.URIs), expected) {
+		t.Errorf("expected uris %q on certificate but got %q", expected, uriStrings(cert.URIs))
+	}
+
+	csr, err := GenerateCSR(nil, crt)
+	if err != nil {
+		t.Fatalf("expected uri only csr to be generated, but got: %v", err)
+	}
+	if !reflect.DeepEqual(uriStrings(csr.URIs), expected) {
+		t.Errorf("expected uris %q on csr but got %q", expected, uriStrings(csr.URIs))
+	}
+
+	for _, uri := range []string{"workload", "/ns/default", "spiffe://%zz"} {
+		invalid := crt.DeepCopy()
+		invalid.Spec.URISANs = append(invalid.Spec.URISANs, uri)
+		if _, err := GenerateTemplate(nil, invalid); err == nil || !strings.Contains(err.Error(), uri) {
+			t.Errorf("expected error naming the invalid uri %q generating template, but got: %v", uri, err)
+		}
+		if _, err := GenerateCSR(nil, invalid); err == nil || !strings.Contains(err.Error(), uri) {
+			t.Errorf("expected error naming the invalid uri %q generating csr, but got: %v", uri, err)
+		}
+	}
+}
+
+// signTestOptions are the options of signTestCertificate.
+type signTestOptions struct {
+	key          crypto.Signer
+	templateOpts []TemplateOption
+}
+
+type signTestOption func(*signTestOptions)
+
+// withSignTestKey sets the key of the signed certificate, rather than
+// generating a P-256 key.
+func withSignTestKey(key crypto.Signer) signTestOption {
+	return func(o *signTestOptions) {
+		o.key = key
+	}
+}
+
+// withSignTestTemplateOptions sets the options used to generate the template
+// of the signed certificate.
+func withSignTestTemplateOptions(opts ...TemplateOption) signTestOption {
+	return func(o *signTestOptions) {
+		o.templateOpts = append(o.templateOpts, opts...)
+	}
+}
+
+// signTestCertificate will sign a certificate for the given Certificate spec
+// using the given issuer certificate and key. If issuerCert is nil, the
+// certificate will be self signed. The certificate's key is returned.
+func signTestCertificate(t *testing.T, crt *v1alpha1.Certificate, issuerCert *x509.Certificate, issuerKey crypto.Signer, opts ...signTestOption) (*x509.Certificate, crypto.Signer) {
+	o := &signTestOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	pk := o.key
+	if pk == nil {
+		var err error
+		pk, err = GenerateECPrivateKey(ECCurve256)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	template, err := GenerateTemplate(nil, crt, o.templateOpts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if issuerCert == nil {
+		issuerCert, issuerKey = template, pk
+	}
+	_, cert, err := SignCertificate(template, issuerCert, pk.Public(), issuerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, pk
+}
+
+func buildCACertificate(cn string) *v1alpha1.Certificate {
+	crt := buildCertificate(cn)
+	crt.Spec.IsCA = true
+	return crt
+}
+
+func TestSignCertificateWithChainMaxIntermediates(t *testing.T) {
+	root, rootKey := signTestCertificate(t, buildCACertificate("root"), nil, nil)
+	int1, int1Key := signTestCertificate(t, buildCACertificate("intermediate-1"), root, rootKey)
+	int2, int2Key := signTestCertificate(t, buildCACertificate("intermediate-2"), int1, int1Key)
+	issuerChain := []*x509.Certificate{int2, int1, root}
+
+	leafKey, err := GenerateECPrivateKey(ECCurve256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template, err := GenerateTemplate(nil, buildCertificate("leaf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type testT struct {
+		name          string
+		opts          []SignOption
+		expectErr     bool
+		expectSubject []string
+	}
+	tests := []testT{
+		{
+			name:          "no limit includes all intermediates",
+			expectSubject: []string{"leaf", "intermediate-2", "intermediate-1"},
+		},
+		{
+			name:          "limit of one includes only the issuing intermediate",
+			opts:          []SignOption{WithMaxIntermediates(1)},
+			expectSubject: []string{"leaf", "intermediate-2"},
+		},
+		{
+			name:          "limit of zero includes only the leaf",
+			opts:          []SignOption{WithMaxIntermediates(0)},
+			expectSubject: []string{"leaf"},
+		},
+		{
+			name:          "limit larger than the chain includes all intermediates",
+			opts:          []SignOption{WithMaxIntermediates(5)},
+			expectSubject: []string{"leaf", "intermediate-2", "intermediate-1"},
+		},
+		{
+			name:      "negative limit is rejected",
+			opts:      []SignOption{WithMaxIntermediates(-1)},
+			expectErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			bundle, _, err := SignCertificateWithChain(template, issuerChain, leafKey.Public(), int2Key, test.opts...)
+			if test.expectErr != (err != nil) {
+				t.Fatalf("expected error %t but got: %v", test.expectErr, err)
+			}
+			if test.expectErr {
+				return
+			}
+			certs, err := DecodeX509CertificateChainBytes(bundle)
+			if err != nil {
+				t.Fatalf("error decoding bundle: %v", err)
+			}
+			var subjects []string
+			for _, c := range certs {
+				subjects = append(subjects, c.Subject.CommonName)
+			}
+			if !reflect.DeepEqual(subjects, test.expectSubject) {
+				t.Errorf("expected bundle %q but got %q", test.expectSubject, subjects)
+			}
+		})
+	}
+}
+
+func TestDNSNamesForCertificateWithPolicy(t *testing.T) {
+	type testT struct {
+		name           string
+		policy         CommonNameSANPolicy
+		crtCN          string
+		crtDNSNames    []string
+		expectDNSNames []string
+	}
+	tests := []testT{
+		{
+			name:           "include policy with common name not in dns names",
+			policy:         CommonNameSANPolicyInclude,
+			crtCN:          "cn",
+			crtDNSNames:    []string{"dnsname"},
+			expectDNSNames: []string{"cn", "dnsname"},
+		},
+		{
+			name:           "include policy with common name in dns names",
+			policy:         CommonNameSANPolicyInclude,
+			crtCN:          "cn",
+			crtDNSNames:    []string{"dnsname", "cn"},
+			expectDNSNames: []string{"cn", "dnsname"},
+		},
+		{
+			name:           "include if absent policy with common name not in dns names",
+			policy:         CommonNameSANPolicyIncludeIfAbsent,
+			crtCN:          "cn",
+			crtDNSNames:    []string{"dnsname"},
+			expectDNSNames: []string{"cn", "dnsname"},
+		},
+		{
+			name:           "include if absent policy with common name in dns names",
+			policy:         CommonNameSANPolicyIncludeIfAbsent,
+			crtCN:          "cn",
+			crtDNSNames:    []string{"dnsname", "cn"},
+			expectDNSNames: []string{"dnsname", "cn"},
+		},
+		{
+			name:           "omit policy with common name not in dns names",
+			policy:         CommonNameSANPolicyOmit,
+			crtCN:          "cn",
+			crtDNSNames:    []string{"dnsname"},
+			expectDNSNames: []string{"dnsname"},
+		},
+		{
+			name:           "omit policy with common name in dns names",
+			policy:         CommonNameSANPolicyOmit,
+			crtCN:          "cn",
+			crtDNSNames:    []string{"dnsname", "cn"},
+			expectDNSNames: []string{"dnsname", "cn"},
+		},
+		{
+			name:           "omit policy with only a common name",
+			policy:         CommonNameSANPolicyOmit,
+			crtCN:          "cn",
+			expectDNSNames: []string{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			crt := buildCertificate(test.crtCN, test.crtDNSNames...)
+			actual := DNSNamesForCertificateWithPolicy(crt, test.policy)
+			if !reflect.DeepEqual(actual, test.expectDNSNames) {
+				t.Errorf("expected %q but got %q", test.expectDNSNames, actual)
+			}
+
+			template, err := GenerateTemplate(nil, crt, WithCommonNameSANPolicy(test.policy))
+			if err != nil {
+				t.Fatalf("error generating template: %v", err)
+			}
+			if len(template.DNSNames) != len(test.expectDNSNames) || (len(template.DNSNames) > 0 && !reflect.DeepEqual(template.DNSNames, test.expectDNSNames)) {
+				t.Errorf("expected template dns names %q but got %q", test.expectDNSNames, template.DNSNames)
+			}
+			if template.Subject.CommonName != test.crtCN {
+				t.Errorf("expected common name %q but got %q", test.crtCN, template.Subject.CommonName)
+			}
+		})
+	}
+}
+
+func TestGenerateDeviceIdentityCertificate(t *testing.T) {
+	crt := &v1alpha1.Certificate{}
+
+	pk, err := GenerateECPrivateKey(ECCurve256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template, err := GenerateTemplate(nil, crt, WithDeviceIdentity("SN-0042"))
+	if err != nil {
+		t.Fatalf("expected device identity template to be generated, but got: %v", err)
+	}
+	_, cert, err := SignCertificate(template, template, pk.Public(), pk)
+	if err != nil {
+		t.Fatalf("error signing certificate: %v", err)
+	}
+	if cert.Subject.SerialNumber != "SN-0042" {
+		t.Errorf("expected subject serialNumber %q but got %q", "SN-0042", cert.Subject.SerialNumber)
+	}
+	if cert.Subject.CommonName != "" {
+		t.Errorf("expected no common name but got %q", cert.Subject.CommonName)
+	}
+	if len(cert.DNSNames) != 0 || len(cert.IPAddresses) != 0 {
+		t.Errorf("expected no subject alternative names but got %q and %q", cert.DNSNames, IPAddressesToString(cert.IPAddresses))
+	}
+	if cert.IsCA {
+		t.Errorf("expected device identity certificate to not be a CA")
+	}
+
+	csr, err := GenerateCSR(nil, crt, WithDeviceIdentity("SN-0042"))
+	if err != nil {
+		t.Fatalf("expected device identity csr to be generated, but got: %v", err)
+	}
+	if csr.Subject.SerialNumber != "SN-0042" {
+		t.Errorf("expected csr subject serialNumber %q but got %q", "SN-0042", csr.Subject.SerialNumber)
+	}
+
+	if _, err := GenerateTemplate(nil, crt, WithDeviceIdentity("")); err == nil {
+		t.Errorf("expected error generating device identity template with no serialNumber")
+	}
+	if _, err := GenerateTemplate(nil, &v1alpha1.Certificate{Spec: v1alpha1.CertificateSpec{IsCA: true}}, WithDeviceIdentity("SN-0042")); err == nil {
+		t.Errorf("expected error generating device identity template for a CA")
+	}
+}
+
+func TestSignCertificateMaxSize(t *testing.T) {
+	var dnsNames []string
+	for i := 0; i < 100; i++ {
+		dnsNames = append(dnsNames, fmt.Sprintf("host-%d.example.com", i))
+	}
+	crt := buildCertificate("test", dnsNames...)
+	// RSA signatures have a fixed length, so each signing has the same size
+	pk, err := GeneratePrivateKeyForCertificate(crt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template, err := GenerateTemplate(nil, crt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, cert, err := SignCertificate(template, template, pk.Public(), pk)
+	if err != nil {
+		t.Fatalf("expected no error without a size limit but got: %v", err)
+	}
+	size := len(cert.Raw)
+
+	if _, _, err := SignCertificate(template, template, pk.Public(), pk, WithMaxCertificateSize(size)); err != nil {
+		t.Errorf("expected no error for a certificate of exactly the maximum size but got: %v", err)
+	}
+	_, _, err = SignCertificate(template, template, pk.Public(), pk, WithMaxCertificateSize(1024))
+	if err == nil {
+		t.Fatalf("expected an error for a certificate of %d bytes", size)
+	}
+	if !strings.Contains(err.Error(), fmt.Sprintf("%d bytes", size)) {
+		t.Errorf("expected the error to include the certificate size but got: %v", err)
+	}
+}
+
+func TestSignCertificateExtKeyUsageDelegation(t *testing.T) {
+	caKey, err := GenerateECPrivateKey(ECCurve256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate, err := GenerateTemplate(nil, buildCACertificate("ca"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	_, caCert, err := SignCertificate(caTemplate, caTemplate, caKey.Public(), caKey)
+	if err != nil {
+		t.Fatalf("error signing CA certificate: %v", err)
+	}
+
+	type testT struct {
+		name        string
+		usages      []x509.ExtKeyUsage
+		expectedErr bool
+		errContains string
+	}
+	tests := []testT{
+		{
+			name:   "no extended key usages",
+			usages: nil,
+		},
+		{
+			name:   "usage permitted by the issuer",
+			usages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		},
+		{
+			name:        "usage not permitted by the issuer",
+			usages:      []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageCodeSigning},
+			expectedErr: true,
+			errContains: "codeSigning",
+		},
+		{
+			name:        "anyExtendedKeyUsage under a constrained issuer",
+			usages:      []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+			expectedErr: true,
+			errContains: "anyExtendedKeyUsage",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pk, err := GenerateECPrivateKey(ECCurve256)
+			if err != nil {
+				t.Fatal(err)
+			}
+			template, err := GenerateTemplate(nil, buildCertificate("leaf", "leaf.example.com"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			template.ExtKeyUsage = test.usages
+			_, _, err = SignCertificate(template, caCert, pk.Public(), caKey)
+			if err != nil && !test.expectedErr {
+				t.Errorf("expected no error but got: %v", err)
+			}
+			if err == nil && test.expectedErr {
+				t.Errorf("expected an error but got none")
+			}
+			if err != nil && test.expectedErr && !strings.Contains(err.Error(), test.errContains) {
+				t.Errorf("expected error to contain %q but got: %v", test.errContains, err)
+			}
+		})
+	}
+}
+
+// csrRequestedExtensions returns the extensions in the pkcs#9
+// extensionRequest attribute of the given DER encoded CSR.
+func csrRequestedExtensions(t *testing.T, der []byte) []pkix.Extension {
+	var csr struct {
+		TBS struct {
+			Version       int
+			Subject       asn1.RawValue
+			PublicKey     asn1.RawValue
+			RawAttributes []asn1.RawValue `asn1:"tag:0"`
+		}
+		SignatureAlgorithm pkix.AlgorithmIdentifier
+		Signature          asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(der, &csr); err != nil {
+		t.Fatalf("error decoding csr: %v", err)
+	}
+	oidExtensionRequest := asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 14}
+	for _, raw := range csr.TBS.RawAttributes {
+		var attr struct {
+			Type   asn1.ObjectIdentifier
+			Values []asn1.RawValue `asn1:"set"`
+		}
+		if _, err := asn1.Unmarshal(raw.FullBytes, &attr); err != nil {
+			t.Fatalf("error decoding csr attribute: %v", err)
+		}
+		if !attr.Type.Equal(oidExtensionRequest) {
+			continue
+		}
+		if len(attr.Values) != 1 {
+			t.Fatalf("expected extensionRequest attribute to have 1 value but got %d", len(attr.Values))
+		}
+		var exts []pkix.Extension
+		if _, err := asn1.Unmarshal(attr.Values[0].FullBytes, &exts); err != nil {
+			t.Fatalf("error decoding requested extensions: %v", err)
+		}
+		return exts
+	}
+	t.Fatalf("expected csr to contain an extensionRequest attribute")
+	return nil
+}
+
+func TestGenerateCSRExtensionRequest(t *testing.T) {
+	pk, err := GenerateRSAPrivateKey(MinRSAKeySize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, err := GenerateCSR(nil, buildCACertificate("test"))
+	if err != nil {
+		t.Fatalf("error generating csr: %v", err)
+	}
+	csr.DNSNames = []string{"test.example.com"}
+	der, err := EncodeCSR(csr, pk)
+	if err != nil {
+		t.Fatalf("error encoding csr: %v", err)
+	}
+
+	exts := csrRequestedExtensions(t, der)
+	var keyUsage, san *pkix.Extension
+	for i, ext := range exts {
+		switch {
+		case ext.Id.Equal(OIDExtensionKeyUsage):
+			keyUsage = &exts[i]
+		case ext.Id.Equal(asn1.ObjectIdentifier{2, 5, 29, 17}):
+			san = &exts[i]
+		}
+	}
+	if keyUsage == nil {
+		t.Fatalf("expected key usage to be requested")
+	}
+	if !keyUsage.Critical {
+		t.Errorf("expected requested key usage extension to be critical")
+	}
+	expected, err := KeyUsageExtension(x509.KeyUsageDigitalSignature|x509.KeyUsageKeyEncipherment|x509.KeyUsageCertSign, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(keyUsage.Value, expected.Value) {
+		t.Errorf("expected requested key usage %x but got %x", expected.Value, keyUsage.Value)
+	}
+	if san == nil {
+		t.Errorf("expected subject alternative names to be requested")
+	}
+}
+
+// constantReader is a broken source of randomness that always returns the
+// same byte.
+type constantReader byte
+
+func (r constantReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = byte(r)
+	}
+	return len(p), nil
+}
+
+func TestGenerateTemplateSerialNumber(t *testing.T) {
+	withRand := func(r io.Reader) TemplateOption {
+		return func(o *templateOptions) {
+			o.rand = r
+		}
+	}
+	type testT struct {
+		name        string
+		opts        []TemplateOption
+		expectedErr bool
+	}
+	tests := []testT{
+		{
+			name: "default length",
+		},
+		{
+			name: "maximum length",
+			opts: []TemplateOption{WithSerialNumberBits(MaxSerialNumberBits)},
+		},
+		{
+			name:        "too long",
+			opts:        []TemplateOption{WithSerialNumberBits(MaxSerialNumberBits + 1)},
+			expectedErr: true,
+		},
+		{
+			name:        "too short",
+			opts:        []TemplateOption{WithSerialNumberBits(MinSerialNumberBits - 1)},
+			expectedErr: true,
+		},
+		{
+			name:        "source returning zeros",
+			opts:        []TemplateOption{withRand(constantReader(0))},
+			expectedErr: true,
+		},
+		{
+			name:        "source repeating values",
+			opts:        []TemplateOption{withRand(constantReader(0xa5))},
+			expectedErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			template, err := GenerateTemplate(nil, buildCertificate("test"), test.opts...)
+			if err != nil {
+				if !test.expectedErr {
+					t.Errorf("expected no error but got: %v", err)
+				}
+				return
+			}
+			if test.expectedErr {
+				t.Fatalf("expected an error but got none")
+			}
+			bits := newTemplateOptions(test.opts).serialNumberBits
+			if template.SerialNumber.BitLen() > bits {
+				t.Errorf("expected serial number of at most %d bits but got %d", bits, template.SerialNumber.BitLen())
+			}
+			pk, err := GenerateECPrivateKey(ECCurve256)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, _, err := SignCertificate(template, template, pk.Public(), pk); err != nil {
+				t.Errorf("error signing certificate: %v", err)
+			}
+		})
+	}
+}
+
+func TestDurationForCertificate(t *testing.T) {
+	issuerWithDuration := &v1alpha1.Issuer{
+		Spec: v1alpha1.IssuerSpec{
+			Duration: &metav1.Duration{Duration: 24 * time.Hour},
+		},
+	}
+	crtWithDuration := buildCertificate("test")
+	crtWithDuration.Spec.Duration = &metav1.Duration{Duration: 48 * time.Hour}
+
+	type testT struct {
+		name     string
+		issuer   v1alpha1.GenericIssuer
+		crt      *v1alpha1.Certificate
+		expected time.Duration
+	}
+	tests := []testT{
+		{
+			name:     "certificate duration takes precedence",
+			issuer:   issuerWithDuration,
+			crt:      crtWithDuration,
+			expected: 48 * time.Hour,
+		},
+		{
+			name:     "issuer duration used when certificate does not set one",
+			issuer:   issuerWithDuration,
+			crt:      buildCertificate("test"),
+			expected: 24 * time.Hour,
+		},
+		{
+			name:     "global default used when neither sets one",
+			issuer:   &v1alpha1.Issuer{},
+			crt:      buildCertificate("test"),
+			expected: v1alpha1.DefaultCertificateDuration,
+		},
+		{
+			name:     "global default used without an issuer",
+			crt:      buildCertificate("test"),
+			expected: v1alpha1.DefaultCertificateDuration,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if actual := DurationForCertificate(test.issuer, test.crt); actual != test.expected {
+				t.Errorf("expected duration %s but got %s", test.expected, actual)
+			}
+			template, err := GenerateTemplate(test.issuer, test.crt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if actual := template.NotAfter.Sub(template.NotBefore); actual.Round(time.Second) != test.expected {
+				t.Errorf("expected template validity of %s but got %s", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestValidateTemplateAlgorithms(t *testing.T) {
+	type testT struct {
+		name        string
+		pubKeyAlgo  x509.PublicKeyAlgorithm
+		sigAlgo     x509.SignatureAlgorithm
+		expectedErr bool
+	}
+	tests := []testT{
+		{
+			name:       "rsa key with rsa signature",
+			pubKeyAlgo: x509.RSA,
+			sigAlgo:    x509.SHA256WithRSA,
+		},
+		{
+			name:       "rsa key with rsa-pss signature",
+			pubKeyAlgo: x509.RSA,
+			sigAlgo:    x509.SHA384WithRSAPSS,
+		},
+		{
+			name:       "ecdsa key with ecdsa signature",
+			pubKeyAlgo: x509.ECDSA,
+			sigAlgo:    x509.ECDSAWithSHA384,
+		},
+		{
+			name:       "unset signature algorithm",
+			pubKeyAlgo: x509.ECDSA,
+		},
+		{
+			name:        "ecdsa key with rsa signature",
+			pubKeyAlgo:  x509.ECDSA,
+			sigAlgo:     x509.SHA256WithRSA,
+			expectedErr: true,
+		},
+		{
+			name:        "rsa key with ecdsa signature",
+			pubKeyAlgo:  x509.RSA,
+			sigAlgo:     x509.ECDSAWithSHA256,
+			expectedErr: true,
+		},
+		{
+			name:        "ed25519 key with rsa-pss signature",
+			pubKeyAlgo:  x509.Ed25519,
+			sigAlgo:     x509.SHA256WithRSAPSS,
+			expectedErr: true,
+		},
+		{
+			name:        "ecdsa key with ed25519 signature",
+			pubKeyAlgo:  x509.ECDSA,
+			sigAlgo:     x509.PureEd25519,
+			expectedErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := ValidateTemplateAlgorithms(&x509.Certificate{
+				PublicKeyAlgorithm: test.pubKeyAlgo,
+				SignatureAlgorithm: test.sigAlgo,
+			})
+			if err != nil && !test.expectedErr {
+				t.Errorf("expected no error but got: %v", err)
+			}
+			if err == nil && test.expectedErr {
+				t.Errorf("expected an error but got none")
+			}
+		})
+	}
+
+	crt := buildCertificate("test")
+	crt.Spec.KeyAlgorithm = v1alpha1.ECDSAKeyAlgorithm
+	if _, err := GenerateCSR(nil, crt, WithSignatureAlgorithm(x509.SHA256WithRSA)); err == nil {
+		t.Errorf("expected an error generating an ecdsa csr with an rsa signature algorithm")
+	}
+}
+
+func TestGenerateTemplateWithKey(t *testing.T) {
+	rsaKey, err := GenerateRSAPrivateKey(3072)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := GenerateECPrivateKey(ECCurve384)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type testT struct {
+		name            string
+		keyAlgo         v1alpha1.KeyAlgorithm
+		keySize         int
+		key             crypto.Signer
+		policy          KeyAlgorithmConflictPolicy
+		expectErr       bool
+		expectErrStrs   []string
+		expectedKeyType x509.PublicKeyAlgorithm
+		expectedSigAlgo x509.SignatureAlgorithm
+	}
+	tests := []testT{
+		{
+			name:            "rsa key with no key algorithm set",
+			key:             rsaKey,
+			expectedKeyType: x509.RSA,
+			expectedSigAlgo: x509.SHA384WithRSA,
+		},
+		{
+			name:            "ecdsa key with no key algorithm set",
+			key:             ecKey,
+			expectedKeyType: x509.ECDSA,
+			expectedSigAlgo: x509.ECDSAWithSHA384,
+		},
+		{
+			name:            "ecdsa key with matching key algorithm and size",
+			keyAlgo:         v1alpha1.ECDSAKeyAlgorithm,
+			keySize:         ECCurve384,
+			key:             ecKey,
+			expectedKeyType: x509.ECDSA,
+			expectedSigAlgo: x509.ECDSAWithSHA384,
+		},
+		{
+			name:          "ecdsa key with rsa key algorithm set",
+			keyAlgo:       v1alpha1.RSAKeyAlgorithm,
+			key:           ecKey,
+			expectErr:     true,
+			expectErrStrs: []string{`"rsa"`, "ECDSA"},
+		},
+		{
+			name:          "rsa key with ecdsa key algorithm set",
+			keyAlgo:       v1alpha1.ECDSAKeyAlgorithm,
+			key:           rsaKey,
+			expectErr:     true,
+			expectErrStrs: []string{`"ecdsa"`, "RSA"},
+		},
+		{
+			name:          "rsa key with mismatched key size",
+			keyAlgo:       v1alpha1.RSAKeyAlgorithm,
+			keySize:       2048,
+			key:           rsaKey,
+			expectErr:     true,
+			expectErrStrs: []string{"2048", "3072"},
+		},
+		{
+			name:            "rsa key with ecdsa key algorithm set trusting the key",
+			keyAlgo:         v1alpha1.ECDSAKeyAlgorithm,
+			key:             rsaKey,
+			policy:          KeyAlgorithmConflictUseKey,
+			expectedKeyType: x509.RSA,
+			expectedSigAlgo: x509.SHA384WithRSA,
+		},
+		{
+			name:            "ecdsa key with rsa key algorithm set trusting the key",
+			keyAlgo:         v1alpha1.RSAKeyAlgorithm,
+			key:             ecKey,
+			policy:          KeyAlgorithmConflictUseKey,
+			expectedKeyType: x509.ECDSA,
+			expectedSigAlgo: x509.ECDSAWithSHA384,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			crt := buildCertificate("test", "test.example.com")
+			crt.Spec.KeyAlgorithm = test.keyAlgo
+			crt.Spec.KeySize = test.keySize
+
+			template, err := GenerateTemplateWithKey(nil, crt, test.key.Public(), WithKeyAlgorithmConflictPolicy(test.policy))
+			if test.expectErr {
+				if err == nil {
+					t.Fatalf("expected an error but got none")
+				}
+				for _, s := range test.expectErrStrs {
+					if !strings.Contains(err.Error(), s) {
+						t.Errorf("expected error to contain %s, but got: %v", s, err)
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error generating template: %v", err)
+			}
+			if template.PublicKeyAlgorithm != test.expectedKeyType {
+				t.Errorf("expected public key algorithm %s but got %s", test.expectedKeyType, template.PublicKeyAlgorithm)
+			}
+			if template.PublicKey != test.key.Public() {
+				t.Errorf("expected template public key to be the provided key")
+			}
+
+			csr, err := GenerateCSRWithKey(nil, crt, test.key.Public(), WithKeyAlgorithmConflictPolicy(test.policy))
+			if err != nil {
+				t.Fatalf("error generating csr: %v", err)
+			}
+			if csr.SignatureAlgorithm != test.expectedSigAlgo {
+				t.Errorf("expected signature algorithm %s but got %s", test.expectedSigAlgo, csr.SignatureAlgorithm)
+			}
+			if _, err := EncodeCSR(csr, test.key); err != nil {
+				t.Errorf("error encoding csr: %v", err)
+			}
+		})
+	}
+}
+
+func TestGenerateTemplateTrimsNames(t *testing.T) {
+	crt := buildCertificate(" test ", "test.example.com ", " www.example.com")
+	crt.Spec.IPAddresses = []string{" 10.0.0.1 "}
+	template, err := GenerateTemplate(nil, crt)
+	if err != nil {
+		t.Fatalf("error generating template: %v", err)
+	}
+	if template.Subject.CommonName != "test" {
+		t.Errorf("expected common name %q but got %q", "test", template.Subject.CommonName)
+	}
+	expectedDNSNames := []string{"test", "test.example.com", "www.example.com"}
+	if !reflect.DeepEqual(template.DNSNames, expectedDNSNames) {
+		t.Errorf("expected dns names %q but got %q", expectedDNSNames, template.DNSNames)
+	}
+	if len(template.IPAddresses) != 1 || !template.IPAddresses[0].Equal(net.ParseIP("10.0.0.1")) {
+		t.Errorf("expected ip address 10.0.0.1 but got %v", template.IPAddresses)
+	}
+
+	crt.Spec.DNSNames = append(crt.Spec.DNSNames, " ")
+	if _, err := GenerateTemplate(nil, crt); err == nil {
+		t.Errorf("expected an error generating a template with a whitespace only dns name")
+	}
+}
+
+func TestGenerateSubject(t *testing.T) {
+	crt := buildCertificate("test")
+	crt.Spec.Subject = &v1alpha1.X509Subject{
+		OrganizationalUnits: []string{"engineering"},
+		Countries:           []string{"GB"},
+		Localities:          []string{"London", " "},
+		Provinces:           []string{"Greater London"},
+		StreetAddresses:     []string{"1 Example Street"},
+		PostalCodes:         []string{},
+	}
+	expected := pkix.Name{
+		CommonName:         "test",
+		Organization:       []string{defaultOrganization},
+		OrganizationalUnit: []string{"engineering"},
+		Country:            []string{"GB"},
+		Locality:           []string{"London"},
+		Province:           []string{"Greater London"},
+		StreetAddress:      []string{"1 Example Street"},
+	}
+
+	template, err := GenerateTemplate(nil, crt)
+	if err != nil {
+		t.Fatalf("error generating template: %v", err)
+	}
+	if !reflect.DeepEqual(template.Subject, expected) {
+		t.Errorf("expected template subject %+v but got %+v", expected, template.Subject)
+	}
+	csr, err := GenerateCSR(nil, crt)
+	if err != nil {
+		t.Fatalf("error generating csr: %v", err)
+	}
+	if !reflect.DeepEqual(csr.Subject, expected) {
+		t.Errorf("expected csr subject %+v but got %+v", expected, csr.Subject)
+	}
+
+	crt.Spec.Subject = nil
+	template, err = GenerateTemplate(nil, crt)
+	if err != nil {
+		t.Fatalf("error generating template: %v", err)
+	}
+	expected = pkix.Name{CommonName: "test", Organization: []string{defaultOrganization}}
+	if !reflect.DeepEqual(template.Subject, expected) {
+		t.Errorf("expected template subject %+v but got %+v", expected, template.Subject)
+	}
+}
+
+func TestGenerateTemplateSerialNumberCollision(t *testing.T) {
+	var seen []*big.Int
+	rejectFirst := func(serial *big.Int) bool {
+		seen = append(seen, serial)
+		return len(seen) == 1
+	}
+	template, err := GenerateTemplate(nil, buildCertificate("test"), WithSerialNumberCollisionCheck(rejectFirst))
+	if err != nil {
+		t.Fatalf("error generating template: %v", err)
+	}
+	if len(seen) != 2 {
+		t.Fatalf("expected 2 serial numbers to be checked but got %d", len(seen))
+	}
+	if template.SerialNumber.Cmp(seen[1]) != 0 || template.SerialNumber.Cmp(seen[0]) == 0 {
+		t.Errorf("expected the regenerated serial number to be used")
+	}
+
+	rejectAll := func(*big.Int) bool { return true }
+	if _, err := GenerateTemplate(nil, buildCertificate("test"), WithSerialNumberCollisionCheck(rejectAll)); err == nil {
+		t.Errorf("expected an error when every serial number is already used")
+	}
+}
+
+func TestGenerateTemplateMinimumDuration(t *testing.T) {
+	crt := buildCertificate("test")
+	crt.Spec.Duration = &metav1.Duration{Duration: v1alpha1.MinimumCertificateDuration}
+	if _, err := GenerateTemplate(nil, crt); err != nil {
+		t.Errorf("expected no error for the minimum duration but got: %v", err)
+	}
+
+	crt.Spec.Duration = &metav1.Duration{Duration: v1alpha1.MinimumCertificateDuration - time.Minute}
+	if _, err := GenerateTemplate(nil, crt); err == nil {
+		t.Errorf("expected an error for a duration shorter than the minimum")
+	}
+}
+
+func TestGenerateTemplatePreservesCommonNameCase(t *testing.T) {
+	template, err := GenerateTemplate(nil, buildCertificate("Example.com", "example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if template.Subject.CommonName != "Example.com" {
+		t.Errorf("expected common name %q but got %q", "Example.com", template.Subject.CommonName)
+	}
+	if !reflect.DeepEqual(template.DNSNames, []string{"example.com"}) {
+		t.Errorf("expected dns names %q but got %q", []string{"example.com"}, template.DNSNames)
+	}
+}
+
+func TestGenerateTemplateNotBeforeSkew(t *testing.T) {
+	crt := buildCertificate("test")
+	crt.Spec.Duration = &metav1.Duration{Duration: 24 * time.Hour}
+	crt.Spec.NotBeforeSkew = &metav1.Duration{Duration: 5 * time.Minute}
+
+	before := time.Now()
+	template, err := GenerateTemplate(nil, crt)
+	if err != nil {
+		t.Fatalf("error generating template: %v", err)
+	}
+	if validity := template.NotAfter.Sub(template.NotBefore); validity != 24*time.Hour+5*time.Minute {
+		t.Errorf("expected validity of %s but got %s", 24*time.Hour+5*time.Minute, validity)
+	}
+	if template.NotAfter.Before(before.Add(24 * time.Hour)) {
+		t.Errorf("expected NotAfter to be unaffected by the skew, but got %s", template.NotAfter)
+	}
+
+	// the skew of the Certificate takes precedence over that of a profile
+	template, err = GenerateTemplateWithProfile(nil, crt, &IssuanceProfile{Backdate: time.Hour})
+	if err != nil {
+		t.Fatalf("error generating template: %v", err)
+	}
+	if validity := template.NotAfter.Sub(template.NotBefore); validity != 24*time.Hour+5*time.Minute {
+		t.Errorf("expected validity of %s but got %s", 24*time.Hour+5*time.Minute, validity)
+	}
+
+	crt.Spec.NotBeforeSkew = &metav1.Duration{Duration: -time.Minute}
+	if _, err := GenerateTemplate(nil, crt); err == nil {
+		t.Errorf("expected an error for a negative skew")
+	}
+}
+
+func TestGenerateTemplateDefaultOrganization(t *testing.T) {
+	tests := map[string]struct {
+		organization []string
+		opts         []TemplateOption
+		expected     []string
+	}{
+		"unset organization is defaulted": {
+			expected: []string{defaultOrganization},
+		},
+		"explicitly empty organization is defaulted": {
+			organization: []string{},
+			expected:     []string{defaultOrganization},
+		},
+		"unset organization is not defaulted without the default": {
+			opts: []TemplateOption{WithoutDefaultOrganization()},
+		},
+		"explicitly empty organization is not defaulted without the default": {
+			organization: []string{},
+			opts:         []TemplateOption{WithoutDefaultOrganization()},
+		},
+		"set organization is used without the default": {
+			organization: []string{"example"},
+			opts:         []TemplateOption{WithoutDefaultOrganization()},
+			expected:     []string{"example"},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			crt := buildCertificate("example.com")
+			crt.Spec.Organization = test.organization
+			template, err := GenerateTemplate(nil, crt, test.opts...)
+			if err != nil {
+				t.Fatalf("error generating template: %v", err)
+			}
+			if template.Subject.CommonName != "example.com" {
+				t.Errorf("expected common name %q but got %q", "example.com", template.Subject.CommonName)
+			}
+			if len(test.expected) == 0 && len(template.Subject.Organization) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(template.Subject.Organization, test.expected) {
+				t.Errorf("expected organization %v but got %v", test.expected, template.Subject.Organization)
+			}
+		})
+	}
+
+	crt := buildCertificate("example.com")
+	template, err := GenerateTemplateWithProfile(nil, crt, &IssuanceProfile{NoDefaultOrganization: true})
+	if err != nil {
+		t.Fatalf("error generating template: %v", err)
+	}
+	if len(template.Subject.Organization) != 0 {
+		t.Errorf("expected no organization from the profile but got %v", template.Subject.Organization)
+	}
+}
+
+func TestGenerateTemplateMaxValidity(t *testing.T) {
+	const twoYears = 2 * 365 * 24 * time.Hour
+	crt := buildCertificate("test")
+	crt.Spec.Duration = &metav1.Duration{Duration: 10 * 365 * 24 * time.Hour}
+
+	template, err := GenerateTemplate(nil, crt, WithMaxValidity(twoYears))
+	if err != nil {
+		t.Fatalf("error generating template: %v", err)
+	}
+	if validity := template.NotAfter.Sub(template.NotBefore); validity != twoYears {
+		t.Errorf("expected validity to be clamped to %s but got %s", twoYears, validity)
+	}
+
+	template, err = GenerateTemplateWithProfile(nil, crt, &IssuanceProfile{MaxValidity: twoYears})
+	if err != nil {
+		t.Fatalf("error generating template: %v", err)
+	}
+	if validity := template.NotAfter.Sub(template.NotBefore); validity != twoYears {
+		t.Errorf("expected validity to be clamped to %s by the profile but got %s", twoYears, validity)
+	}
+
+	// shorter durations, and the default of no ceiling, are unaffected
+	crt.Spec.Duration = &metav1.Duration{Duration: 365 * 24 * time.Hour}
+	template, err = GenerateTemplate(nil, crt, WithMaxValidity(twoYears))
+	if err != nil {
+		t.Fatalf("error generating template: %v", err)
+	}
+	if validity := template.NotAfter.Sub(template.NotBefore); validity != 365*24*time.Hour {
+		t.Errorf("expected validity of %s but got %s", 365*24*time.Hour, validity)
+	}
+	crt.Spec.Duration = &metav1.Duration{Duration: 10 * 365 * 24 * time.Hour}
+	template, err = GenerateTemplate(nil, crt)
+	if err != nil {
+		t.Fatalf("error generating template: %v", err)
+	}
+	if validity := template.NotAfter.Sub(template.NotBefore); validity != 10*365*24*time.Hour {
+		t.Errorf("expected validity of %s but got %s", 10*365*24*time.Hour, validity)
+	}
+}
+
+func TestGenerateTemplatePublicTrustLimit(t *testing.T) {
+	crt := buildCertificate("test", "example.com")
+	crt.Spec.Duration = &metav1.Duration{Duration: 2 * 365 * 24 * time.Hour}
+
+	if _, err := GenerateTemplate(nil, crt, WithPublicTrustLimit(0)); err == nil {
+		t.Errorf("expected an error for a duration over the default limit but got none")
+	}
+	if _, err := GenerateTemplateWithProfile(nil, crt, &IssuanceProfile{PublicTrust: true}); err == nil {
+		t.Errorf("expected an error for a duration over the limit of the profile but got none")
+	}
+	if _, err := GenerateTemplateWithProfile(nil, crt, &IssuanceProfile{PublicTrust: true, PublicTrustMaxValidity: 3 * 365 * 24 * time.Hour}); err != nil {
+		t.Errorf("expected no error for a duration under the limit of the profile but got: %v", err)
+	}
+	// the limit applies to the duration after any ceiling is applied
+	if _, err := GenerateTemplate(nil, crt, WithMaxValidity(DefaultPublicTrustMaxValidity), WithPublicTrustLimit(0)); err != nil {
+		t.Errorf("expected no error for a clamped duration but got: %v", err)
+	}
+	if _, err := GenerateTemplate(nil, crt); err != nil {
+		t.Errorf("expected no error without the limit but got: %v", err)
+	}
+}
+
+func TestGenerateTemplateCRLDistributionPoints(t *testing.T) {
+	const issuerCRL = "http://crl.example.com/issuer.crl"
+	const specCRL = "http://crl.example.com/spec.crl"
+
+	tests := map[string]struct {
+		specPoints  []string
+		opts        []TemplateOption
+		expPoints   []string
+		expectedErr bool
+	}{
+		"no extension if no points are configured": {},
+		"points from the issuer are used": {
+			opts:      []TemplateOption{WithCRLDistributionPoints(issuerCRL)},
+			expPoints: []string{issuerCRL},
+		},
+		"points from the certificate take precedence": {
+			specPoints: []string{specCRL, specCRL},
+			opts:       []TemplateOption{WithCRLDistributionPoints(issuerCRL)},
+			expPoints:  []string{specCRL},
+		},
+		"relative urls are rejected": {
+			specPoints:  []string{"/spec.crl"},
+			expectedErr: true,
+		},
+		"urls without a host are rejected": {
+			opts:        []TemplateOption{WithCRLDistributionPoints("http:spec.crl")},
+			expectedErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			crt := buildCertificate("test", "test.example.com")
+			crt.Spec.CRLDistributionPoints = test.specPoints
+
+			template, err := GenerateTemplate(nil, crt, test.opts...)
+			if test.expectedErr {
+				if err == nil {
+					t.Errorf("expected an error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(template.CRLDistributionPoints, test.expPoints) {
+				t.Errorf("expected CRL distribution points %v but got %v", test.expPoints, template.CRLDistributionPoints)
+			}
+
+			pk, err := GeneratePrivateKeyForCertificate(crt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, cert, err := SignCertificate(template, template, pk.Public(), pk)
+			if err != nil {
+				t.Fatalf("error signing certificate: %v", err)
+			}
+			if !reflect.DeepEqual(cert.CRLDistributionPoints, test.expPoints) {
+				t.Errorf("expected signed CRL distribution points %v but got %v", test.expPoints, cert.CRLDistributionPoints)
+			}
+			if ext := findExtension(t, cert.Extensions, OIDExtensionCRLDistributionPoints); len(test.expPoints) == 0 && ext != nil {
+				t.Errorf("expected no CRL distribution points extension but got one")
+			}
+		})
+	}
+}
+
+func TestGenerateTemplateAuthorityInfoAccess(t *testing.T) {
+	const ocspServer = "http://ocsp.example.com"
+	const issuerURL = "http://ca.example.com/ca.crt"
+	const specIssuerURL = "http://ca.example.com/spec.crt"
+
+	tests := map[string]struct {
+		specOCSPServers []string
+		specIssuerURLs  []string
+		opts            []TemplateOption
+		expOCSPServers  []string
+		expIssuerURLs   []string
+		expectedErr     bool
+	}{
+		"no extension if nothing is configured": {},
+		"urls from the issuer are used": {
+			opts:           []TemplateOption{WithOCSPServers(ocspServer), WithIssuingCertificateURLs(issuerURL)},
+			expOCSPServers: []string{ocspServer},
+			expIssuerURLs:  []string{issuerURL},
+		},
+		"urls from the certificate take precedence": {
+			specIssuerURLs: []string{specIssuerURL},
+			opts:           []TemplateOption{WithOCSPServers(ocspServer), WithIssuingCertificateURLs(issuerURL)},
+			expOCSPServers: []string{ocspServer},
+			expIssuerURLs:  []string{specIssuerURL},
+		},
+		"only ocsp servers": {
+			specOCSPServers: []string{ocspServer},
+			expOCSPServers:  []string{ocspServer},
+		},
+		"invalid ocsp servers are rejected": {
+			specOCSPServers: []string{"ocsp.example.com"},
+			expectedErr:     true,
+		},
+		"invalid issuing certificate urls are rejected": {
+			opts:        []TemplateOption{WithIssuingCertificateURLs("/ca.crt")},
+			expectedErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			crt := buildCertificate("test", "test.example.com")
+			crt.Spec.OCSPServers = test.specOCSPServers
+			crt.Spec.IssuingCertificateURLs = test.specIssuerURLs
+
+			template, err := GenerateTemplate(nil, crt, test.opts...)
+			if test.expectedErr {
+				if err == nil {
+					t.Errorf("expected an error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			pk, err := GeneratePrivateKeyForCertificate(crt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, cert, err := SignCertificate(template, template, pk.Public(), pk)
+			if err != nil {
+				t.Fatalf("error signing certificate: %v", err)
+			}
+			if !reflect.DeepEqual(cert.OCSPServer, test.expOCSPServers) {
+				t.Errorf("expected OCSP servers %v but got %v", test.expOCSPServers, cert.OCSPServer)
+			}
+			if !reflect.DeepEqual(cert.IssuingCertificateURL, test.expIssuerURLs) {
+				t.Errorf("expected issuing certificate URLs %v but got %v", test.expIssuerURLs, cert.IssuingCertificateURL)
+			}
+			if ext := findExtension(t, cert.Extensions, OIDExtensionAuthorityInfoAccess); len(test.expOCSPServers) == 0 && len(test.expIssuerURLs) == 0 && ext != nil {
+				t.Errorf("expected no authority information access extension but got one")
+			}
+		})
+	}
+}
+
+func TestGenerateTemplateSpecSerialNumber(t *testing.T) {
+	crt := buildCertificate("test", "test.example.com")
+	crt.Spec.SerialNumber = "0x3039"
+
+	template, err := GenerateTemplate(nil, crt)
+	if err != nil {
+		t.Fatalf("error generating template: %v", err)
+	}
+	if template.SerialNumber.Cmp(big.NewInt(12345)) != 0 {
+		t.Errorf("expected serial number 12345 but got %s", template.SerialNumber)
+	}
+
+	isSerialUsed := func(serial *big.Int) bool { return serial.Cmp(big.NewInt(12345)) == 0 }
+	if _, err := GenerateTemplate(nil, crt, WithSerialNumberCollisionCheck(isSerialUsed)); err == nil {
+		t.Errorf("expected an error for a serial number that has already been used")
+	}
+
+	crt.Spec.SerialNumber = "-12345"
+	if _, err := GenerateTemplate(nil, crt); err == nil {
+		t.Errorf("expected an error for a negative serial number")
+	}
+}
+
+func TestGenerateTemplateNameConstraints(t *testing.T) {
+	nameConstraints := &v1alpha1.NameConstraints{
+		PermittedDNSDomains: []string{"Example.com", "example.org"},
+		ExcludedDNSDomains:  []string{"secret.example.com"},
+		PermittedIPRanges:   []string{"10.0.0.0/8", "2001:db8::/32"},
+		ExcludedIPRanges:    []string{"10.1.0.0/16"},
+	}
+
+	signCA := func(crt *v1alpha1.Certificate) *x509.Certificate {
+		template, err := GenerateTemplate(nil, crt)
+		if err != nil {
+			t.Fatalf("error generating template: %v", err)
+		}
+		pk, err := GeneratePrivateKeyForCertificate(crt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, cert, err := SignCertificate(template, template, pk.Public(), pk)
+		if err != nil {
+			t.Fatalf("error signing certificate: %v", err)
+		}
+		return cert
+	}
+
+	crt := buildCACertificate("ca")
+	crt.Spec.NameConstraints = nameConstraints
+	cert := signCA(crt)
+
+	ext := findExtension(t, cert.Extensions, OIDExtensionNameConstraints)
+	if ext == nil {
+		t.Fatalf("expected a name constraints extension")
+	}
+	if !ext.Critical || !cert.PermittedDNSDomainsCritical {
+		t.Errorf("expected the name constraints extension to be critical")
+	}
+	if expected := []string{"example.com", "example.org"}; !reflect.DeepEqual(cert.PermittedDNSDomains, expected) {
+		t.Errorf("expected permitted DNS domains %v but got %v", expected, cert.PermittedDNSDomains)
+	}
+	if expected := []string{"secret.example.com"}; !reflect.DeepEqual(cert.ExcludedDNSDomains, expected) {
+		t.Errorf("expected excluded DNS domains %v but got %v", expected, cert.ExcludedDNSDomains)
+	}
+	var permitted, excluded []string
+	for _, r := range cert.PermittedIPRanges {
+		permitted = append(permitted, r.String())
+	}
+	for _, r := range cert.ExcludedIPRanges {
+		excluded = append(excluded, r.String())
+	}
+	if expected := []string{"10.0.0.0/8", "2001:db8::/32"}; !reflect.DeepEqual(permitted, expected) {
+		t.Errorf("expected permitted IP ranges %v but got %v", expected, permitted)
+	}
+	if expected := []string{"10.1.0.0/16"}; !reflect.DeepEqual(excluded, expected) {
+		t.Errorf("expected excluded IP ranges %v but got %v", expected, excluded)
+	}
+
+	// name constraints are ignored for certificates that are not CAs
+	leaf := buildCertificate("test", "test.example.com")
+	leaf.Spec.NameConstraints = nameConstraints
+	if ext := findExtension(t, signCA(leaf).Extensions, OIDExtensionNameConstraints); ext != nil {
+		t.Errorf("expected no name constraints extension on a leaf certificate")
+	}
+
+	crt.Spec.NameConstraints = &v1alpha1.NameConstraints{PermittedIPRanges: []string{"10.0.0.1"}}
+	if _, err := GenerateTemplate(nil, crt); err == nil {
+		t.Errorf("expected an error for an IP range that is not in CIDR notation")
+	}
+}
+
+func TestGenerateTemplateMaxPathLen(t *testing.T) {
+	zero, one, negative := 0, 1, -1
+
+	tests := map[string]struct {
+		isCA              bool
+		maxPathLen        *int
+		expMaxPathLen     int
+		expMaxPathLenZero bool
+		expectedErr       bool
+	}{
+		"unset is unconstrained": {
+			isCA:          true,
+			expMaxPathLen: -1,
+		},
+		"zero forbids sub-CAs": {
+			isCA:              true,
+			maxPathLen:        &zero,
+			expMaxPathLen:     0,
+			expMaxPathLenZero: true,
+		},
+		"one allows a single sub-CA": {
+			isCA:          true,
+			maxPathLen:    &one,
+			expMaxPathLen: 1,
+		},
+		"ignored for leaf certificates": {
+			maxPathLen:    &zero,
+			expMaxPathLen: -1,
+		},
+		"negative is rejected": {
+			isCA:        true,
+			maxPathLen:  &negative,
+			expectedErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			crt := buildCertificate("test", "test.example.com")
+			if test.isCA {
+				crt = buildCACertificate("test")
+			}
+			crt.Spec.MaxPathLen = test.maxPathLen
+
+			template, err := GenerateTemplate(nil, crt)
+			if test.expectedErr {
+				if err == nil {
+					t.Errorf("expected an error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			pk, err := GeneratePrivateKeyForCertificate(crt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, cert, err := SignCertificate(template, template, pk.Public(), pk)
+			if err != nil {
+				t.Fatalf("error signing certificate: %v", err)
+			}
+			if cert.MaxPathLen != test.expMaxPathLen || cert.MaxPathLenZero != test.expMaxPathLenZero {
+				t.Errorf("expected MaxPathLen %d and MaxPathLenZero %t but got %d and %t",
+					test.expMaxPathLen, test.expMaxPathLenZero, cert.MaxPathLen, cert.MaxPathLenZero)
+			}
+		})
+	}
+}
+
+func TestMaxPathLenZeroForbidsSubCAs(t *testing.T) {
+	zero := 0
+	rootCrt := buildCACertificate("root")
+	rootCrt.Spec.MaxPathLen = &zero
+	root, rootKey := signTestCertificate(t, rootCrt, nil, nil)
+	intermediate, intermediateKey := signTestCertificate(t, buildCACertificate("intermediate"), root, rootKey)
+	leaf, _ := signTestCertificate(t, buildCertificate("leaf", "leaf.example.com"), intermediate, intermediateKey)
+	directLeaf, _ := signTestCertificate(t, buildCertificate("leaf", "leaf.example.com"), root, rootKey)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+	intermediates := x509.NewCertPool()
+	intermediates.AddCert(intermediate)
+
+	_, err := leaf.Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates})
+	if invalid, ok := err.(x509.CertificateInvalidError); !ok || invalid.Reason != x509.TooManyIntermediates {
+		t.Errorf("expected a chain through a sub-CA of a CA with a zero maxPathLen to be rejected, got %v", err)
+	}
+	if _, err := directLeaf.Verify(x509.VerifyOptions{Roots: roots}); err != nil {
+		t.Errorf("expected a leaf issued directly by the CA to verify: %v", err)
+	}
+}
+
+func TestSpecSignatureAlgorithm(t *testing.T) {
+	tests := map[string]struct {
+		keyAlgorithm v1alpha1.KeyAlgorithm
+		sigAlgo      string
+		expSigAlgo   x509.SignatureAlgorithm
+		expectedErr  bool
+	}{
+		"unset uses the computed algorithm": {
+			expSigAlgo: x509.SHA256WithRSA,
+		},
+		"SHA-384 with a 2048 bit rsa key": {
+			sigAlgo:    "SHA384WithRSA",
+			expSigAlgo: x509.SHA384WithRSA,
+		},
+		"rsa-pss with an rsa key": {
+			keyAlgorithm: v1alpha1.RSAKeyAlgorithm,
+			sigAlgo:      "SHA256WithRSAPSS",
+			expSigAlgo:   x509.SHA256WithRSAPSS,
+		},
+		"SHA-512 with an ecdsa key": {
+			keyAlgorithm: v1alpha1.ECDSAKeyAlgorithm,
+			sigAlgo:      "ECDSAWithSHA512",
+			expSigAlgo:   x509.ECDSAWithSHA512,
+		},
+		"ecdsa signature with an rsa key": {
+			sigAlgo:     "ECDSAWithSHA256",
+			expectedErr: true,
+		},
+		"rsa signature with an ed25519 key": {
+			keyAlgorithm: v1alpha1.Ed25519KeyAlgorithm,
+			sigAlgo:      "SHA256WithRSA",
+			expectedErr:  true,
+		},
+		"unknown algorithm": {
+			sigAlgo:     "MD5WithRSA",
+			expectedErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			crt := buildCertificate("test", "test.example.com")
+			crt.Spec.KeyAlgorithm = test.keyAlgorithm
+			crt.Spec.SignatureAlgorithm = test.sigAlgo
+			pk, err := GeneratePrivateKeyForCertificate(crt)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			csr, csrErr := GenerateCSR(nil, crt)
+			template, templateErr := GenerateTemplate(nil, crt)
+			if test.expectedErr {
+				if csrErr == nil || templateErr == nil {
+					t.Errorf("expected errors but got %v and %v", csrErr, templateErr)
+				}
+				return
+			}
+			if csrErr != nil || templateErr != nil {
+				t.Fatalf("unexpected errors: %v, %v", csrErr, templateErr)
+			}
+
+			if csr.SignatureAlgorithm != test.expSigAlgo {
+				t.Errorf("expected csr signature algorithm %s but got %s", test.expSigAlgo, csr.SignatureAlgorithm)
+			}
+			if _, err := EncodeCSR(csr, pk); err != nil {
+				t.Errorf("error encoding csr: %v", err)
+			}
+			_, cert, err := SignCertificate(template, template, pk.Public(), pk)
+			if err != nil {
+				t.Fatalf("error signing certificate: %v", err)
+			}
+			if cert.SignatureAlgorithm != test.expSigAlgo {
+				t.Errorf("expected certificate signature algorithm %s but got %s", test.expSigAlgo, cert.SignatureAlgorithm)
+			}
+		})
+	}
+}
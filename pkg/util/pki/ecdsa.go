@@ -0,0 +1,169 @@
+/*
+Copyright 2019 The Jetstack cert-manager contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pki
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+)
+
+// signedCertificate is an X.509 certificate split into the content that is
+// signed and its signature.
+type signedCertificate struct {
+	TBSCertificate     asn1.RawValue
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	SignatureValue     asn1.BitString
+}
+
+// ecdsaSignature is the ASN.1 encoding of an ECDSA signature, as defined in
+// RFC 3279.
+type ecdsaSignature struct {
+	R, S *big.Int
+}
+
+// supportedECDSACurves are the curves that the signer of a certificate is
+// assumed to use, smallest first.
+var supportedECDSACurves = []elliptic.Curve{elliptic.P224(), elliptic.P256(), elliptic.P384(), elliptic.P521()}
+
+// IsLowSSignature reports whether the ECDSA signature of the given
+// certificate is in low-S canonical form, i.e. its s value is at most half
+// the order of the curve. Go may produce either form, but some strict
+// verifiers only accept low-S signatures.
+// The curve of the signer is not recorded in the certificate, so it is taken
+// to be the smallest supported curve whose order is greater than both r and
+// s, which for a valid signature is the signer's curve with overwhelming
+// probability.
+// An error is returned if the certificate is not signed with ECDSA.
+func IsLowSSignature(cert *x509.Certificate) (bool, error) {
+	_, sig, err := parseECDSACertificateSignature(cert)
+	if err != nil {
+		return false, err
+	}
+	curve, err := curveForECDSASignature(sig)
+	if err != nil {
+		return false, err
+	}
+	return isLowS(sig.S, curve), nil
+}
+
+// NormalizeLowSSignature returns a copy of the given certificate with its
+// ECDSA signature in low-S canonical form. Replacing s with n-s, where n is
+// the order of the curve, gives an equally valid signature, so the
+// certificate does not need to be re-signed by its issuer. The certificate is
+// returned unchanged if its signature is already low-S.
+// The curve of the signer is inferred as for IsLowSSignature.
+func NormalizeLowSSignature(cert *x509.Certificate) (*x509.Certificate, error) {
+	_, sig, err := parseECDSACertificateSignature(cert)
+	if err != nil {
+		return nil, err
+	}
+	curve, err := curveForECDSASignature(sig)
+	if err != nil {
+		return nil, err
+	}
+	return normalizeLowSSignature(cert, curve)
+}
+
+// normalizeLowSSignature is NormalizeLowSSignature for a signer on a known
+// curve.
+func normalizeLowSSignature(cert *x509.Certificate, curve elliptic.Curve) (*x509.Certificate, error) {
+	c, sig, err := parseECDSACertificateSignature(cert)
+	if err != nil {
+		return nil, err
+	}
+	if isLowS(sig.S, curve) {
+		return cert, nil
+	}
+
+	sig.S = new(big.Int).Sub(curve.Params().N, sig.S)
+	sigBytes, err := asn1.Marshal(*sig)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding ecdsa signature: %s", err.Error())
+	}
+	c.SignatureValue = asn1.BitString{Bytes: sigBytes, BitLength: len(sigBytes) * 8}
+	der, err := asn1.Marshal(*c)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding certificate: %s", err.Error())
+	}
+
+	normalized, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding DER certificate bytes: %s", err.Error())
+	}
+	return normalized, nil
+}
+
+// lowSCurveForSigner returns the curve of signerKey if it is an ECDSA key, or
+// nil otherwise.
+func lowSCurveForSigner(signerKey interface{}) elliptic.Curve {
+	signer, ok := signerKey.(crypto.Signer)
+	if !ok {
+		return nil
+	}
+	pub, ok := signer.Public().(*ecdsa.PublicKey)
+	if !ok {
+		return nil
+	}
+	return pub.Curve
+}
+
+func parseECDSACertificateSignature(cert *x509.Certificate) (*signedCertificate, *ecdsaSignature, error) {
+	switch cert.SignatureAlgorithm {
+	case x509.ECDSAWithSHA1, x509.ECDSAWithSHA256, x509.ECDSAWithSHA384, x509.ECDSAWithSHA512:
+	default:
+		return nil, nil, fmt.Errorf("certificate signature algorithm %s is not ecdsa", cert.SignatureAlgorithm)
+	}
+
+	var c signedCertificate
+	if rest, err := asn1.Unmarshal(cert.Raw, &c); err != nil {
+		return nil, nil, fmt.Errorf("error decoding certificate: %s", err.Error())
+	} else if len(rest) > 0 {
+		return nil, nil, fmt.Errorf("trailing data after certificate")
+	}
+
+	var sig ecdsaSignature
+	if rest, err := asn1.Unmarshal(c.SignatureValue.RightAlign(), &sig); err != nil {
+		return nil, nil, fmt.Errorf("error decoding ecdsa signature: %s", err.Error())
+	} else if len(rest) > 0 {
+		return nil, nil, fmt.Errorf("trailing data after ecdsa signature")
+	}
+	if sig.R.Sign() <= 0 || sig.S.Sign() <= 0 {
+		return nil, nil, fmt.Errorf("ecdsa signature values must be positive")
+	}
+	return &c, &sig, nil
+}
+
+func curveForECDSASignature(sig *ecdsaSignature) (elliptic.Curve, error) {
+	for _, curve := range supportedECDSACurves {
+		n := curve.Params().N
+		if sig.R.Cmp(n) < 0 && sig.S.Cmp(n) < 0 {
+			return curve, nil
+		}
+	}
+	return nil, fmt.Errorf("ecdsa signature is too large for any supported curve")
+}
+
+func isLowS(s *big.Int, curve elliptic.Curve) bool {
+	halfOrder := new(big.Int).Rsh(curve.Params().N, 1)
+	return s.Cmp(halfOrder) <= 0
+}
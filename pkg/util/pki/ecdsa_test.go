@@ -0,0 +1,166 @@
+/*
+Copyright 2019 The Jetstack cert-manager contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pki
+
+import (
+	"crypto/elliptic"
+	"crypto/x509"
+	"encoding/asn1"
+	"math/big"
+	"testing"
+)
+
+// flipECDSASignature returns a copy of cert with the s value of its ECDSA
+// signature replaced by n-s, which is an equally valid signature in the
+// opposite (low-S or high-S) form.
+func flipECDSASignature(t *testing.T, cert *x509.Certificate, curve elliptic.Curve) *x509.Certificate {
+	c, sig, err := parseECDSACertificateSignature(cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig.S = new(big.Int).Sub(curve.Params().N, sig.S)
+	sigBytes, err := asn1.Marshal(*sig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SignatureValue = asn1.BitString{Bytes: sigBytes, BitLength: len(sigBytes) * 8}
+	der, err := asn1.Marshal(*c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	flipped, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return flipped
+}
+
+// lowAndHighSCertificates returns the same self signed certificate with a
+// low-S and a high-S signature.
+func lowAndHighSCertificates(t *testing.T, keySize int, ellipticCurve elliptic.Curve) (*x509.Certificate, *x509.Certificate) {
+	pk, err := GenerateECPrivateKey(keySize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template, err := GenerateTemplate(nil, buildCertificate("test", "test.example.com"), withPublicKey(pk.Public()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, cert, err := SignCertificate(template, template, pk.Public(), pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	flipped := flipECDSASignature(t, cert, ellipticCurve)
+	_, sig, err := parseECDSACertificateSignature(cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if isLowS(sig.S, ellipticCurve) {
+		return cert, flipped
+	}
+	return flipped, cert
+}
+
+func TestIsLowSSignature(t *testing.T) {
+	for _, curve := range []struct {
+		name string
+		size int
+		ec   elliptic.Curve
+	}{
+		{"P-256", ECCurve256, elliptic.P256()},
+		{"P-384", ECCurve384, elliptic.P384()},
+		{"P-521", ECCurve521, elliptic.P521()},
+	} {
+		t.Run(curve.name, func(t *testing.T) {
+			low, high := lowAndHighSCertificates(t, curve.size, curve.ec)
+
+			for _, cert := range []*x509.Certificate{low, high} {
+				if err := cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature); err != nil {
+					t.Fatalf("expected signature to be valid: %v", err)
+				}
+			}
+
+			if isLow, err := IsLowSSignature(low); err != nil || !isLow {
+				t.Errorf("expected low-S signature to be detected, got %t, %v", isLow, err)
+			}
+			if isLow, err := IsLowSSignature(high); err != nil || isLow {
+				t.Errorf("expected high-S signature to be detected, got %t, %v", isLow, err)
+			}
+
+			normalized, err := NormalizeLowSSignature(high)
+			if err != nil {
+				t.Fatalf("error normalizing signature: %v", err)
+			}
+			if !normalized.Equal(low) {
+				t.Errorf("expected normalized certificate to equal the low-S certificate")
+			}
+			if err := normalized.CheckSignature(normalized.SignatureAlgorithm, normalized.RawTBSCertificate, normalized.Signature); err != nil {
+				t.Errorf("expected normalized signature to be valid: %v", err)
+			}
+			if normalized, err := NormalizeLowSSignature(low); err != nil || normalized != low {
+				t.Errorf("expected low-S certificate to be returned unchanged, got %v", err)
+			}
+		})
+	}
+}
+
+func TestIsLowSSignatureNotECDSA(t *testing.T) {
+	pk, err := GenerateRSAPrivateKey(MinRSAKeySize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template, err := GenerateTemplate(nil, buildCertificate("test", "test.example.com"), withPublicKey(pk.Public()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, cert, err := SignCertificate(template, template, pk.Public(), pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := IsLowSSignature(cert); err == nil {
+		t.Errorf("expected an error for an rsa signature")
+	}
+}
+
+func TestSignCertificateWithLowSSignature(t *testing.T) {
+	pk, err := GenerateECPrivateKey(ECCurve256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template, err := GenerateTemplate(nil, buildCertificate("test", "test.example.com"), withPublicKey(pk.Public()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// signatures are randomised, so sign enough times that a high-S
+	// signature would almost certainly be produced without the option
+	for i := 0; i < 32; i++ {
+		pemBytes, cert, err := SignCertificate(template, template, pk.Public(), pk, WithLowSSignature())
+		if err != nil {
+			t.Fatalf("error signing certificate: %v", err)
+		}
+		if isLow, err := IsLowSSignature(cert); err != nil || !isLow {
+			t.Fatalf("expected a low-S signature, got %t, %v", isLow, err)
+		}
+		decoded, err := DecodeX509CertificateBytes(pemBytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !decoded.Equal(cert) {
+			t.Fatalf("expected PEM encoded certificate to be the normalized certificate")
+		}
+	}
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2019 The Jetstack cert-manager contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pki
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+)
+
+// OIDEd25519 is the object identifier of the Ed25519 signature and public key
+// algorithms, as defined in RFC 8410.
+var OIDEd25519 = asn1.ObjectIdentifier{1, 3, 101, 112}
+
+// certificateAlgorithms is the subset of an X.509 certificate needed to
+// inspect the encoding of its algorithm identifiers.
+type certificateAlgorithms struct {
+	TBSCertificate     tbsCertificateAlgorithms
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	SignatureValue     asn1.BitString
+}
+
+type tbsCertificateAlgorithms struct {
+	Version            int `asn1:"optional,explicit,default:0,tag:0"`
+	SerialNumber       *big.Int
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Issuer             asn1.RawValue
+	Validity           asn1.RawValue
+	Subject            asn1.RawValue
+	PublicKey          subjectPublicKeyInfo
+	UniqueId           asn1.BitString   `asn1:"optional,tag:1"`
+	SubjectUniqueId    asn1.BitString   `asn1:"optional,tag:2"`
+	Extensions         []pkix.Extension `asn1:"optional,explicit,tag:3"`
+}
+
+// ValidateEd25519Encoding returns an error if any Ed25519 algorithm
+// identifier of the given certificate has parameters. RFC 8410 requires the
+// parameters to be absent, and stricter parsers reject certificates that
+// encode them, e.g. as NULL as is done for RSA.
+// The signature algorithm of the certificate and of its TBSCertificate, and
+// the algorithm of its public key, are checked. Algorithm identifiers other
+// than Ed25519 are ignored.
+func ValidateEd25519Encoding(cert *x509.Certificate) error {
+	var c certificateAlgorithms
+	if rest, err := asn1.Unmarshal(cert.Raw, &c); err != nil {
+		return fmt.Errorf("error decoding certificate: %s", err.Error())
+	} else if len(rest) > 0 {
+		return fmt.Errorf("trailing data after certificate")
+	}
+
+	ids := []struct {
+		name string
+		id   pkix.AlgorithmIdentifier
+	}{
+		{"signature algorithm", c.SignatureAlgorithm},
+		{"TBSCertificate signature algorithm", c.TBSCertificate.SignatureAlgorithm},
+		{"public key algorithm", c.TBSCertificate.PublicKey.Algorithm},
+	}
+	for _, i := range ids {
+		if !i.id.Algorithm.Equal(OIDEd25519) {
+			continue
+		}
+		if len(i.id.Parameters.FullBytes) > 0 {
+			return fmt.Errorf("%s is Ed25519 but has parameters, which RFC 8410 requires to be absent", i.name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2019 The Jetstack cert-manager contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pki
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/asn1"
+	"testing"
+)
+
+func TestEd25519AlgorithmIdentifierEncoding(t *testing.T) {
+	pub, pk, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template, err := GenerateTemplateWithKey(nil, buildCertificate("test", "test.example.com"), pub)
+	if err != nil {
+		t.Fatalf("error generating template: %v", err)
+	}
+	_, cert, err := SignCertificate(template, template, pub, pk)
+	if err != nil {
+		t.Fatalf("error signing certificate: %v", err)
+	}
+	if cert.SignatureAlgorithm != x509.PureEd25519 {
+		t.Fatalf("expected signature algorithm %s but got %s", x509.PureEd25519, cert.SignatureAlgorithm)
+	}
+
+	var c certificateAlgorithms
+	if _, err := asn1.Unmarshal(cert.Raw, &c); err != nil {
+		t.Fatalf("error decoding certificate: %v", err)
+	}
+	for name, id := range map[string]asn1.ObjectIdentifier{
+		"signature algorithm":  c.SignatureAlgorithm.Algorithm,
+		"tbs signature":        c.TBSCertificate.SignatureAlgorithm.Algorithm,
+		"public key algorithm": c.TBSCertificate.PublicKey.Algorithm.Algorithm,
+	} {
+		if !id.Equal(OIDEd25519) {
+			t.Errorf("expected %s to be %s but got %s", name, OIDEd25519, id)
+		}
+	}
+	if len(c.SignatureAlgorithm.Parameters.FullBytes) != 0 {
+		t.Errorf("expected signature algorithm parameters to be absent but got %x", c.SignatureAlgorithm.Parameters.FullBytes)
+	}
+	if err := ValidateEd25519Encoding(cert); err != nil {
+		t.Errorf("expected no error but got: %v", err)
+	}
+
+	// re-encode the certificate with NULL parameters, as is done for RSA
+	c.SignatureAlgorithm.Parameters = asn1.NullRawValue
+	der, err := asn1.Marshal(c)
+	if err != nil {
+		t.Fatalf("error encoding certificate: %v", err)
+	}
+	if err := ValidateEd25519Encoding(&x509.Certificate{Raw: der}); err == nil {
+		t.Errorf("expected an error for an Ed25519 signature algorithm with parameters")
+	}
+}
@@ -0,0 +1,526 @@
+/*
+Copyright 2019 The Jetstack cert-manager contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pki
+
+import (
+	"crypto"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"math/bits"
+	"strings"
+)
+
+var (
+	// OIDExtensionKeyUsage is the OID of the X.509 KeyUsage extension.
+	OIDExtensionKeyUsage = asn1.ObjectIdentifier{2, 5, 29, 15}
+
+	// OIDExtensionSubjectKeyId is the OID of the X.509 SubjectKeyIdentifier
+	// extension.
+	OIDExtensionSubjectKeyId = asn1.ObjectIdentifier{2, 5, 29, 14}
+
+	// OIDExtensionAuthorityKeyId is the OID of the X.509
+	// AuthorityKeyIdentifier extension.
+	OIDExtensionAuthorityKeyId = asn1.ObjectIdentifier{2, 5, 29, 35}
+
+	// OIDExtensionBasicConstraints is the OID of the X.509 BasicConstraints
+	// extension.
+	OIDExtensionBasicConstraints = asn1.ObjectIdentifier{2, 5, 29, 19}
+
+	// OIDExtensionExtendedKeyUsage is the OID of the X.509 ExtendedKeyUsage
+	// extension.
+	OIDExtensionExtendedKeyUsage = asn1.ObjectIdentifier{2, 5, 29, 37}
+
+	// OIDExtensionCRLDistributionPoints is the OID of the X.509
+	// CRLDistributionPoints extension.
+	OIDExtensionCRLDistributionPoints = asn1.ObjectIdentifier{2, 5, 29, 31}
+
+	// OIDExtensionAuthorityInfoAccess is the OID of the X.509
+	// AuthorityInfoAccess extension.
+	OIDExtensionAuthorityInfoAccess = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 1}
+
+	// OIDExtensionNameConstraints is the OID of the X.509 NameConstraints
+	// extension.
+	OIDExtensionNameConstraints = asn1.ObjectIdentifier{2, 5, 29, 30}
+
+	// OIDExtensionCertificatePolicies is the OID of the X.509
+	// CertificatePolicies extension.
+	OIDExtensionCertificatePolicies = asn1.ObjectIdentifier{2, 5, 29, 32}
+
+	// OIDExtensionMicrosoftApplicationPolicies is the OID of the Microsoft
+	// "Application Policies" certificate extension.
+	OIDExtensionMicrosoftApplicationPolicies = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 21, 10}
+)
+
+// regeneratedExtensions are the extensions that are never copied from a
+// reference certificate by WithReferenceExtensions, as they are always
+// generated for the new certificate and its issuer.
+var regeneratedExtensions = []asn1.ObjectIdentifier{
+	OIDExtensionSubjectKeyId,
+	OIDExtensionAuthorityKeyId,
+	OIDExtensionBasicConstraints,
+}
+
+// ExtensionConflictPolicy determines how GenerateTemplate handles an
+// extension passed to WithCustomExtensions, or copied by
+// WithReferenceExtensions, that has the same OID as an extension generated
+// for the certificate.
+type ExtensionConflictPolicy int
+
+const (
+	// ExtensionConflictError returns an error naming the conflicting OID, as
+	// a certificate must not contain more than one instance of an extension.
+	// This is the default.
+	ExtensionConflictError ExtensionConflictPolicy = iota
+
+	// ExtensionConflictPreferCustom uses the custom or reference extension
+	// in place of the generated one.
+	ExtensionConflictPreferCustom
+)
+
+// extKeyUsageOIDs maps each x509.ExtKeyUsage to its object identifier, as
+// defined in RFC 5280 and by the respective vendors.
+var extKeyUsageOIDs = map[x509.ExtKeyUsage]asn1.ObjectIdentifier{
+	x509.ExtKeyUsageAny:                            {2, 5, 29, 37, 0},
+	x509.ExtKeyUsageServerAuth:                     {1, 3, 6, 1, 5, 5, 7, 3, 1},
+	x509.ExtKeyUsageClientAuth:                     {1, 3, 6, 1, 5, 5, 7, 3, 2},
+	x509.ExtKeyUsageCodeSigning:                    {1, 3, 6, 1, 5, 5, 7, 3, 3},
+	x509.ExtKeyUsageEmailProtection:                {1, 3, 6, 1, 5, 5, 7, 3, 4},
+	x509.ExtKeyUsageIPSECEndSystem:                 {1, 3, 6, 1, 5, 5, 7, 3, 5},
+	x509.ExtKeyUsageIPSECTunnel:                    {1, 3, 6, 1, 5, 5, 7, 3, 6},
+	x509.ExtKeyUsageIPSECUser:                      {1, 3, 6, 1, 5, 5, 7, 3, 7},
+	x509.ExtKeyUsageTimeStamping:                   {1, 3, 6, 1, 5, 5, 7, 3, 8},
+	x509.ExtKeyUsageOCSPSigning:                    {1, 3, 6, 1, 5, 5, 7, 3, 9},
+	x509.ExtKeyUsageMicrosoftServerGatedCrypto:     {1, 3, 6, 1, 4, 1, 311, 10, 3, 3},
+	x509.ExtKeyUsageNetscapeServerGatedCrypto:      {2, 16, 840, 1, 113730, 4, 1},
+	x509.ExtKeyUsageMicrosoftCommercialCodeSigning: {1, 3, 6, 1, 4, 1, 311, 2, 1, 22},
+	x509.ExtKeyUsageMicrosoftKernelCodeSigning:     {1, 3, 6, 1, 4, 1, 311, 61, 1, 1},
+}
+
+// extKeyUsageNames maps each x509.ExtKeyUsage to the name it is given in
+// RFC 5280, or by the respective vendors.
+var extKeyUsageNames = map[x509.ExtKeyUsage]string{
+	x509.ExtKeyUsageAny:                            "anyExtendedKeyUsage",
+	x509.ExtKeyUsageServerAuth:                     "serverAuth",
+	x509.ExtKeyUsageClientAuth:                     "clientAuth",
+	x509.ExtKeyUsageCodeSigning:                    "codeSigning",
+	x509.ExtKeyUsageEmailProtection:                "emailProtection",
+	x509.ExtKeyUsageIPSECEndSystem:                 "ipsecEndSystem",
+	x509.ExtKeyUsageIPSECTunnel:                    "ipsecTunnel",
+	x509.ExtKeyUsageIPSECUser:                      "ipsecUser",
+	x509.ExtKeyUsageTimeStamping:                   "timeStamping",
+	x509.ExtKeyUsageOCSPSigning:                    "OCSPSigning",
+	x509.ExtKeyUsageMicrosoftServerGatedCrypto:     "msSGC",
+	x509.ExtKeyUsageNetscapeServerGatedCrypto:      "nsSGC",
+	x509.ExtKeyUsageMicrosoftCommercialCodeSigning: "msCodeCom",
+	x509.ExtKeyUsageMicrosoftKernelCodeSigning:     "msKernelCodeSigning",
+}
+
+// extKeyUsageName returns a human readable name for the given extended key
+// usage.
+func extKeyUsageName(u x509.ExtKeyUsage) string {
+	if name, ok := extKeyUsageNames[u]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown(%d)", u)
+}
+
+// issuerExtKeyUsageNames returns the names of the extended key usages of the
+// given issuer, including any unknown extended key usages.
+func issuerExtKeyUsageNames(issuerCert *x509.Certificate) []string {
+	var names []string
+	for _, u := range issuerCert.ExtKeyUsage {
+		names = append(names, extKeyUsageName(u))
+	}
+	for _, oid := range issuerCert.UnknownExtKeyUsage {
+		names = append(names, oid.String())
+	}
+	return names
+}
+
+// validateExtKeyUsageDelegation checks that all of the extended key usages
+// requested by template are permitted by issuerCert.
+// An issuer without an extended key usage extension, or with
+// anyExtendedKeyUsage, does not constrain the usages of certificates it
+// issues.
+func validateExtKeyUsageDelegation(template, issuerCert *x509.Certificate) error {
+	if len(issuerCert.ExtKeyUsage) == 0 && len(issuerCert.UnknownExtKeyUsage) == 0 {
+		return nil
+	}
+
+	allowed := make(map[x509.ExtKeyUsage]bool)
+	for _, u := range issuerCert.ExtKeyUsage {
+		if u == x509.ExtKeyUsageAny {
+			return nil
+		}
+		allowed[u] = true
+	}
+
+	// anyExtendedKeyUsage would allow the certificate to be used for usages
+	// beyond those delegated by the issuer
+	for _, u := range template.ExtKeyUsage {
+		if u == x509.ExtKeyUsageAny {
+			return fmt.Errorf("certificate requests anyExtendedKeyUsage, but its issuer constrains extended key usages to %s, "+
+				"which anyExtendedKeyUsage would escalate beyond", strings.Join(issuerExtKeyUsageNames(issuerCert), ", "))
+		}
+	}
+
+	var disallowed []string
+	for _, u := range template.ExtKeyUsage {
+		if !allowed[u] {
+			disallowed = append(disallowed, extKeyUsageName(u))
+		}
+	}
+	for _, oid := range template.UnknownExtKeyUsage {
+		found := false
+		for _, a := range issuerCert.UnknownExtKeyUsage {
+			if a.Equal(oid) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			disallowed = append(disallowed, oid.String())
+		}
+	}
+
+	if len(disallowed) > 0 {
+		return fmt.Errorf("issuer does not permit extended key usages: %s", strings.Join(disallowed, ", "))
+	}
+	return nil
+}
+
+// extKeyUsageOIDsForCertificate returns the object identifiers of all of the
+// extended key usages set on the given certificate, in order.
+func extKeyUsageOIDsForCertificate(cert *x509.Certificate) ([]asn1.ObjectIdentifier, error) {
+	var oids []asn1.ObjectIdentifier
+	for _, u := range cert.ExtKeyUsage {
+		oid, ok := extKeyUsageOIDs[u]
+		if !ok {
+			return nil, fmt.Errorf("unknown extended key usage: %d", u)
+		}
+		oids = append(oids, oid)
+	}
+	return append(oids, cert.UnknownExtKeyUsage...), nil
+}
+
+type policyInformation struct {
+	Policy asn1.ObjectIdentifier
+}
+
+// MicrosoftApplicationPoliciesExtension builds the Microsoft "Application
+// Policies" extension containing the given policy OIDs.
+// The extension has the same structure as the certificatePolicies extension
+// and conventionally mirrors the extended key usages of the certificate.
+func MicrosoftApplicationPoliciesExtension(policies []asn1.ObjectIdentifier) (pkix.Extension, error) {
+	info := make([]policyInformation, len(policies))
+	for i, p := range policies {
+		info[i] = policyInformation{Policy: p}
+	}
+	value, err := asn1.Marshal(info)
+	if err != nil {
+		return pkix.Extension{}, fmt.Errorf("error encoding application policies extension: %s", err.Error())
+	}
+	return pkix.Extension{
+		Id:    OIDExtensionMicrosoftApplicationPolicies,
+		Value: value,
+	}, nil
+}
+
+// SubjectKeyIdMethod selects how the subject key identifier of a certificate
+// is computed from its public key, as described in RFC 5280 section 4.2.1.2.
+type SubjectKeyIdMethod int
+
+const (
+	// SubjectKeyIdMethodSHA1 uses the full 160-bit SHA-1 hash of the
+	// subjectPublicKey BIT STRING.
+	SubjectKeyIdMethodSHA1 SubjectKeyIdMethod = iota
+
+	// SubjectKeyIdMethodTruncatedSHA1 uses a four-bit type field with the
+	// value 0100, followed by the least significant 60 bits of the SHA-1
+	// hash of the subjectPublicKey BIT STRING.
+	SubjectKeyIdMethodTruncatedSHA1
+)
+
+type subjectPublicKeyInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	PublicKey asn1.BitString
+}
+
+// SubjectKeyId computes the subject key identifier of the given public key
+// using the given method.
+func SubjectKeyId(pub crypto.PublicKey, method SubjectKeyIdMethod) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding public key: %s", err.Error())
+	}
+	var spki subjectPublicKeyInfo
+	if _, err := asn1.Unmarshal(der, &spki); err != nil {
+		return nil, fmt.Errorf("error decoding public key: %s", err.Error())
+	}
+	hash := sha1.Sum(spki.PublicKey.Bytes)
+
+	switch method {
+	case SubjectKeyIdMethodSHA1:
+		return hash[:], nil
+	case SubjectKeyIdMethodTruncatedSHA1:
+		id := make([]byte, 8)
+		copy(id, hash[len(hash)-8:])
+		id[0] = 0x40 | (id[0] & 0x0f)
+		return id, nil
+	default:
+		return nil, fmt.Errorf("unsupported subject key identifier method: %d", method)
+	}
+}
+
+// KeyUsageExtension builds the KeyUsage extension for the given key usages.
+// crypto/x509 always marks the KeyUsage extension it generates as critical, so
+// this is only required to produce a non-critical KeyUsage extension.
+func KeyUsageExtension(usage x509.KeyUsage, critical bool) (pkix.Extension, error) {
+	// the bits of a BIT STRING are numbered from the most significant bit of
+	// the first byte, whereas x509.KeyUsage numbers them from the least
+	// significant bit
+	b := []byte{bits.Reverse8(byte(usage)), bits.Reverse8(byte(usage >> 8))}
+	if b[1] == 0 {
+		b = b[:1]
+	}
+	bitLength := len(b) * 8
+	for bitLength > 0 && b[(bitLength-1)/8]&(0x80>>uint((bitLength-1)%8)) == 0 {
+		bitLength--
+	}
+	value, err := asn1.Marshal(asn1.BitString{Bytes: b, BitLength: bitLength})
+	if err != nil {
+		return pkix.Extension{}, fmt.Errorf("error encoding key usage extension: %s", err.Error())
+	}
+	return pkix.Extension{
+		Id:       OIDExtensionKeyUsage,
+		Critical: critical,
+		Value:    value,
+	}, nil
+}
+
+// ExtKeyUsageExtension builds the ExtendedKeyUsage extension containing the
+// given usages, in the order given, followed by the given unknown usages.
+func ExtKeyUsageExtension(usages []x509.ExtKeyUsage, unknown []asn1.ObjectIdentifier) (pkix.Extension, error) {
+	oids, err := extKeyUsageOIDsForCertificate(&x509.Certificate{ExtKeyUsage: usages, UnknownExtKeyUsage: unknown})
+	if err != nil {
+		return pkix.Extension{}, err
+	}
+	value, err := asn1.Marshal(oids)
+	if err != nil {
+		return pkix.Extension{}, fmt.Errorf("error encoding extended key usage extension: %s", err.Error())
+	}
+	return pkix.Extension{
+		Id:    OIDExtensionExtendedKeyUsage,
+		Value: value,
+	}, nil
+}
+
+// orderExtKeyUsages returns the given usages sorted into the given order.
+// An error is returned if any usage is not present in order.
+func orderExtKeyUsages(usages, order []x509.ExtKeyUsage) ([]x509.ExtKeyUsage, error) {
+	requested := make(map[x509.ExtKeyUsage]bool)
+	for _, u := range usages {
+		requested[u] = true
+	}
+	var ordered []x509.ExtKeyUsage
+	for _, u := range order {
+		if requested[u] {
+			ordered = append(ordered, u)
+			delete(requested, u)
+		}
+	}
+	if len(requested) > 0 {
+		var missing []string
+		for _, u := range usages {
+			if requested[u] {
+				missing = append(missing, extKeyUsageName(u))
+			}
+		}
+		return nil, fmt.Errorf("extended key usage order does not include requested usages: %s", strings.Join(missing, ", "))
+	}
+	return ordered, nil
+}
+
+// applyExtensionOptions will add any extensions to the given template that
+// are requested by the given options.
+// It must be called once all other fields of the template have been set.
+func applyExtensionOptions(template *x509.Certificate, o *templateOptions) error {
+	if o.extKeyUsageOrder != nil && len(template.ExtKeyUsage)+len(template.UnknownExtKeyUsage) > 0 {
+		usages, err := orderExtKeyUsages(template.ExtKeyUsage, o.extKeyUsageOrder)
+		if err != nil {
+			return err
+		}
+		// crypto/x509 will not generate its own ExtendedKeyUsage extension
+		// if one is present in ExtraExtensions
+		ext, err := ExtKeyUsageExtension(usages, template.UnknownExtKeyUsage)
+		if err != nil {
+			return err
+		}
+		template.ExtraExtensions = append(template.ExtraExtensions, ext)
+	}
+	if requiresManualSANExtension(o) || subjectIsEmpty(template) {
+		// crypto/x509 will not generate its own SubjectAltName extension if
+		// one is present in ExtraExtensions. It is added explicitly for an
+		// empty subject so that it is always marked critical.
+		ext, ok, err := subjectAltNameExtension(template, o)
+		if err != nil {
+			return err
+		}
+		if ok {
+			template.ExtraExtensions = append(template.ExtraExtensions, ext)
+		}
+	}
+	if o.keyUsageNonCritical && template.KeyUsage != 0 {
+		// crypto/x509 will not generate its own KeyUsage extension if one
+		// is present in ExtraExtensions
+		ext, err := KeyUsageExtension(template.KeyUsage, false)
+		if err != nil {
+			return err
+		}
+		template.ExtraExtensions = append(template.ExtraExtensions, ext)
+	}
+	if o.microsoftApplicationPolicies {
+		policies, err := extKeyUsageOIDsForCertificate(template)
+		if err != nil {
+			return err
+		}
+		if len(policies) > 0 {
+			ext, err := MicrosoftApplicationPoliciesExtension(policies)
+			if err != nil {
+				return err
+			}
+			template.ExtraExtensions = append(template.ExtraExtensions, ext)
+		}
+	}
+	generated := generatedExtensions(template)
+	for i, ext := range o.customExtensions {
+		if ext.Critical && !o.allowCriticalCustomExts {
+			return fmt.Errorf("custom extension %s is marked critical, but critical custom extensions have not been allowed", ext.Id)
+		}
+		for _, other := range o.customExtensions[:i] {
+			if other.Id.Equal(ext.Id) {
+				return fmt.Errorf("custom extension %s is specified more than once", ext.Id)
+			}
+		}
+		if !containsOID(generated, ext.Id) && !hasExtension(template.ExtraExtensions, ext.Id) {
+			continue
+		}
+		if o.extensionConflictPolicy != ExtensionConflictPreferCustom {
+			return fmt.Errorf("custom extension %s conflicts with an extension generated for the certificate", ext.Id)
+		}
+		// crypto/x509 will not generate an extension that is present in
+		// ExtraExtensions, so only those generated by options are removed
+		template.ExtraExtensions = removeExtension(template.ExtraExtensions, ext.Id)
+	}
+	template.ExtraExtensions = append(template.ExtraExtensions, o.customExtensions...)
+	if o.referenceCert != nil {
+		exts, err := referenceExtensions(template, generated, o)
+		if err != nil {
+			return err
+		}
+		template.ExtraExtensions = append(template.ExtraExtensions, exts...)
+	}
+	return nil
+}
+
+// referenceExtensions returns the extensions of the reference certificate
+// set by WithReferenceExtensions that are to be copied into the given
+// template. Regenerated and excluded extensions are omitted, as are any
+// already present in the ExtraExtensions of the template.
+// An extension that crypto/x509 would generate from the template, given by
+// generated, is handled according to the ExtensionConflictPolicy.
+func referenceExtensions(template *x509.Certificate, generated []asn1.ObjectIdentifier, o *templateOptions) ([]pkix.Extension, error) {
+	var exts []pkix.Extension
+	for _, ext := range o.referenceCert.Extensions {
+		if containsOID(regeneratedExtensions, ext.Id) || containsOID(o.referenceExclusions, ext.Id) {
+			continue
+		}
+		if hasExtension(template.ExtraExtensions, ext.Id) {
+			continue
+		}
+		if containsOID(generated, ext.Id) && o.extensionConflictPolicy != ExtensionConflictPreferCustom {
+			return nil, fmt.Errorf("reference extension %s conflicts with an extension generated for the certificate", ext.Id)
+		}
+		exts = append(exts, ext)
+	}
+	return exts, nil
+}
+
+// generatedExtensions returns the OIDs of the extensions that crypto/x509
+// will generate from the fields of the given template when it is signed by
+// SignCertificate, which always sets a subject key identifier.
+func generatedExtensions(template *x509.Certificate) []asn1.ObjectIdentifier {
+	oids := []asn1.ObjectIdentifier{OIDExtensionSubjectKeyId, OIDExtensionAuthorityKeyId}
+	if template.KeyUsage != 0 {
+		oids = append(oids, OIDExtensionKeyUsage)
+	}
+	if len(template.ExtKeyUsage) > 0 || len(template.UnknownExtKeyUsage) > 0 {
+		oids = append(oids, OIDExtensionExtendedKeyUsage)
+	}
+	if template.BasicConstraintsValid {
+		oids = append(oids, OIDExtensionBasicConstraints)
+	}
+	if len(template.DNSNames) > 0 || len(template.IPAddresses) > 0 || len(template.EmailAddresses) > 0 || len(template.URIs) > 0 {
+		oids = append(oids, OIDExtensionSubjectAltName)
+	}
+	if len(template.CRLDistributionPoints) > 0 {
+		oids = append(oids, OIDExtensionCRLDistributionPoints)
+	}
+	if len(template.OCSPServer) > 0 || len(template.IssuingCertificateURL) > 0 {
+		oids = append(oids, OIDExtensionAuthorityInfoAccess)
+	}
+	if hasNameConstraints(template) {
+		oids = append(oids, OIDExtensionNameConstraints)
+	}
+	if len(template.PolicyIdentifiers) > 0 {
+		oids = append(oids, OIDExtensionCertificatePolicies)
+	}
+	return oids
+}
+
+// hasNameConstraints returns true if crypto/x509 will generate a
+// NameConstraints extension for the given template.
+func hasNameConstraints(template *x509.Certificate) bool {
+	return len(template.PermittedDNSDomains) > 0 || len(template.ExcludedDNSDomains) > 0 ||
+		len(template.PermittedIPRanges) > 0 || len(template.ExcludedIPRanges) > 0 ||
+		len(template.PermittedEmailAddresses) > 0 || len(template.ExcludedEmailAddresses) > 0 ||
+		len(template.PermittedURIDomains) > 0 || len(template.ExcludedURIDomains) > 0
+}
+
+// removeExtension returns exts without any extension with the given id.
+func removeExtension(exts []pkix.Extension, id asn1.ObjectIdentifier) []pkix.Extension {
+	var out []pkix.Extension
+	for _, ext := range exts {
+		if !ext.Id.Equal(id) {
+			out = append(out, ext)
+		}
+	}
+	return out
+}
+
+// hasExtension returns true if exts contains an extension with the given id.
+func hasExtension(exts []pkix.Extension, id asn1.ObjectIdentifier) bool {
+	for _, ext := range exts {
+		if ext.Id.Equal(id) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,507 @@
+/*
+Copyright 2019 The Jetstack cert-manager contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pki
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/pem"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jetstack/cert-manager/pkg/apis/certmanager/v1alpha1"
+)
+
+// findExtension returns the extension with the given OID in exts, or nil if
+// it is not present. The test fails if the extension is present more than
+// once.
+func findExtension(t *testing.T, exts []pkix.Extension, oid asn1.ObjectIdentifier) *pkix.Extension {
+	var found *pkix.Extension
+	for i, ext := range exts {
+		if !ext.Id.Equal(oid) {
+			continue
+		}
+		if found != nil {
+			t.Fatalf("expected at most one %s extension but found more", oid)
+		}
+		found = &exts[i]
+	}
+	return found
+}
+
+// signTestTemplate generates a template for the given Certificate, allows the
+// caller to modify it before extension options are applied, and then signs it.
+func signTestTemplate(t *testing.T, mutate func(*x509.Certificate), opts ...TemplateOption) *x509.Certificate {
+	pk, err := GenerateECPrivateKey(ECCurve256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template, err := GenerateTemplate(nil, buildCertificate("test", "test.example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mutate != nil {
+		mutate(template)
+	}
+	if err := applyExtensionOptions(template, newTemplateOptions(opts)); err != nil {
+		t.Fatalf("error applying extension options: %v", err)
+	}
+	_, cert, err := SignCertificate(template, template, pk.Public(), pk)
+	if err != nil {
+		t.Fatalf("error signing certificate: %v", err)
+	}
+	return cert
+}
+
+func TestMicrosoftApplicationPoliciesExtension(t *testing.T) {
+	ext, err := MicrosoftApplicationPoliciesExtension([]asn1.ObjectIdentifier{extKeyUsageOIDs[x509.ExtKeyUsageClientAuth]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// SEQUENCE { SEQUENCE { OID 1.3.6.1.5.5.7.3.2 } }
+	expected := "300c300a06082b06010505070302"
+	if actual := hex.EncodeToString(ext.Value); actual != expected {
+		t.Errorf("expected extension value %s but got %s", expected, actual)
+	}
+	if ext.Critical {
+		t.Errorf("expected extension to not be critical")
+	}
+}
+
+func TestWithMicrosoftApplicationPolicies(t *testing.T) {
+	smartcardLogon := asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 20, 2, 2}
+	setUsages := func(template *x509.Certificate) {
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+		template.UnknownExtKeyUsage = []asn1.ObjectIdentifier{smartcardLogon}
+	}
+
+	cert := signTestTemplate(t, setUsages)
+	if findExtension(t, cert.Extensions, OIDExtensionMicrosoftApplicationPolicies) != nil {
+		t.Errorf("expected application policies extension to not be present by default")
+	}
+
+	cert = signTestTemplate(t, setUsages, WithMicrosoftApplicationPolicies())
+	ext := findExtension(t, cert.Extensions, OIDExtensionMicrosoftApplicationPolicies)
+	if ext == nil {
+		t.Fatalf("expected application policies extension to be present")
+	}
+	var policies []policyInformation
+	if _, err := asn1.Unmarshal(ext.Value, &policies); err != nil {
+		t.Fatalf("error decoding application policies extension: %v", err)
+	}
+	expected := []asn1.ObjectIdentifier{extKeyUsageOIDs[x509.ExtKeyUsageClientAuth], smartcardLogon}
+	if len(policies) != len(expected) {
+		t.Fatalf("expected %d policies but got %d", len(expected), len(policies))
+	}
+	for i, p := range policies {
+		if !p.Policy.Equal(expected[i]) {
+			t.Errorf("expected policy %d to be %s but got %s", i, expected[i], p.Policy)
+		}
+	}
+	if len(cert.ExtKeyUsage) != 1 || len(cert.UnknownExtKeyUsage) != 1 {
+		t.Errorf("expected standard extended key usage extension to still be present")
+	}
+
+	// no extended key usages means there are no policies to mirror
+	cert = signTestTemplate(t, func(template *x509.Certificate) {
+		template.ExtKeyUsage = nil
+	}, WithMicrosoftApplicationPolicies())
+	if findExtension(t, cert.Extensions, OIDExtensionMicrosoftApplicationPolicies) != nil {
+		t.Errorf("expected application policies extension to not be present without extended key usages")
+	}
+}
+
+func TestKeyUsageExtension(t *testing.T) {
+	// digitalSignature, keyEncipherment and keyCertSign
+	ext, err := KeyUsageExtension(x509.KeyUsageDigitalSignature|x509.KeyUsageKeyEncipherment|x509.KeyUsageCertSign, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// BIT STRING, 2 unused bits, 10100100
+	expected := "030202a4"
+	if actual := hex.EncodeToString(ext.Value); actual != expected {
+		t.Errorf("expected extension value %s but got %s", expected, actual)
+	}
+
+	// decipherOnly is the only usage in the second byte
+	ext, err = KeyUsageExtension(x509.KeyUsageDigitalSignature|x509.KeyUsageDecipherOnly, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = "0303078080"
+	if actual := hex.EncodeToString(ext.Value); actual != expected {
+		t.Errorf("expected extension value %s but got %s", expected, actual)
+	}
+}
+
+func TestWithKeyUsageCritical(t *testing.T) {
+	type testT struct {
+		name           string
+		opts           []TemplateOption
+		expectCritical bool
+	}
+	tests := []testT{
+		{
+			name:           "critical by default",
+			expectCritical: true,
+		},
+		{
+			name:           "explicitly critical",
+			opts:           []TemplateOption{WithKeyUsageCritical(true)},
+			expectCritical: true,
+		},
+		{
+			name:           "non-critical",
+			opts:           []TemplateOption{WithKeyUsageCritical(false)},
+			expectCritical: false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cert := signTestTemplate(t, func(template *x509.Certificate) {
+				template.KeyUsage |= x509.KeyUsageCertSign
+			}, test.opts...)
+			ext := findExtension(t, cert.Extensions, OIDExtensionKeyUsage)
+			if ext == nil {
+				t.Fatalf("expected key usage extension to be present")
+			}
+			if ext.Critical != test.expectCritical {
+				t.Errorf("expected critical to be %t but got %t", test.expectCritical, ext.Critical)
+			}
+			expectedUsage := x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment | x509.KeyUsageCertSign
+			if cert.KeyUsage != expectedUsage {
+				t.Errorf("expected key usage %d but got %d", expectedUsage, cert.KeyUsage)
+			}
+			count := 0
+			for _, e := range cert.Extensions {
+				if e.Id.Equal(OIDExtensionKeyUsage) {
+					count++
+				}
+			}
+			if count != 1 {
+				t.Errorf("expected exactly one key usage extension but got %d", count)
+			}
+		})
+	}
+}
+
+func TestWithCustomExtensions(t *testing.T) {
+	attestation := pkix.Extension{
+		Id:       asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 55555, 1, 1},
+		Critical: true,
+		Value:    []byte{0x04, 0x03, 0x01, 0x02, 0x03},
+	}
+	metadata := pkix.Extension{
+		Id:    asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 55555, 1, 2},
+		Value: []byte{0x0c, 0x02, 'o', 'k'},
+	}
+
+	template, err := GenerateTemplate(nil, buildCertificate("test", "test.example.com"), WithCustomExtensions(attestation, metadata))
+	if err == nil {
+		t.Errorf("expected an error for a critical custom extension without confirmation, got template: %v", template)
+	}
+
+	cert := signTestTemplate(t, nil, WithCustomExtensions(attestation, metadata), WithCriticalCustomExtensions())
+	var found []pkix.Extension
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(attestation.Id) || ext.Id.Equal(metadata.Id) {
+			found = append(found, ext)
+		}
+	}
+	if len(found) != 2 {
+		t.Fatalf("expected 2 custom extensions but got %d", len(found))
+	}
+	for i, expected := range []pkix.Extension{attestation, metadata} {
+		if !found[i].Id.Equal(expected.Id) {
+			t.Errorf("expected extension %d to be %s but got %s", i, expected.Id, found[i].Id)
+		}
+		if found[i].Critical != expected.Critical {
+			t.Errorf("expected extension %s critical to be %t but got %t", expected.Id, expected.Critical, found[i].Critical)
+		}
+		if hex.EncodeToString(found[i].Value) != hex.EncodeToString(expected.Value) {
+			t.Errorf("expected extension %s to have value %x but got %x", expected.Id, expected.Value, found[i].Value)
+		}
+	}
+	if len(cert.UnhandledCriticalExtensions) != 1 || !cert.UnhandledCriticalExtensions[0].Equal(attestation.Id) {
+		t.Errorf("expected %s to be the only unhandled critical extension but got %v", attestation.Id, cert.UnhandledCriticalExtensions)
+	}
+
+	_, err = GenerateTemplate(nil, buildCertificate("test", "test.example.com"), WithCustomExtensions(metadata, metadata))
+	if err == nil {
+		t.Errorf("expected an error for a duplicated custom extension")
+	}
+}
+
+func TestWithExtensionConflictPolicy(t *testing.T) {
+	keyUsage, err := KeyUsageExtension(x509.KeyUsageDigitalSignature, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crt := buildCertificate("test", "test.example.com")
+
+	_, err = GenerateTemplate(nil, crt, WithCustomExtensions(keyUsage), WithCriticalCustomExtensions())
+	if err == nil || !strings.Contains(err.Error(), OIDExtensionKeyUsage.String()) {
+		t.Errorf("expected an error naming %s but got: %v", OIDExtensionKeyUsage, err)
+	}
+	// the non-critical key usage extension is generated in ExtraExtensions
+	_, err = GenerateTemplate(nil, crt, WithKeyUsageCritical(false), WithCustomExtensions(keyUsage), WithCriticalCustomExtensions())
+	if err == nil {
+		t.Errorf("expected an error for a conflict with a generated extra extension")
+	}
+
+	for name, opts := range map[string][]TemplateOption{
+		"generated by crypto/x509": nil,
+		"generated by an option":   {WithKeyUsageCritical(false)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			opts := append(opts, WithCustomExtensions(keyUsage), WithCriticalCustomExtensions(), WithExtensionConflictPolicy(ExtensionConflictPreferCustom))
+			cert := signTestTemplate(t, nil, opts...)
+			count := 0
+			for _, ext := range cert.Extensions {
+				if ext.Id.Equal(OIDExtensionKeyUsage) {
+					count++
+				}
+			}
+			if count != 1 {
+				t.Errorf("expected exactly one key usage extension but got %d", count)
+			}
+			if cert.KeyUsage != x509.KeyUsageDigitalSignature {
+				t.Errorf("expected the custom key usage %d but got %d", x509.KeyUsageDigitalSignature, cert.KeyUsage)
+			}
+		})
+	}
+}
+
+func TestCustomExtensionConflictsWithTemplateFields(t *testing.T) {
+	custom := func(id asn1.ObjectIdentifier) TemplateOption {
+		return WithCustomExtensions(pkix.Extension{Id: id, Value: []byte{0x30, 0x00}})
+	}
+	nameConstraints := buildCACertificate("ca")
+	nameConstraints.Spec.NameConstraints = &v1alpha1.NameConstraints{PermittedDNSDomains: []string{"example.com"}}
+
+	tests := map[string]struct {
+		crt  *v1alpha1.Certificate
+		opts []TemplateOption
+		oid  asn1.ObjectIdentifier
+	}{
+		"crl distribution points": {
+			opts: []TemplateOption{WithCRLDistributionPoints("http://ca.example.com/ca.crl")},
+			oid:  OIDExtensionCRLDistributionPoints,
+		},
+		"authority information access from ocsp servers": {
+			opts: []TemplateOption{WithOCSPServers("http://ocsp.example.com")},
+			oid:  OIDExtensionAuthorityInfoAccess,
+		},
+		"authority information access from issuing certificate urls": {
+			opts: []TemplateOption{WithIssuingCertificateURLs("http://ca.example.com/ca.crt")},
+			oid:  OIDExtensionAuthorityInfoAccess,
+		},
+		"name constraints": {
+			crt: nameConstraints,
+			oid: OIDExtensionNameConstraints,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			crt := test.crt
+			if crt == nil {
+				crt = buildCertificate("test", "test.example.com")
+			}
+			_, err := GenerateTemplate(nil, crt, append(test.opts, custom(test.oid))...)
+			if err == nil || !strings.Contains(err.Error(), test.oid.String()) {
+				t.Errorf("expected an error naming %s but got: %v", test.oid, err)
+			}
+			// without the template field, the extension is not generated
+			if _, err := GenerateTemplate(nil, buildCertificate("test", "test.example.com"), custom(test.oid)); err != nil {
+				t.Errorf("expected no conflict without the generated extension but got: %v", err)
+			}
+		})
+	}
+
+	if !containsOID(generatedExtensions(&x509.Certificate{PolicyIdentifiers: []asn1.ObjectIdentifier{{2, 23, 140, 1, 2, 1}}}), OIDExtensionCertificatePolicies) {
+		t.Errorf("expected certificate policies to be generated from the policy identifiers")
+	}
+}
+
+func TestWithReferenceExtensions(t *testing.T) {
+	metadata := pkix.Extension{
+		Id:    asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 55555, 1, 2},
+		Value: []byte{0x0c, 0x02, 'o', 'k'},
+	}
+	ref := signTestTemplate(t, nil, WithCustomExtensions(metadata))
+
+	pk, err := GenerateECPrivateKey(ECCurve256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := buildCertificate("other", "other.example.com")
+	other.Spec.Usages = []v1alpha1.KeyUsage{v1alpha1.UsageDigitalSignature, v1alpha1.UsageClientAuth}
+
+	// the key usages of the reference certificate conflict with those
+	// generated from the spec
+	_, err = GenerateTemplate(nil, other, WithReferenceExtensions(ref, OIDExtensionSubjectAltName))
+	if err == nil || !strings.Contains(err.Error(), "reference extension") {
+		t.Errorf("expected an error for a reference extension conflicting with a generated extension but got: %v", err)
+	}
+
+	template, err := GenerateTemplate(nil, other, WithReferenceExtensions(ref, OIDExtensionSubjectAltName), WithExtensionConflictPolicy(ExtensionConflictPreferCustom))
+	if err != nil {
+		t.Fatalf("error generating template: %v", err)
+	}
+	_, cert, err := SignCertificate(template, template, pk.Public(), pk)
+	if err != nil {
+		t.Fatalf("error signing certificate: %v", err)
+	}
+
+	ext := findExtension(t, cert.Extensions, metadata.Id)
+	if ext == nil {
+		t.Fatalf("expected extension %s to be copied from the reference certificate", metadata.Id)
+	}
+	if hex.EncodeToString(ext.Value) != hex.EncodeToString(metadata.Value) {
+		t.Errorf("expected extension %s to have value %x but got %x", metadata.Id, metadata.Value, ext.Value)
+	}
+	expectedDNSNames := []string{"other", "other.example.com"}
+	if !reflect.DeepEqual(cert.DNSNames, expectedDNSNames) {
+		t.Errorf("expected excluded subject alt names to be regenerated as %v but got %v", expectedDNSNames, cert.DNSNames)
+	}
+	if cert.KeyUsage != ref.KeyUsage || !reflect.DeepEqual(cert.ExtKeyUsage, ref.ExtKeyUsage) {
+		t.Errorf("expected the key usages %d and %v of the reference certificate but got %d and %v", ref.KeyUsage, ref.ExtKeyUsage, cert.KeyUsage, cert.ExtKeyUsage)
+	}
+	if bytes.Equal(cert.SubjectKeyId, ref.SubjectKeyId) {
+		t.Errorf("expected the subject key identifier to be regenerated")
+	}
+
+	// excluding the generated extensions copies only the others
+	template, err = GenerateTemplate(nil, other, WithReferenceExtensions(ref, OIDExtensionSubjectAltName, OIDExtensionKeyUsage, OIDExtensionExtendedKeyUsage))
+	if err != nil {
+		t.Fatalf("error generating template: %v", err)
+	}
+	if !hasExtension(template.ExtraExtensions, metadata.Id) || hasExtension(template.ExtraExtensions, OIDExtensionKeyUsage) {
+		t.Errorf("expected only the non-generated reference extensions to be copied but got %v", template.ExtraExtensions)
+	}
+	seen := map[string]bool{}
+	for _, ext := range cert.Extensions {
+		if seen[ext.Id.String()] {
+			t.Errorf("expected extension %s to appear once", ext.Id)
+		}
+		seen[ext.Id.String()] = true
+	}
+}
+
+func TestSubjectKeyId(t *testing.T) {
+	block, _ := pem.Decode([]byte(`-----BEGIN PUBLIC KEY-----
+MFkwEwYHKoZIzj0CAQYIKoZIzj0DAQcDQgAEVSWJxlAfDmd31rQSEDX8zvsMwoS4
+QQCVppPfLcPO9IIhXjmnZxf6RZ76m1Eo9oRVhqN+ZbTPn0e316BOx7aWAw==
+-----END PUBLIC KEY-----
+`))
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	type testT struct {
+		name     string
+		method   SubjectKeyIdMethod
+		expected string
+	}
+	tests := []testT{
+		{
+			name:     "method 1",
+			method:   SubjectKeyIdMethodSHA1,
+			expected: "2fea12d615bb371d8b41778a670d5ed294b77bd8",
+		},
+		{
+			name:     "method 2",
+			method:   SubjectKeyIdMethodTruncatedSHA1,
+			expected: "470d5ed294b77bd8",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ski, err := SubjectKeyId(pub, test.method)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if actual := hex.EncodeToString(ski); actual != test.expected {
+				t.Errorf("expected subject key id %s but got %s", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestWithSubjectKeyIdMethod(t *testing.T) {
+	pk, err := GenerateECPrivateKey(ECCurve256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, method := range []SubjectKeyIdMethod{SubjectKeyIdMethodSHA1, SubjectKeyIdMethodTruncatedSHA1} {
+		expected, err := SubjectKeyId(pk.Public(), method)
+		if err != nil {
+			t.Fatal(err)
+		}
+		template, err := GenerateTemplate(nil, buildCACertificate("ca"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, cert, err := SignCertificate(template, template, pk.Public(), pk, WithSubjectKeyIdMethod(method))
+		if err != nil {
+			t.Fatalf("error signing certificate: %v", err)
+		}
+		if !bytes.Equal(cert.SubjectKeyId, expected) {
+			t.Errorf("expected subject key id %x but got %x", expected, cert.SubjectKeyId)
+		}
+		if len(cert.AuthorityKeyId) > 0 && !bytes.Equal(cert.AuthorityKeyId, expected) {
+			t.Errorf("expected self signed authority key id %x to match subject key id %x", cert.AuthorityKeyId, expected)
+		}
+		if len(template.SubjectKeyId) != 0 {
+			t.Errorf("expected template to not be modified")
+		}
+	}
+}
+
+func TestWithExtKeyUsageOrder(t *testing.T) {
+	setUsages := func(template *x509.Certificate) {
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth}
+	}
+	cert := signTestTemplate(t, setUsages, WithExtKeyUsageOrder(x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageCodeSigning, x509.ExtKeyUsageClientAuth))
+
+	ext := findExtension(t, cert.Extensions, OIDExtensionExtendedKeyUsage)
+	if ext == nil {
+		t.Fatalf("expected extended key usage extension to be present")
+	}
+	// SEQUENCE { OID serverAuth, OID clientAuth }
+	expected := "301406082b0601050507030106082b06010505070302"
+	if actual := hex.EncodeToString(ext.Value); actual != expected {
+		t.Errorf("expected extension value %s but got %s", expected, actual)
+	}
+	if len(cert.ExtKeyUsage) != 2 || cert.ExtKeyUsage[0] != x509.ExtKeyUsageServerAuth || cert.ExtKeyUsage[1] != x509.ExtKeyUsageClientAuth {
+		t.Errorf("expected extended key usages to be serverAuth, clientAuth but got %v", cert.ExtKeyUsage)
+	}
+
+	template, err := GenerateTemplate(nil, buildCertificate("test", "test.example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	setUsages(template)
+	err = applyExtensionOptions(template, newTemplateOptions([]TemplateOption{WithExtKeyUsageOrder(x509.ExtKeyUsageServerAuth)}))
+	if err == nil {
+		t.Errorf("expected an error when the order does not include all requested usages")
+	}
+}
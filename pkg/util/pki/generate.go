@@ -17,8 +17,10 @@ limitations under the License.
 package pki
 
 import (
+	"bytes"
 	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
@@ -27,6 +29,7 @@ import (
 	"fmt"
 
 	"github.com/jetstack/cert-manager/pkg/apis/certmanager/v1alpha1"
+	"github.com/jetstack/cert-manager/pkg/util/errors"
 )
 
 const (
@@ -35,7 +38,8 @@ const (
 	MinRSAKeySize = 2048
 
 	// MaxRSAKeySize is the maximum RSA keysize allowed to be generated by the
-	// generator functions in this package.
+	// generator functions in this package, or requested by a Certificate.
+	// Larger keys are slow enough to generate that they would stall issuance.
 	MaxRSAKeySize = 8192
 
 	// ECCurve256 represents a 256bit ECDSA key.
@@ -49,13 +53,22 @@ const (
 // GeneratePrivateKeyForCertificate will generate a private key suitable for
 // the provided cert-manager Certificate resource, taking into account the
 // parameters on the provided resource.
-// The returned key will either be RSA or ECDSA.
+// The returned key will be RSA, ECDSA or Ed25519, with the same defaults as
+// SignatureAlgorithm: an RSA key of MinRSAKeySize bits if no algorithm or
+// size is set, and a P-256 key if the algorithm is ecdsa and no size is set.
+// The algorithm and key size are validated as by SignatureAlgorithm, so that
+// invalid combinations return the same error.
 func GeneratePrivateKeyForCertificate(crt *v1alpha1.Certificate) (crypto.Signer, error) {
+	if _, _, err := SignatureAlgorithm(crt); err != nil {
+		return nil, err
+	}
+
 	switch crt.Spec.KeyAlgorithm {
 	case v1alpha1.KeyAlgorithm(""), v1alpha1.RSAKeyAlgorithm:
 		keySize := MinRSAKeySize
 
-		if crt.Spec.KeySize > 0 {
+		// 0 == not set
+		if crt.Spec.KeySize != 0 {
 			keySize = crt.Spec.KeySize
 		}
 
@@ -63,13 +76,19 @@ func GeneratePrivateKeyForCertificate(crt *v1alpha1.Certificate) (crypto.Signer,
 	case v1alpha1.ECDSAKeyAlgorithm:
 		keySize := ECCurve256
 
-		if crt.Spec.KeySize > 0 {
+		if crt.Spec.KeySize != 0 {
 			keySize = crt.Spec.KeySize
 		}
 
 		return GenerateECPrivateKey(keySize)
+	case v1alpha1.Ed25519KeyAlgorithm:
+		_, pk, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("error generating ed25519 private key: %s", err.Error())
+		}
+		return pk, nil
 	default:
-		return nil, fmt.Errorf("unsupported private key algorithm specified: %s", crt.Spec.KeyAlgorithm)
+		return nil, fmt.Errorf("unsupported algorithm specified: %s. should be one of 'rsa', 'ecdsa' or 'ed25519'", crt.Spec.KeyAlgorithm)
 	}
 }
 
@@ -79,10 +98,10 @@ func GenerateRSAPrivateKey(keySize int) (*rsa.PrivateKey, error) {
 	// Do not allow keySize < 2048
 	// https://en.wikipedia.org/wiki/Key_size#cite_note-twirl-14
 	if keySize < MinRSAKeySize {
-		return nil, fmt.Errorf("weak rsa key size specified: %d. minimum key size: %d", keySize, MinRSAKeySize)
+		return nil, fmt.Errorf("unsupported rsa keysize specified: %d. min keysize %d", keySize, MinRSAKeySize)
 	}
 	if keySize > MaxRSAKeySize {
-		return nil, fmt.Errorf("rsa key size specified too big: %d. maximum key size: %d", keySize, MaxRSAKeySize)
+		return nil, fmt.Errorf("unsupported rsa keysize specified: %d. max keysize %d", keySize, MaxRSAKeySize)
 	}
 
 	return rsa.GenerateKey(rand.Reader, keySize)
@@ -101,21 +120,68 @@ func GenerateECPrivateKey(keySize int) (*ecdsa.PrivateKey, error) {
 	case ECCurve521:
 		ecCurve = elliptic.P521()
 	default:
-		return nil, fmt.Errorf("unsupported ecdsa key size specified: %d", keySize)
+		return nil, fmt.Errorf("unsupported ecdsa keysize specified: %d", keySize)
 	}
 
 	return ecdsa.GenerateKey(ecCurve, rand.Reader)
 }
 
+// allowedRSAPublicExponents are the public exponents ValidateRSAKey accepts.
+var allowedRSAPublicExponents = []int{3, 65537}
+
+// ValidateRSAKey will check that the given RSA private key is well formed and
+// safe to use: the modulus must be at least MinRSAKeySize bits, the public
+// exponent must be 3 or 65537, and the key must pass rsa.PrivateKey.Validate.
+func ValidateRSAKey(key *rsa.PrivateKey) error {
+	if key.N == nil || key.N.BitLen() < MinRSAKeySize {
+		return fmt.Errorf("rsa key modulus must be at least %d bits", MinRSAKeySize)
+	}
+	allowed := false
+	for _, e := range allowedRSAPublicExponents {
+		if key.E == e {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return fmt.Errorf("rsa key public exponent %d is not permitted, must be one of %v", key.E, allowedRSAPublicExponents)
+	}
+	if err := key.Validate(); err != nil {
+		return fmt.Errorf("invalid rsa key: %s", err.Error())
+	}
+	return nil
+}
+
+// ValidateECDSAKey will check that the public point of the given ECDSA
+// private key is on its curve, and that it corresponds to the private
+// scalar.
+func ValidateECDSAKey(key *ecdsa.PrivateKey) error {
+	if key.Curve == nil || key.X == nil || key.Y == nil || key.D == nil {
+		return fmt.Errorf("ecdsa key is incomplete")
+	}
+	if !key.Curve.IsOnCurve(key.X, key.Y) {
+		return fmt.Errorf("ecdsa key public point is not on curve %s", key.Curve.Params().Name)
+	}
+	x, y := key.Curve.ScalarBaseMult(key.D.Bytes())
+	if x.Cmp(key.X) != 0 || y.Cmp(key.Y) != 0 {
+		return fmt.Errorf("ecdsa key public point does not match private key")
+	}
+	return nil
+}
+
 // EncodePrivateKey will encode a given crypto.PrivateKey by first inspecting
 // the type of key provided.
-// It only supports encoding RSA or ECDSA keys.
+// RSA keys are encoded as PKCS#1 in an "RSA PRIVATE KEY" block, ECDSA keys
+// as SEC 1 in an "EC PRIVATE KEY" block, and Ed25519 keys as PKCS#8 in a
+// "PRIVATE KEY" block. The result can be decoded by DecodePrivateKeyBytes.
 func EncodePrivateKey(pk crypto.PrivateKey) ([]byte, error) {
 	switch k := pk.(type) {
 	case *rsa.PrivateKey:
 		return EncodePKCS1PrivateKey(k), nil
 	case *ecdsa.PrivateKey:
 		return EncodeECPrivateKey(k)
+	case ed25519.PrivateKey:
+		return EncodePKCS8PrivateKey(k)
 	default:
 		return nil, fmt.Errorf("error encoding private key: unknown key type: %T", pk)
 	}
@@ -128,7 +194,23 @@ func EncodePKCS1PrivateKey(pk *rsa.PrivateKey) []byte {
 	return pem.EncodeToMemory(block)
 }
 
+// EncodePrivateKeyForCertificate will encode the given private key with the
+// KeyEncoding of the given Certificate resource: as for EncodePrivateKey if
+// it is empty or PKCS1, and as for EncodePKCS8PrivateKey if it is PKCS8.
+func EncodePrivateKeyForCertificate(crt *v1alpha1.Certificate, pk crypto.PrivateKey) ([]byte, error) {
+	switch crt.Spec.KeyEncoding {
+	case v1alpha1.KeyEncoding(""), v1alpha1.PKCS1:
+		return EncodePrivateKey(pk)
+	case v1alpha1.PKCS8:
+		return EncodePKCS8PrivateKey(pk)
+	default:
+		return nil, fmt.Errorf("error encoding private key: unsupported key encoding: %s", crt.Spec.KeyEncoding)
+	}
+}
+
 // EncodePKCS8PrivateKey will marshal a private key into x509 PEM format.
+// The key is always encoded as PKCS#8 in a "PRIVATE KEY" block, whatever its
+// algorithm, for consumers such as Java keystores that require it.
 func EncodePKCS8PrivateKey(pk interface{}) ([]byte, error) {
 	keyBytes, err := x509.MarshalPKCS8PrivateKey(pk)
 	if err != nil {
@@ -151,13 +233,15 @@ func EncodeECPrivateKey(pk *ecdsa.PrivateKey) ([]byte, error) {
 }
 
 // PublicKeyForPrivateKey will return the crypto.PublicKey for the given
-// crypto.PrivateKey. It only supports RSA and ECDSA keys.
+// crypto.PrivateKey. It only supports RSA, ECDSA and Ed25519 keys.
 func PublicKeyForPrivateKey(pk crypto.PrivateKey) (crypto.PublicKey, error) {
 	switch k := pk.(type) {
 	case *rsa.PrivateKey:
 		return k.Public(), nil
 	case *ecdsa.PrivateKey:
 		return k.Public(), nil
+	case ed25519.PrivateKey:
+		return k.Public(), nil
 	default:
 		return nil, fmt.Errorf("unknown private key type: %T", pk)
 	}
@@ -168,31 +252,14 @@ func PublicKeyForPrivateKey(pk crypto.PrivateKey) (crypto.PublicKey, error) {
 // It will return false and no error if the public key is *not* valid for the
 // given Certificate.
 // It will return true if the public key *is* valid for the given Certificate.
-// It will return an error if either of the passed parameters are of an
-// unrecognised type (i.e. non RSA/ECDSA)
+// It will return an error for which errors.IsUnsupportedKeyType is true if
+// the public key of the Certificate is of an unrecognised type (i.e. non
+// RSA/ECDSA/Ed25519)
 func PublicKeyMatchesCertificate(check crypto.PublicKey, crt *x509.Certificate) (bool, error) {
-	switch pub := crt.PublicKey.(type) {
-	case *rsa.PublicKey:
-		rsaCheck, ok := check.(*rsa.PublicKey)
-		if !ok {
-			return false, nil
-		}
-		if pub.N.Cmp(rsaCheck.N) != 0 {
-			return false, nil
-		}
-		return true, nil
-	case *ecdsa.PublicKey:
-		ecdsaCheck, ok := check.(*ecdsa.PublicKey)
-		if !ok {
-			return false, nil
-		}
-		if pub.X.Cmp(ecdsaCheck.X) != 0 || pub.Y.Cmp(ecdsaCheck.Y) != 0 {
-			return false, nil
-		}
-		return true, nil
-	default:
-		return false, fmt.Errorf("unrecognised Certificate public key type")
+	if !isSupportedPublicKey(crt.PublicKey) {
+		return false, errors.NewUnsupportedKeyType("unrecognised Certificate public key type: %T", crt.PublicKey)
 	}
+	return PublicKeysEqual(check, crt.PublicKey), nil
 }
 
 // PublicKeyMatchesCSR can be used to verify the given public key is the correct
@@ -200,29 +267,71 @@ func PublicKeyMatchesCertificate(check crypto.PublicKey, crt *x509.Certificate)
 // It will return false and no error if the public key is *not* valid for the
 // given CertificateRequest.
 // It will return true if the public key *is* valid for the given CertificateRequest.
-// It will return an error if either of the passed parameters are of an
-// unrecognised type (i.e. non RSA/ECDSA)
+// It will return an error for which errors.IsUnsupportedKeyType is true if
+// the public key of the CertificateRequest is of an unrecognised type (i.e.
+// non RSA/ECDSA/Ed25519)
 func PublicKeyMatchesCSR(check crypto.PublicKey, csr *x509.CertificateRequest) (bool, error) {
-	switch pub := csr.PublicKey.(type) {
+	if !isSupportedPublicKey(csr.PublicKey) {
+		return false, errors.NewUnsupportedKeyType("unrecognised CertificateRequest public key type: %T", csr.PublicKey)
+	}
+	return PublicKeysEqual(check, csr.PublicKey), nil
+}
+
+// PrivateKeyMatchesPublicKey can be used to verify that the given private
+// key is the counter-part to the given public key, e.g. that a stored private
+// key still matches a Certificate before it is used for signing.
+// It will return false and no error if the keys do not match, including if
+// they are of different types.
+// It will return true if the keys match.
+// It will return an error for which errors.IsUnsupportedKeyType is true if
+// either key is of an unrecognised type (i.e. non RSA/ECDSA/Ed25519)
+func PrivateKeyMatchesPublicKey(pk crypto.PrivateKey, pub crypto.PublicKey) (bool, error) {
+	if !isSupportedPublicKey(pub) {
+		return false, errors.NewUnsupportedKeyType("unrecognised public key type: %T", pub)
+	}
+	derived, err := PublicKeyForPrivateKey(pk)
+	if err != nil {
+		return false, errors.NewUnsupportedKeyType("unrecognised private key type: %T", pk)
+	}
+	return PublicKeysEqual(derived, pub), nil
+}
+
+// isSupportedPublicKey returns true if the given public key is an RSA, ECDSA
+// or Ed25519 key.
+func isSupportedPublicKey(pub crypto.PublicKey) bool {
+	switch pub.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey, ed25519.PublicKey:
+		return true
+	default:
+		return false
+	}
+}
+
+// PublicKeysEqual returns true if the two given public keys are equal.
+// RSA, ECDSA and Ed25519 public keys are supported. Keys of differing or
+// unrecognised types are never equal.
+func PublicKeysEqual(a, b crypto.PublicKey) bool {
+	switch pubA := a.(type) {
 	case *rsa.PublicKey:
-		rsaCheck, ok := check.(*rsa.PublicKey)
-		if !ok {
-			return false, nil
+		pubB, ok := b.(*rsa.PublicKey)
+		if !ok || pubA == nil || pubB == nil {
+			return false
 		}
-		if pub.N.Cmp(rsaCheck.N) != 0 {
-			return false, nil
-		}
-		return true, nil
+		return pubA.N.Cmp(pubB.N) == 0 && pubA.E == pubB.E
 	case *ecdsa.PublicKey:
-		ecdsaCheck, ok := check.(*ecdsa.PublicKey)
-		if !ok {
-			return false, nil
+		pubB, ok := b.(*ecdsa.PublicKey)
+		if !ok || pubA == nil || pubB == nil {
+			return false
 		}
-		if pub.X.Cmp(ecdsaCheck.X) != 0 || pub.Y.Cmp(ecdsaCheck.Y) != 0 {
-			return false, nil
+		return pubA.Curve.Params().Name == pubB.Curve.Params().Name &&
+			pubA.X.Cmp(pubB.X) == 0 && pubA.Y.Cmp(pubB.Y) == 0
+	case ed25519.PublicKey:
+		pubB, ok := b.(ed25519.PublicKey)
+		if !ok {
+			return false
 		}
-		return true, nil
+		return bytes.Equal(pubA, pubB)
 	default:
-		return false, fmt.Errorf("unrecognised Certificate public key type")
+		return false
 	}
 }
@@ -19,17 +19,20 @@ package pki
 import (
 	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"fmt"
+	"math/big"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/jetstack/cert-manager/pkg/apis/certmanager/v1alpha1"
+	"github.com/jetstack/cert-manager/pkg/util/errors"
 )
 
 func buildCertificateWithKeyParams(keyAlgo v1alpha1.KeyAlgorithm, keySize int) *v1alpha1.Certificate {
@@ -71,28 +74,42 @@ func TestGeneratePrivateKeyForCertificate(t *testing.T) {
 			keyAlgo:      v1alpha1.RSAKeyAlgorithm,
 			keySize:      1024,
 			expectErr:    true,
-			expectErrStr: "weak rsa key size specified",
+			expectErrStr: "unsupported rsa keysize specified: 1024. min keysize 2048",
 		},
 		{
 			name:         "rsa key with too big keysize (> 8192)",
 			keyAlgo:      v1alpha1.RSAKeyAlgorithm,
 			keySize:      8196,
 			expectErr:    true,
-			expectErrStr: "rsa key size specified too big",
+			expectErrStr: "unsupported rsa keysize specified: 8196. max keysize 8192",
 		},
 		{
 			name:         "ecdsa key with unsupported keysize",
 			keyAlgo:      v1alpha1.ECDSAKeyAlgorithm,
 			keySize:      100,
 			expectErr:    true,
-			expectErrStr: "unsupported ecdsa key size specified",
+			expectErrStr: "unsupported ecdsa keysize specified",
+		},
+		{
+			name:         "rsa key with negative keysize",
+			keyAlgo:      v1alpha1.RSAKeyAlgorithm,
+			keySize:      -1,
+			expectErr:    true,
+			expectErrStr: "unsupported rsa keysize specified: -1. min keysize 2048",
+		},
+		{
+			name:         "ecdsa key with negative keysize",
+			keyAlgo:      v1alpha1.ECDSAKeyAlgorithm,
+			keySize:      -1,
+			expectErr:    true,
+			expectErrStr: "unsupported ecdsa keysize specified",
 		},
 		{
 			name:         "unsupported key algo specified",
 			keyAlgo:      v1alpha1.KeyAlgorithm("blahblah"),
 			keySize:      256,
 			expectErr:    true,
-			expectErrStr: "unsupported private key algorithm specified",
+			expectErrStr: "unsupported algorithm specified",
 		},
 		{
 			name:      "rsa key with keysize 2048",
@@ -130,6 +147,12 @@ func TestGeneratePrivateKeyForCertificate(t *testing.T) {
 			keySize:   2048,
 			expectErr: false,
 		},
+		{
+			name:      "larger key size with key algorithm not specified",
+			keyAlgo:   v1alpha1.KeyAlgorithm(""),
+			keySize:   4096,
+			expectErr: false,
+		},
 		{
 			name:      "rsa with keysize not specified",
 			keyAlgo:   v1alpha1.RSAKeyAlgorithm,
@@ -140,11 +163,18 @@ func TestGeneratePrivateKeyForCertificate(t *testing.T) {
 			keyAlgo:   v1alpha1.ECDSAKeyAlgorithm,
 			expectErr: false,
 		},
+		{
+			name:      "ed25519 with keysize ignored",
+			keyAlgo:   v1alpha1.Ed25519KeyAlgorithm,
+			keySize:   256,
+			expectErr: false,
+		},
 	}
 
 	testFn := func(test testT) func(*testing.T) {
 		return func(t *testing.T) {
-			privateKey, err := GeneratePrivateKeyForCertificate(buildCertificateWithKeyParams(test.keyAlgo, test.keySize))
+			crt := buildCertificateWithKeyParams(test.keyAlgo, test.keySize)
+			privateKey, err := GeneratePrivateKeyForCertificate(crt)
 			if test.expectErr {
 				if err == nil {
 					t.Error("expected err, but got no error")
@@ -163,6 +193,23 @@ func TestGeneratePrivateKeyForCertificate(t *testing.T) {
 					return
 				}
 
+				// the key must match the signature algorithm chosen for
+				// the certificate
+				expectedKeyType, expectedSigAlgo, err := SignatureAlgorithm(crt)
+				if err != nil {
+					t.Errorf("unexpected error determining signature algorithm: %v", err)
+					return
+				}
+				keyType, sigAlgo, err := SignatureAlgorithmForKey(privateKey.Public())
+				if err != nil {
+					t.Errorf("unexpected error determining signature algorithm for key: %v", err)
+					return
+				}
+				if keyType != expectedKeyType || sigAlgo != expectedSigAlgo {
+					t.Errorf("expected key for %v/%v, but got %v/%v", expectedKeyType, expectedSigAlgo, keyType, sigAlgo)
+					return
+				}
+
 				if test.keyAlgo == "rsa" {
 					// For rsa algorithm, if keysize is not provided, the default of 2048 will be used
 					expectedRsaKeySize := 2048
@@ -213,6 +260,17 @@ func TestGeneratePrivateKeyForCertificate(t *testing.T) {
 						return
 					}
 				}
+
+				if test.keyAlgo == "ed25519" {
+					if _, ok := privateKey.(ed25519.PrivateKey); !ok {
+						t.Errorf("expected ed25519 private key, but got %T", privateKey)
+						return
+					}
+					if _, err := EncodePrivateKey(privateKey); err != nil {
+						t.Errorf("error encoding ed25519 private key: %v", err)
+						return
+					}
+				}
 			}
 		}
 	}
@@ -283,6 +341,89 @@ func TestPublicKeyMatchesCertificate(t *testing.T) {
 	}
 }
 
+func TestPublicKeyMatchesCertificateEd25519(t *testing.T) {
+	pub, pk, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template, err := GenerateTemplateWithKey(nil, buildCertificate("test"), pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, cert, err := SignCertificate(template, template, pub, pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if matches, err := PublicKeyMatchesCertificate(pub, cert); err != nil || !matches {
+		t.Errorf("expected public key to match certificate, but got %t and error: %v", matches, err)
+	}
+	if matches, err := PublicKeyMatchesCertificate(otherPub, cert); err != nil || matches {
+		t.Errorf("expected public key to not match certificate, but got %t and error: %v", matches, err)
+	}
+	cert.PublicKey = struct{}{}
+	if _, err := PublicKeyMatchesCertificate(pub, cert); !errors.IsUnsupportedKeyType(err) {
+		t.Errorf("expected an unsupported key type error, but got: %v", err)
+	}
+}
+
+func TestPrivateKeyMatchesPublicKey(t *testing.T) {
+	rsaKey, err := GenerateRSAPrivateKey(2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := GenerateECPrivateKey(ECCurve256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherECKey, err := GenerateECPrivateKey(ECCurve256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type testT struct {
+		name              string
+		pk                crypto.PrivateKey
+		pub               crypto.PublicKey
+		expect            bool
+		expectUnsupported bool
+	}
+	tests := []testT{
+		{name: "rsa", pk: rsaKey, pub: rsaKey.Public(), expect: true},
+		{name: "ecdsa", pk: ecKey, pub: ecKey.Public(), expect: true},
+		{name: "ed25519", pk: edKey, pub: edKey.Public(), expect: true},
+		{name: "different ecdsa keys", pk: ecKey, pub: otherECKey.Public()},
+		{name: "different key types", pk: rsaKey, pub: edKey.Public()},
+		{name: "unsupported private key", pk: "not a key", pub: ecKey.Public(), expectUnsupported: true},
+		{name: "unsupported public key", pk: ecKey, pub: "not a key", expectUnsupported: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			matches, err := PrivateKeyMatchesPublicKey(test.pk, test.pub)
+			if test.expectUnsupported {
+				if !errors.IsUnsupportedKeyType(err) {
+					t.Errorf("expected an unsupported key type error, but got: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, but got: %v", err)
+			}
+			if matches != test.expect {
+				t.Errorf("expected %t but got %t", test.expect, matches)
+			}
+		})
+	}
+}
+
 func TestPublicKeyMatchesCertificateRequest(t *testing.T) {
 	privKey1, err := GenerateRSAPrivateKey(2048)
 	if err != nil {
@@ -335,3 +476,150 @@ func TestPublicKeyMatchesCertificateRequest(t *testing.T) {
 		t.Errorf("expected private key to not match certificate, but it did")
 	}
 }
+
+func TestPublicKeysEqual(t *testing.T) {
+	rsaKey1, err := GenerateRSAPrivateKey(MinRSAKeySize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey2, err := GenerateRSAPrivateKey(MinRSAKeySize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey1, err := GenerateECPrivateKey(ECCurve256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey2, err := GenerateECPrivateKey(ECCurve256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPub1, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPub2, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a copy of the first RSA key with a different public exponent
+	rsaOtherExponent := &rsa.PublicKey{N: rsaKey1.N, E: 3}
+	// a copy of the first ECDSA key's point, but on a different curve
+	ecOtherCurve := &ecdsa.PublicKey{Curve: elliptic.P384(), X: ecKey1.X, Y: ecKey1.Y}
+
+	type testT struct {
+		name   string
+		a, b   crypto.PublicKey
+		expect bool
+	}
+	tests := []testT{
+		{name: "equal rsa keys", a: rsaKey1.Public(), b: &rsaKey1.PublicKey, expect: true},
+		{name: "unequal rsa keys", a: rsaKey1.Public(), b: rsaKey2.Public()},
+		{name: "rsa keys with differing exponents", a: rsaKey1.Public(), b: rsaOtherExponent},
+		{name: "equal ecdsa keys", a: ecKey1.Public(), b: &ecKey1.PublicKey, expect: true},
+		{name: "unequal ecdsa keys", a: ecKey1.Public(), b: ecKey2.Public()},
+		{name: "ecdsa keys on differing curves", a: ecKey1.Public(), b: ecOtherCurve},
+		{name: "equal ed25519 keys", a: edPub1, b: append(ed25519.PublicKey{}, edPub1...), expect: true},
+		{name: "unequal ed25519 keys", a: edPub1, b: edPub2},
+		{name: "rsa and ecdsa keys", a: rsaKey1.Public(), b: ecKey1.Public()},
+		{name: "ecdsa and ed25519 keys", a: ecKey1.Public(), b: edPub1},
+		{name: "ed25519 and rsa keys", a: edPub1, b: rsaKey1.Public()},
+		{name: "nil keys", a: nil, b: nil},
+		{name: "unrecognised key type", a: "not a key", b: "not a key"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if actual := PublicKeysEqual(test.a, test.b); actual != test.expect {
+				t.Errorf("expected %t but got %t", test.expect, actual)
+			}
+		})
+	}
+}
+
+func TestValidateRSAKey(t *testing.T) {
+	key, err := GenerateRSAPrivateKey(MinRSAKeySize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// tamper with a copy of the key, leaving the original untouched
+	tamper := func(f func(k *rsa.PrivateKey)) *rsa.PrivateKey {
+		k := *key
+		k.N = new(big.Int).Set(key.N)
+		f(&k)
+		return &k
+	}
+	weakKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type testT struct {
+		name        string
+		key         *rsa.PrivateKey
+		expectedErr bool
+	}
+	tests := []testT{
+		{
+			name: "valid key",
+			key:  key,
+		},
+		{
+			name:        "tampered modulus",
+			key:         tamper(func(k *rsa.PrivateKey) { k.N.Add(k.N, big.NewInt(2)) }),
+			expectedErr: true,
+		},
+		{
+			name:        "public exponent of 1",
+			key:         tamper(func(k *rsa.PrivateKey) { k.E = 1 }),
+			expectedErr: true,
+		},
+		{
+			name:        "even public exponent",
+			key:         tamper(func(k *rsa.PrivateKey) { k.E = 65536 }),
+			expectedErr: true,
+		},
+		{
+			name:        "modulus too small",
+			key:         weakKey,
+			expectedErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := ValidateRSAKey(test.key)
+			if err != nil && !test.expectedErr {
+				t.Errorf("expected no error but got: %v", err)
+			}
+			if err == nil && test.expectedErr {
+				t.Errorf("expected an error but got none")
+			}
+		})
+	}
+}
+
+func TestValidateECDSAKey(t *testing.T) {
+	key, err := GenerateECPrivateKey(ECCurve256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateECDSAKey(key); err != nil {
+		t.Errorf("expected no error but got: %v", err)
+	}
+
+	offCurve := *key
+	offCurve.Y = new(big.Int).Add(key.Y, big.NewInt(1))
+	if err := ValidateECDSAKey(&offCurve); err == nil {
+		t.Errorf("expected an error for a point that is not on the curve")
+	}
+
+	other, err := GenerateECPrivateKey(ECCurve256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mismatched := *key
+	mismatched.D = other.D
+	if err := ValidateECDSAKey(&mismatched); err == nil {
+		t.Errorf("expected an error for a public point that does not match the private key")
+	}
+}
@@ -0,0 +1,199 @@
+/*
+Copyright 2019 The Jetstack cert-manager contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pki
+
+import (
+	"crypto"
+	"crypto/x509"
+	"time"
+
+	"github.com/jetstack/cert-manager/pkg/apis/certmanager/v1alpha1"
+)
+
+// IssuanceProfile bundles the options used to generate and sign
+// certificates, so that operators can define reusable named profiles such as
+// "internal-tls" rather than passing individual options.
+// The zero value of each field leaves the corresponding default unchanged.
+// Where a Certificate resource also sets a value, the Certificate takes
+// precedence over the profile: a Certificate's duration overrides that of the
+// profile, and a CA Certificate always has the certSign key usage.
+type IssuanceProfile struct {
+	// Name identifies the profile.
+	Name string
+
+	// Duration of issued certificates, used if the Certificate does not set
+	// one. It takes precedence over the duration of the issuer.
+	Duration time.Duration
+
+	// Backdate moves the NotBefore of issued certificates into the past by
+	// the given amount, to tolerate clock skew between clients and the
+	// issuer. NotAfter is not changed.
+	Backdate time.Duration
+
+	// KeyUsages replaces the default key usages of issued certificates.
+	KeyUsages x509.KeyUsage
+
+	// ExtKeyUsages are the extended key usages of issued certificates.
+	ExtKeyUsages []x509.ExtKeyUsage
+
+	// KeyUsageNonCritical marks the KeyUsage extension as non-critical, as
+	// for WithKeyUsageCritical(false).
+	KeyUsageNonCritical bool
+
+	// SignatureAlgorithm, as for WithSignatureAlgorithm.
+	SignatureAlgorithm x509.SignatureAlgorithm
+
+	// SerialNumberBits, as for WithSerialNumberBits.
+	SerialNumberBits int
+
+	// CommonNameSANPolicy, as for WithCommonNameSANPolicy.
+	CommonNameSANPolicy CommonNameSANPolicy
+
+	// SubjectKeyIdMethod, as for WithSubjectKeyIdMethod.
+	SubjectKeyIdMethod SubjectKeyIdMethod
+
+	// NotBeforePolicy, as for WithNotBeforePolicy.
+	NotBeforePolicy NotBeforePolicy
+
+	// VerifyIssuer, as for WithIssuerVerification.
+	VerifyIssuer bool
+
+	// CALeafUsagePolicy, as for WithCALeafUsagePolicy.
+	CALeafUsagePolicy CALeafUsagePolicy
+
+	// RequireSANs, as for WithRequireSANs.
+	RequireSANs bool
+
+	// RejectPublicSuffixWildcards, as for WithPublicSuffixWildcardCheck with
+	// PublicSuffixes.
+	RejectPublicSuffixWildcards bool
+
+	// PublicSuffixes are the suffixes checked by RejectPublicSuffixWildcards.
+	// If nil, the Public Suffix List of golang.org/x/net/publicsuffix is used.
+	PublicSuffixes PublicSuffixList
+
+	// NoDefaultOrganization, as for WithoutDefaultOrganization.
+	NoDefaultOrganization bool
+
+	// MaxValidity, as for WithMaxValidity.
+	MaxValidity time.Duration
+
+	// PublicTrust rejects Certificates whose duration is longer than
+	// PublicTrustMaxValidity, as for WithPublicTrustLimit.
+	PublicTrust bool
+
+	// PublicTrustMaxValidity is the limit checked by PublicTrust. If zero,
+	// DefaultPublicTrustMaxValidity is used.
+	PublicTrustMaxValidity time.Duration
+
+	// CRLDistributionPoints, as for WithCRLDistributionPoints.
+	CRLDistributionPoints []string
+
+	// OCSPServers, as for WithOCSPServers.
+	OCSPServers []string
+
+	// IssuingCertificateURLs, as for WithIssuingCertificateURLs.
+	IssuingCertificateURLs []string
+}
+
+// TLSIssuanceProfileName is the name of the profile returned by
+// TLSIssuanceProfile.
+const TLSIssuanceProfileName = "tls"
+
+// TLSIssuanceProfile returns a profile for certificates used for TLS, which
+// rejects certificates that would have a common name but no subject
+// alternative names, as TLS clients would not accept them.
+func TLSIssuanceProfile() *IssuanceProfile {
+	return &IssuanceProfile{
+		Name:        TLSIssuanceProfileName,
+		RequireSANs: true,
+	}
+}
+
+// TemplateOptions returns the TemplateOptions that apply the profile to
+// GenerateTemplate and GenerateCSR.
+func (p *IssuanceProfile) TemplateOptions() []TemplateOption {
+	opts := []TemplateOption{
+		func(o *templateOptions) {
+			o.duration = p.Duration
+			o.backdate = p.Backdate
+			o.keyUsage = p.KeyUsages
+			o.extKeyUsages = p.ExtKeyUsages
+		},
+		WithKeyUsageCritical(!p.KeyUsageNonCritical),
+		WithCommonNameSANPolicy(p.CommonNameSANPolicy),
+		WithCALeafUsagePolicy(p.CALeafUsagePolicy),
+	}
+	if p.SignatureAlgorithm != x509.UnknownSignatureAlgorithm {
+		opts = append(opts, WithSignatureAlgorithm(p.SignatureAlgorithm))
+	}
+	if p.SerialNumberBits != 0 {
+		opts = append(opts, WithSerialNumberBits(p.SerialNumberBits))
+	}
+	if p.RequireSANs {
+		opts = append(opts, WithRequireSANs(true))
+	}
+	if p.RejectPublicSuffixWildcards {
+		opts = append(opts, WithPublicSuffixWildcardCheck(p.PublicSuffixes))
+	}
+	if p.NoDefaultOrganization {
+		opts = append(opts, WithoutDefaultOrganization())
+	}
+	if p.MaxValidity > 0 {
+		opts = append(opts, WithMaxValidity(p.MaxValidity))
+	}
+	if p.PublicTrust {
+		opts = append(opts, WithPublicTrustLimit(p.PublicTrustMaxValidity))
+	}
+	if len(p.CRLDistributionPoints) > 0 {
+		opts = append(opts, WithCRLDistributionPoints(p.CRLDistributionPoints...))
+	}
+	if len(p.OCSPServers) > 0 {
+		opts = append(opts, WithOCSPServers(p.OCSPServers...))
+	}
+	if len(p.IssuingCertificateURLs) > 0 {
+		opts = append(opts, WithIssuingCertificateURLs(p.IssuingCertificateURLs...))
+	}
+	return opts
+}
+
+// SignOptions returns the SignOptions that apply the profile to
+// SignCertificate.
+func (p *IssuanceProfile) SignOptions() []SignOption {
+	opts := []SignOption{
+		WithSubjectKeyIdMethod(p.SubjectKeyIdMethod),
+		WithNotBeforePolicy(p.NotBeforePolicy),
+	}
+	if p.VerifyIssuer {
+		opts = append(opts, WithIssuerVerification())
+	}
+	return opts
+}
+
+// GenerateTemplateWithProfile will generate a certificate template for the
+// given Certificate resource as GenerateTemplate does, applying the given
+// profile. Any opts are applied after the profile, and so override it.
+func GenerateTemplateWithProfile(issuer v1alpha1.GenericIssuer, crt *v1alpha1.Certificate, profile *IssuanceProfile, opts ...TemplateOption) (*x509.Certificate, error) {
+	return GenerateTemplate(issuer, crt, append(profile.TemplateOptions(), opts...)...)
+}
+
+// SignCertificateWithProfile signs the given template as SignCertificate
+// does, applying the given profile. Any opts are applied after the profile,
+// and so override it.
+func SignCertificateWithProfile(template *x509.Certificate, issuerCert *x509.Certificate, publicKey crypto.PublicKey, signerKey interface{}, profile *IssuanceProfile, opts ...SignOption) ([]byte, *x509.Certificate, error) {
+	return SignCertificate(template, issuerCert, publicKey, signerKey, append(profile.SignOptions(), opts...)...)
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2019 The Jetstack cert-manager contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pki
+
+import (
+	"crypto/x509"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestIssuanceProfile(t *testing.T) {
+	profile := &IssuanceProfile{
+		Name:                "internal-tls",
+		Duration:            7 * 24 * time.Hour,
+		Backdate:            time.Hour,
+		KeyUsages:           x509.KeyUsageDigitalSignature,
+		ExtKeyUsages:        []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		KeyUsageNonCritical: true,
+		SubjectKeyIdMethod:  SubjectKeyIdMethodTruncatedSHA1,
+	}
+	pk, err := GenerateECPrivateKey(ECCurve256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	crt := buildCertificate("test", "test.example.com")
+	template, err := GenerateTemplateWithProfile(nil, crt, profile)
+	if err != nil {
+		t.Fatalf("error generating template: %v", err)
+	}
+	_, cert, err := SignCertificateWithProfile(template, template, pk.Public(), pk, profile)
+	if err != nil {
+		t.Fatalf("error signing certificate: %v", err)
+	}
+
+	if validity := cert.NotAfter.Sub(cert.NotBefore); validity != profile.Duration+profile.Backdate {
+		t.Errorf("expected validity of %s but got %s", profile.Duration+profile.Backdate, validity)
+	}
+	if time.Until(cert.NotBefore) > -profile.Backdate+time.Minute {
+		t.Errorf("expected NotBefore to be backdated by %s but got %s", profile.Backdate, cert.NotBefore)
+	}
+	if cert.KeyUsage != x509.KeyUsageDigitalSignature {
+		t.Errorf("expected key usage %d but got %d", x509.KeyUsageDigitalSignature, cert.KeyUsage)
+	}
+	if !reflect.DeepEqual(cert.ExtKeyUsage, profile.ExtKeyUsages) {
+		t.Errorf("expected extended key usages %v but got %v", profile.ExtKeyUsages, cert.ExtKeyUsage)
+	}
+	ku := findExtension(t, cert.Extensions, OIDExtensionKeyUsage)
+	if ku == nil || ku.Critical {
+		t.Errorf("expected a non-critical key usage extension but got %+v", ku)
+	}
+	if len(cert.SubjectKeyId) != 8 {
+		t.Errorf("expected a truncated subject key identifier but got %x", cert.SubjectKeyId)
+	}
+
+	// the duration and CA status of the Certificate take precedence
+	crt.Spec.Duration = &metav1.Duration{Duration: 24 * time.Hour}
+	crt.Spec.IsCA = true
+	template, err = GenerateTemplateWithProfile(nil, crt, profile)
+	if err != nil {
+		t.Fatalf("error generating template: %v", err)
+	}
+	if validity := template.NotAfter.Sub(template.NotBefore); validity != 25*time.Hour {
+		t.Errorf("expected validity of %s but got %s", 25*time.Hour, validity)
+	}
+	if template.KeyUsage != x509.KeyUsageDigitalSignature|x509.KeyUsageCertSign {
+		t.Errorf("expected key usage to include certSign but got %d", template.KeyUsage)
+	}
+}
+
+func TestTLSIssuanceProfileRequiresSANs(t *testing.T) {
+	crt := buildCertificate("example.com")
+	cnOnly := []TemplateOption{WithCommonNameSANPolicy(CommonNameSANPolicyOmit)}
+
+	if _, err := GenerateTemplateWithProfile(nil, crt, TLSIssuanceProfile(), cnOnly...); err == nil || !strings.Contains(err.Error(), "dnsNames") {
+		t.Errorf("expected error rejecting a common name only certificate, but got: %v", err)
+	}
+	if _, err := GenerateCSR(nil, crt, append(TLSIssuanceProfile().TemplateOptions(), cnOnly...)...); err == nil {
+		t.Errorf("expected error rejecting a common name only csr")
+	}
+
+	// the check can be turned off for certificates not used for TLS
+	if _, err := GenerateTemplateWithProfile(nil, crt, TLSIssuanceProfile(), append(cnOnly, WithRequireSANs(false))...); err != nil {
+		t.Errorf("expected common name only certificate to be allowed, but got: %v", err)
+	}
+	if _, err := GenerateTemplate(nil, crt, cnOnly...); err != nil {
+		t.Errorf("expected common name only certificate to be allowed by default, but got: %v", err)
+	}
+
+	// by default the common name is included as a DNS name
+	template, err := GenerateTemplateWithProfile(nil, crt, TLSIssuanceProfile())
+	if err != nil {
+		t.Fatalf("error generating template: %v", err)
+	}
+	if !reflect.DeepEqual(template.DNSNames, []string{"example.com"}) {
+		t.Errorf("expected the common name as a DNS name but got %q", template.DNSNames)
+	}
+}
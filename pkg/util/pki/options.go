@@ -0,0 +1,504 @@
+/*
+Copyright 2019 The Jetstack cert-manager contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pki
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"io"
+	"math/big"
+	"time"
+)
+
+// TemplateOption configures optional behaviour of GenerateTemplate and
+// GenerateCSR.
+type TemplateOption func(*templateOptions)
+
+type templateOptions struct {
+	subjectEncoding              SubjectEncoding
+	subjectRDNOrder              []asn1.ObjectIdentifier
+	microsoftApplicationPolicies bool
+	commonNameSANPolicy          CommonNameSANPolicy
+	keyUsageNonCritical          bool
+	customExtensions             []pkix.Extension
+	allowCriticalCustomExts      bool
+	extensionConflictPolicy      ExtensionConflictPolicy
+	deviceIdentity               bool
+	deviceSerialNumber           string
+	ipAddressSANEncoding         IPAddressSANEncoding
+	serialNumberBits             int
+	directoryNameSANs            []pkix.Name
+	otherNames                   []otherName
+	signatureAlgorithm           x509.SignatureAlgorithm
+	allowedSignatureAlgorithms   []x509.SignatureAlgorithm
+	extKeyUsageOrder             []x509.ExtKeyUsage
+	publicKey                    crypto.PublicKey
+	keyAlgorithmConflictPolicy   KeyAlgorithmConflictPolicy
+	isSerialUsed                 func(*big.Int) bool
+	referenceCert                *x509.Certificate
+	referenceExclusions          []asn1.ObjectIdentifier
+	leafCAKeyUsagePolicy         LeafCAKeyUsagePolicy
+	caLeafUsagePolicy            CALeafUsagePolicy
+	requireSANs                  bool
+	noSubjectDefaults            bool
+	noDefaultOrganization        bool
+	rejectPublicSuffixWildcards  bool
+	publicSuffixes               PublicSuffixList
+	maxValidity                  time.Duration
+	publicTrust                  bool
+	publicTrustMaxValidity       time.Duration
+	crlDistributionPoints        []string
+	ocspServers                  []string
+	issuingCertificateURLs       []string
+	verbatimSANs                 bool
+
+	// set by IssuanceProfile
+	duration     time.Duration
+	backdate     time.Duration
+	keyUsage     x509.KeyUsage
+	extKeyUsages []x509.ExtKeyUsage
+
+	// rand is the source of randomness used to generate serial numbers.
+	// It is only overridden by tests.
+	rand io.Reader
+}
+
+func newTemplateOptions(opts []TemplateOption) *templateOptions {
+	o := &templateOptions{
+		serialNumberBits:           DefaultSerialNumberBits,
+		allowedSignatureAlgorithms: DefaultAllowedSignatureAlgorithms,
+		rand:                       rand.Reader,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithSubjectEncoding sets the ASN.1 string type used to encode the attribute
+// values of the subject distinguished name.
+func WithSubjectEncoding(enc SubjectEncoding) TemplateOption {
+	return func(o *templateOptions) {
+		o.subjectEncoding = enc
+	}
+}
+
+// WithSubjectRDNOrder sets the order of the relative distinguished names in
+// the subject of generated certificates and CSRs, given by their attribute
+// types, e.g. OIDAttributeCountry, OIDAttributeOrganization then
+// OIDAttributeCommonName. By default the order is chosen by crypto/x509.
+// This allows the subject DN of an external CA to be reproduced exactly.
+// Every attribute set on the subject must be included in order.
+func WithSubjectRDNOrder(order ...asn1.ObjectIdentifier) TemplateOption {
+	return func(o *templateOptions) {
+		o.subjectRDNOrder = order
+	}
+}
+
+// WithMicrosoftApplicationPolicies will add the Microsoft "Application
+// Policies" extension to generated certificates, mirroring the extended key
+// usages of the certificate.
+// This is required by Windows enterprise PKI, e.g. for smartcard logon
+// certificates used with Active Directory.
+func WithMicrosoftApplicationPolicies() TemplateOption {
+	return func(o *templateOptions) {
+		o.microsoftApplicationPolicies = true
+	}
+}
+
+// WithCommonNameSANPolicy sets how the CommonName of the Certificate is
+// included in the DNS names of the generated certificate. The default is
+// CommonNameSANPolicyInclude.
+func WithCommonNameSANPolicy(policy CommonNameSANPolicy) TemplateOption {
+	return func(o *templateOptions) {
+		o.commonNameSANPolicy = policy
+	}
+}
+
+// WithKeyUsageCritical sets whether the KeyUsage extension of generated
+// certificates is marked as critical. RFC 5280 recommends that it is, and
+// this is the default. Marking it non-critical should only be used for
+// interoperability with legacy clients.
+func WithKeyUsageCritical(critical bool) TemplateOption {
+	return func(o *templateOptions) {
+		o.keyUsageNonCritical = !critical
+	}
+}
+
+// WithCustomExtensions adds the given extensions to generated certificates,
+// in the order given and after any extensions generated by other options.
+// Each extension is marked critical according to its own Critical field.
+// Critical extensions are rejected unless WithCriticalCustomExtensions is
+// also set.
+func WithCustomExtensions(exts ...pkix.Extension) TemplateOption {
+	return func(o *templateOptions) {
+		o.customExtensions = append(o.customExtensions, exts...)
+	}
+}
+
+// WithCriticalCustomExtensions confirms that critical extensions passed to
+// WithCustomExtensions are intentional.
+// Clients that do not recognise a critical extension must reject the
+// certificate, so this should only be set where all relying parties are
+// known to understand the extensions.
+func WithCriticalCustomExtensions() TemplateOption {
+	return func(o *templateOptions) {
+		o.allowCriticalCustomExts = true
+	}
+}
+
+// WithExtensionConflictPolicy sets how an extension passed to
+// WithCustomExtensions, or copied by WithReferenceExtensions, that has the
+// same OID as an extension generated for the certificate, e.g. KeyUsage or
+// SubjectAltName, is handled. The default
+// is ExtensionConflictError.
+func WithExtensionConflictPolicy(policy ExtensionConflictPolicy) TemplateOption {
+	return func(o *templateOptions) {
+		o.extensionConflictPolicy = policy
+	}
+}
+
+// WithDeviceIdentity generates a device identity certificate, whose identity
+// is the given subject serialNumber rather than a common name or subject
+// alternative names. Certificates without a common name, DNS names or IP
+// addresses are permitted in this mode, but the serialNumber must not be
+// empty and the certificate must not be a CA.
+func WithDeviceIdentity(serialNumber string) TemplateOption {
+	return func(o *templateOptions) {
+		o.deviceIdentity = true
+		o.deviceSerialNumber = serialNumber
+	}
+}
+
+// WithIPAddressSANEncoding sets how IP addresses are encoded in the
+// SubjectAltName extension of generated certificates. The default is
+// IPAddressSANEncodingNative.
+func WithIPAddressSANEncoding(enc IPAddressSANEncoding) TemplateOption {
+	return func(o *templateOptions) {
+		o.ipAddressSANEncoding = enc
+	}
+}
+
+// WithSerialNumberBits sets the length of the randomly generated serial
+// number of generated certificates, which must be between
+// MinSerialNumberBits and MaxSerialNumberBits. The default is
+// DefaultSerialNumberBits.
+func WithSerialNumberBits(bits int) TemplateOption {
+	return func(o *templateOptions) {
+		o.serialNumberBits = bits
+	}
+}
+
+// WithDirectoryNameSANs adds the given distinguished names to the subject
+// alternative names of generated certificates as directoryName entries,
+// after any DNS names and IP addresses.
+func WithDirectoryNameSANs(names ...pkix.Name) TemplateOption {
+	return func(o *templateOptions) {
+		o.directoryNameSANs = append(o.directoryNameSANs, names...)
+	}
+}
+
+// WithSignatureAlgorithm overrides the signature algorithm used for
+// generated certificates and CSRs. By default, the signature algorithm of a
+// CSR is chosen by SignatureAlgorithm, and that of a certificate by
+// crypto/x509 based on the signer's key.
+func WithSignatureAlgorithm(alg x509.SignatureAlgorithm) TemplateOption {
+	return func(o *templateOptions) {
+		o.signatureAlgorithm = alg
+	}
+}
+
+// WithAllowedSignatureAlgorithms sets the signature algorithms that generated
+// certificates and CSRs may use, replacing
+// DefaultAllowedSignatureAlgorithms.
+func WithAllowedSignatureAlgorithms(algs ...x509.SignatureAlgorithm) TemplateOption {
+	return func(o *templateOptions) {
+		o.allowedSignatureAlgorithms = algs
+	}
+}
+
+// WithExtKeyUsageOrder sets the order in which extended key usages appear in
+// the ExtendedKeyUsage extension of generated certificates. By default the
+// order is chosen by crypto/x509.
+// order must include every extended key usage set on the certificate. Any
+// unknown extended key usages are placed after those in order.
+func WithExtKeyUsageOrder(order ...x509.ExtKeyUsage) TemplateOption {
+	return func(o *templateOptions) {
+		o.extKeyUsageOrder = order
+	}
+}
+
+// WithSerialNumberCollisionCheck sets a callback that reports whether a
+// serial number has already been issued. A randomly generated serial number
+// that has already been used is regenerated, up to MaxSerialNumberRetries
+// times before an error is returned.
+// Collisions are astronomically unlikely, so this is only required where
+// policy demands explicit handling of them.
+func WithSerialNumberCollisionCheck(isSerialUsed func(*big.Int) bool) TemplateOption {
+	return func(o *templateOptions) {
+		o.isSerialUsed = isSerialUsed
+	}
+}
+
+// WithReferenceExtensions copies the extensions of the given reference
+// certificate verbatim into generated certificates, so that an existing
+// certificate can be reproduced exactly, e.g. during a migration, without
+// modelling each of its extensions.
+// Extensions whose OID is in exclude are not copied. The SubjectKeyIdentifier,
+// AuthorityKeyIdentifier and BasicConstraints extensions are never copied, as
+// they are always regenerated. Extensions generated by other options, and
+// those passed to WithCustomExtensions, take precedence over those of the
+// reference certificate.
+// Extensions that crypto/x509 would generate from the template, such as
+// SubjectAltName, KeyUsage and ExtendedKeyUsage, conflict with those of the
+// reference certificate unless excluded, and are handled according to the
+// ExtensionConflictPolicy: by default an error is returned, and with
+// ExtensionConflictPreferCustom the reference extension replaces the
+// generated one.
+func WithReferenceExtensions(ref *x509.Certificate, exclude ...asn1.ObjectIdentifier) TemplateOption {
+	return func(o *templateOptions) {
+		o.referenceCert = ref
+		o.referenceExclusions = exclude
+	}
+}
+
+// WithKeyAlgorithmConflictPolicy sets how GenerateTemplateWithKey and
+// GenerateCSRWithKey handle a key whose algorithm or size does not match
+// the Certificate. The default is KeyAlgorithmConflictError.
+func WithKeyAlgorithmConflictPolicy(policy KeyAlgorithmConflictPolicy) TemplateOption {
+	return func(o *templateOptions) {
+		o.keyAlgorithmConflictPolicy = policy
+	}
+}
+
+// WithLeafCAKeyUsagePolicy sets how a Certificate that is not a CA but whose
+// Usages include certSign or cRLSign is handled. The default is
+// LeafCAKeyUsageReject.
+func WithLeafCAKeyUsagePolicy(policy LeafCAKeyUsagePolicy) TemplateOption {
+	return func(o *templateOptions) {
+		o.leafCAKeyUsagePolicy = policy
+	}
+}
+
+// WithCALeafUsagePolicy sets how a CA Certificate whose Usages include
+// serverAuth or clientAuth is handled, as checked by ValidateCAExtKeyUsages.
+// The default is CALeafUsageWarn, which logs a warning and issues the
+// certificate.
+func WithCALeafUsagePolicy(policy CALeafUsagePolicy) TemplateOption {
+	return func(o *templateOptions) {
+		o.caLeafUsagePolicy = policy
+	}
+}
+
+// WithRequireSANs sets whether a Certificate that would produce a certificate
+// with a common name but no subject alternative names is rejected. TLS
+// clients ignore the common name, so such a certificate is not usable for
+// TLS. It is off by default, for certificates that are not used for TLS.
+func WithRequireSANs(require bool) TemplateOption {
+	return func(o *templateOptions) {
+		o.requireSANs = require
+	}
+}
+
+// WithoutSubjectDefaults stops a default subject from being filled in: the
+// organization is not defaulted, and the common name is not taken from the
+// DNS names. If the Certificate sets no common name, organization or other
+// subject fields, the subject is empty and the certificate is identified by
+// its subject alternative names alone, in a SubjectAltName extension marked
+// critical as RFC 5280 requires.
+func WithoutSubjectDefaults() TemplateOption {
+	return func(o *templateOptions) {
+		o.noSubjectDefaults = true
+	}
+}
+
+// WithoutDefaultOrganization stops the organization from being defaulted to
+// "cert-manager" when the Certificate does not set one, so that such
+// certificates are issued without an organization. Unlike
+// WithoutSubjectDefaults, the common name is still defaulted.
+// An organization set on the Certificate is always used.
+func WithoutDefaultOrganization() TemplateOption {
+	return func(o *templateOptions) {
+		o.noDefaultOrganization = true
+	}
+}
+
+// WithPublicSuffixWildcardCheck makes GenerateTemplate reject certificates
+// with a wildcard that spans a public suffix, such as "*.com" or "*.co.uk",
+// as by ValidateNoWildcardOnPublicSuffix. If suffixes is nil, the Public
+// Suffix List of golang.org/x/net/publicsuffix is used.
+func WithPublicSuffixWildcardCheck(suffixes PublicSuffixList) TemplateOption {
+	return func(o *templateOptions) {
+		o.rejectPublicSuffixWildcards = true
+		o.publicSuffixes = suffixes
+	}
+}
+
+// WithMaxValidity sets a ceiling on the validity of generated certificates,
+// as a guard against Certificates with an unreasonably long duration. If the
+// duration of a Certificate is longer, NotAfter is clamped to the given
+// duration from now, and a warning is logged. Zero means no ceiling, which
+// is the default.
+func WithMaxValidity(d time.Duration) TemplateOption {
+	return func(o *templateOptions) {
+		o.maxValidity = d
+	}
+}
+
+// WithPublicTrustLimit causes GenerateTemplate to return an error for
+// Certificates whose duration is longer than limit, as checked by
+// WouldExceedPublicTrustLimit, rather than issuing certificates that browsers
+// will reject. A limit of zero means DefaultPublicTrustMaxValidity. The check
+// is made after any ceiling set by WithMaxValidity is applied.
+func WithPublicTrustLimit(limit time.Duration) TemplateOption {
+	return func(o *templateOptions) {
+		o.publicTrust = true
+		o.publicTrustMaxValidity = limit
+	}
+}
+
+// WithCRLDistributionPoints sets the CRL distribution points of generated
+// certificates, for issuers that publish a certificate revocation list.
+// Certificates that set their own crlDistributionPoints use those instead.
+func WithCRLDistributionPoints(urls ...string) TemplateOption {
+	return func(o *templateOptions) {
+		o.crlDistributionPoints = urls
+	}
+}
+
+// WithOCSPServers sets the OCSP servers in the authority information access
+// extension of generated certificates, for issuers that run an OCSP
+// responder. Certificates that set their own ocspServers use those instead.
+func WithOCSPServers(urls ...string) TemplateOption {
+	return func(o *templateOptions) {
+		o.ocspServers = urls
+	}
+}
+
+// WithIssuingCertificateURLs sets the CA issuers URLs in the authority
+// information access extension of generated certificates, from which clients
+// can fetch the issuer certificate to build a chain. Certificates that set
+// their own issuingCertificateURLs use those instead.
+func WithIssuingCertificateURLs(urls ...string) TemplateOption {
+	return func(o *templateOptions) {
+		o.issuingCertificateURLs = urls
+	}
+}
+
+// WithVerbatimSANs disables the canonicalisation of subject alternative names
+// in generated CSRs and certificates, for the rare client that needs them
+// exactly as listed on the Certificate. By default, trailing dots are removed
+// from DNS names, IPv4 addresses are encoded in 4 bytes, the domains of email
+// addresses are lowercased and duplicates are removed.
+// DNS names are lowercased regardless, as by DNSNamesForCertificate.
+func WithVerbatimSANs() TemplateOption {
+	return func(o *templateOptions) {
+		o.verbatimSANs = true
+	}
+}
+
+// withPublicKey sets the existing public key that certificates are generated
+// for.
+func withPublicKey(pub crypto.PublicKey) TemplateOption {
+	return func(o *templateOptions) {
+		o.publicKey = pub
+	}
+}
+
+// SignOption configures optional behaviour of SignCertificate.
+type SignOption func(*signOptions)
+
+type signOptions struct {
+	verifyIssuer       bool
+	maxIntermediates   *int
+	subjectKeyIdMethod SubjectKeyIdMethod
+	notBeforePolicy    NotBeforePolicy
+	maxCertificateSize int
+	lowSSignature      bool
+}
+
+func newSignOptions(opts []SignOption) *signOptions {
+	o := &signOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithIssuerVerification will cause SignCertificate to check that the newly
+// signed certificate verifies against the issuer certificate before it is
+// returned.
+// Only the signature and the issuer's basic constraints are checked, names and
+// validity periods are ignored.
+// This catches a signer key that does not belong to the issuer certificate
+// before the certificate is ever stored.
+func WithIssuerVerification() SignOption {
+	return func(o *signOptions) {
+		o.verifyIssuer = true
+	}
+}
+
+// WithMaxIntermediates limits the number of intermediate certificates that
+// SignCertificateWithChain will include in the bundle after the signed
+// certificate. Intermediates beyond the limit are truncated from the end of
+// the chain, which is useful for clients that fetch the remainder of the
+// chain themselves.
+func WithMaxIntermediates(n int) SignOption {
+	return func(o *signOptions) {
+		o.maxIntermediates = &n
+	}
+}
+
+// WithSubjectKeyIdMethod sets the method used to compute the subject key
+// identifier of signed certificates. The default is SubjectKeyIdMethodSHA1.
+// This has no effect if the template already has a SubjectKeyId set.
+func WithSubjectKeyIdMethod(method SubjectKeyIdMethod) SignOption {
+	return func(o *signOptions) {
+		o.subjectKeyIdMethod = method
+	}
+}
+
+// WithNotBeforePolicy sets how SignCertificate handles a template that would
+// be valid before its issuer. The default is NotBeforePolicyClamp.
+func WithNotBeforePolicy(policy NotBeforePolicy) SignOption {
+	return func(o *signOptions) {
+		o.notBeforePolicy = policy
+	}
+}
+
+// WithMaxCertificateSize causes SignCertificate to return an error if the DER
+// encoding of the signed certificate is larger than the given number of
+// bytes, e.g. because of many subject alternative names or extensions. Some
+// transports and HSM import paths reject certificates above a size limit.
+// By default there is no limit.
+func WithMaxCertificateSize(bytes int) SignOption {
+	return func(o *signOptions) {
+		o.maxCertificateSize = bytes
+	}
+}
+
+// WithLowSSignature causes SignCertificate to normalize the ECDSA signature
+// of signed certificates into low-S canonical form, as required by some
+// strict verifiers. It has no effect if the signer key is not ECDSA.
+func WithLowSSignature() SignOption {
+	return func(o *signOptions) {
+		o.lowSSignature = true
+	}
+}
@@ -26,7 +26,9 @@ import (
 )
 
 // DecodePrivateKeyBytes will decode a PEM encoded private key into a crypto.Signer.
-// It supports ECDSA and RSA private keys only. All other types will return err.
+// It supports "RSA PRIVATE KEY" (PKCS#1), "EC PRIVATE KEY" (SEC 1) and
+// "PRIVATE KEY" (PKCS#8) blocks, the latter holding an RSA, ECDSA or Ed25519
+// key. All other types will return err.
 func DecodePrivateKeyBytes(keyBytes []byte) (crypto.Signer, error) {
 	// decode the private key pem
 	block, _ := pem.Decode(keyBytes)
@@ -66,7 +68,7 @@ func DecodePrivateKeyBytes(keyBytes []byte) (crypto.Signer, error) {
 
 		return key, nil
 	default:
-		return nil, errors.NewInvalidData("unknown private key type: %s", block.Type)
+		return nil, errors.NewInvalidData("unknown private key type: %s. expected one of RSA PRIVATE KEY, EC PRIVATE KEY or PRIVATE KEY", block.Type)
 	}
 }
 
@@ -89,7 +91,11 @@ func DecodePKCS1PrivateKeyBytes(keyBytes []byte) (*rsa.PrivateKey, error) {
 	return key, nil
 }
 
-// DecodeX509CertificateChainBytes will decode a PEM encoded x509 Certificate chain.
+// DecodeX509CertificateChainBytes will decode a PEM encoded x509 Certificate
+// chain, such as the bundle returned by SignCertificateWithChain, returning
+// the certificates in the order they appear.
+// An error is returned if any PEM block is not a CERTIFICATE, or if no
+// certificates are found.
 func DecodeX509CertificateChainBytes(certBytes []byte) ([]*x509.Certificate, error) {
 	certs := []*x509.Certificate{}
 
@@ -101,6 +107,9 @@ func DecodeX509CertificateChainBytes(certBytes []byte) ([]*x509.Certificate, err
 		if block == nil {
 			break
 		}
+		if block.Type != "CERTIFICATE" {
+			return nil, errors.NewInvalidData("unexpected PEM block type in certificate chain: %s", block.Type)
+		}
 
 		// parse the tls certificate
 		cert, err := x509.ParseCertificate(block.Bytes)
@@ -118,6 +127,7 @@ func DecodeX509CertificateChainBytes(certBytes []byte) ([]*x509.Certificate, err
 }
 
 // DecodeX509CertificateBytes will decode a PEM encoded x509 Certificate.
+// If certBytes contains a chain, the first certificate is returned.
 func DecodeX509CertificateBytes(certBytes []byte) (*x509.Certificate, error) {
 	certs, err := DecodeX509CertificateChainBytes(certBytes)
 	if err != nil {
@@ -126,3 +136,67 @@ func DecodeX509CertificateBytes(certBytes []byte) (*x509.Certificate, error) {
 
 	return certs[0], nil
 }
+
+// DecodeCSR will decode a DER encoded x509 certificate signing request, such
+// as that returned by EncodeCSR, and verify its signature.
+func DecodeCSR(der []byte) (*x509.CertificateRequest, error) {
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		return nil, errors.NewInvalidData("error parsing certificate request: %s", err.Error())
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, errors.NewInvalidData("certificate request has an invalid signature: %s", err.Error())
+	}
+	return csr, nil
+}
+
+// DecodePEMCSR will decode a PEM encoded x509 certificate signing request and
+// verify its signature.
+func DecodePEMCSR(pemBytes []byte) (*x509.CertificateRequest, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, errors.NewInvalidData("error decoding certificate request PEM block")
+	}
+	if block.Type != "CERTIFICATE REQUEST" {
+		return nil, errors.NewInvalidData("unexpected PEM block type for certificate request: %s", block.Type)
+	}
+	return DecodeCSR(block.Bytes)
+}
+
+// ParseTLSSecretData will decode the PEM encoded certificate, private key and
+// CA data stored in a TLS Secret.
+// The first certificate in tlsCrt is returned as the leaf, and any further
+// certificates are returned as the chain. caCrt is optional and may be empty.
+// An error is returned if the certificate or private key are missing or cannot
+// be decoded, or if the private key does not match the leaf certificate.
+func ParseTLSSecretData(tlsCrt, tlsKey, caCrt []byte) (leaf *x509.Certificate, key crypto.Signer, chain []*x509.Certificate, ca []*x509.Certificate, err error) {
+	if len(tlsCrt) == 0 {
+		return nil, nil, nil, nil, errors.NewInvalidData("no certificate data provided")
+	}
+	if len(tlsKey) == 0 {
+		return nil, nil, nil, nil, errors.NewInvalidData("no private key data provided")
+	}
+
+	certs, err := DecodeX509CertificateChainBytes(tlsCrt)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	key, err = DecodePrivateKeyBytes(tlsKey)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	if !PublicKeysEqual(key.Public(), certs[0].PublicKey) {
+		return nil, nil, nil, nil, errors.NewInvalidData("private key does not match certificate with subject %q", certs[0].Subject.String())
+	}
+
+	if len(caCrt) > 0 {
+		ca, err = DecodeX509CertificateChainBytes(caCrt)
+		if err != nil {
+			return nil, nil, nil, nil, err
+		}
+	}
+
+	return certs[0], key, certs[1:], ca, nil
+}
@@ -19,11 +19,13 @@ package pki
 import (
 	"crypto/ecdsa"
 	"crypto/rsa"
+	"crypto/x509"
 	"encoding/pem"
 	"strings"
 	"testing"
 
 	"github.com/jetstack/cert-manager/pkg/apis/certmanager/v1alpha1"
+	"github.com/jetstack/cert-manager/pkg/util/errors"
 )
 
 func generatePrivateKeyBytes(keyAlgo v1alpha1.KeyAlgorithm, keySize int) ([]byte, error) {
@@ -173,3 +175,238 @@ func TestDecodePrivateKeyBytes(t *testing.T) {
 		t.Run(test.name, testFn(test))
 	}
 }
+
+func TestDecodeX509CertificateChainBytes(t *testing.T) {
+	root, rootKey := signTestCertificate(t, buildCACertificate("root"), nil, nil)
+	leaf, leafKey := signTestCertificate(t, buildCertificate("leaf"), root, rootKey)
+	bundle := append(mustEncodeX509(t, leaf), mustEncodeX509(t, root)...)
+
+	certs, err := DecodeX509CertificateChainBytes(bundle)
+	if err != nil {
+		t.Fatalf("expected no error but got: %v", err)
+	}
+	if len(certs) != 2 || !certs[0].Equal(leaf) || !certs[1].Equal(root) {
+		t.Errorf("expected the leaf followed by the root but got %d certificates", len(certs))
+	}
+	cert, err := DecodeX509CertificateBytes(bundle)
+	if err != nil {
+		t.Fatalf("expected no error but got: %v", err)
+	}
+	if !cert.Equal(leaf) {
+		t.Errorf("expected the first certificate to be the leaf but got %q", cert.Subject.CommonName)
+	}
+
+	keyBytes, err := EncodePrivateKey(leafKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DecodeX509CertificateChainBytes(append(mustEncodeX509(t, leaf), keyBytes...)); !errors.IsInvalidData(err) {
+		t.Errorf("expected an invalid data error for a non-certificate PEM block but got: %v", err)
+	}
+	if _, err := DecodeX509CertificateChainBytes([]byte("no certificates here")); !errors.IsInvalidData(err) {
+		t.Errorf("expected an invalid data error when no certificates are found but got: %v", err)
+	}
+}
+
+func TestParseTLSSecretData(t *testing.T) {
+	root, rootKey := signTestCertificate(t, buildCACertificate("root"), nil, nil)
+	intermediate, intermediateKey := signTestCertificate(t, buildCACertificate("intermediate"), root, rootKey)
+	leaf, leafKey := signTestCertificate(t, buildCertificate("leaf"), intermediate, intermediateKey)
+
+	tlsCrt := append(mustEncodeX509(t, leaf), mustEncodeX509(t, intermediate)...)
+	caCrt := mustEncodeX509(t, root)
+	tlsKey, err := EncodePrivateKey(leafKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := generatePrivateKeyBytes(v1alpha1.ECDSAKeyAlgorithm, 256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("complete secret", func(t *testing.T) {
+		parsedLeaf, key, chain, ca, err := ParseTLSSecretData(tlsCrt, tlsKey, caCrt)
+		if err != nil {
+			t.Fatalf("expected no error but got: %v", err)
+		}
+		if !parsedLeaf.Equal(leaf) {
+			t.Errorf("expected leaf certificate to be returned")
+		}
+		if !PublicKeysEqual(key.Public(), leafKey.Public()) {
+			t.Errorf("expected leaf private key to be returned")
+		}
+		if len(chain) != 1 || !chain[0].Equal(intermediate) {
+			t.Errorf("expected chain to contain only the intermediate")
+		}
+		if len(ca) != 1 || !ca[0].Equal(root) {
+			t.Errorf("expected ca to contain only the root")
+		}
+	})
+
+	t.Run("secret without ca data", func(t *testing.T) {
+		_, _, _, ca, err := ParseTLSSecretData(tlsCrt, tlsKey, nil)
+		if err != nil {
+			t.Fatalf("expected no error but got: %v", err)
+		}
+		if ca != nil {
+			t.Errorf("expected no ca certificates but got %d", len(ca))
+		}
+	})
+
+	errorTests := map[string]struct {
+		tlsCrt, tlsKey, caCrt []byte
+	}{
+		"mismatched key and certificate": {tlsCrt: tlsCrt, tlsKey: otherKey, caCrt: caCrt},
+		"missing private key":            {tlsCrt: tlsCrt, caCrt: caCrt},
+		"missing certificate":            {tlsKey: tlsKey, caCrt: caCrt},
+		"invalid ca data":                {tlsCrt: tlsCrt, tlsKey: tlsKey, caCrt: []byte("invalid")},
+	}
+	for name, test := range errorTests {
+		t.Run(name, func(t *testing.T) {
+			_, _, _, _, err := ParseTLSSecretData(test.tlsCrt, test.tlsKey, test.caCrt)
+			if err == nil {
+				t.Fatalf("expected an error but got none")
+			}
+			if !errors.IsInvalidData(err) {
+				t.Errorf("expected an invalid data error but got: %v", err)
+			}
+		})
+	}
+}
+
+func mustEncodeX509(t *testing.T, cert *x509.Certificate) []byte {
+	b, err := EncodeX509(cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestDecodeCSR(t *testing.T) {
+	crt := buildCertificate("test", "test.example.com")
+	pk, err := GeneratePrivateKeyForCertificate(crt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template, err := GenerateCSR(nil, crt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := EncodeCSR(template, pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pemBytes := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})
+
+	for name, decode := range map[string]func() (*x509.CertificateRequest, error){
+		"der": func() (*x509.CertificateRequest, error) { return DecodeCSR(der) },
+		"pem": func() (*x509.CertificateRequest, error) { return DecodePEMCSR(pemBytes) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			csr, err := decode()
+			if err != nil {
+				t.Fatalf("expected no error but got: %v", err)
+			}
+			if csr.Subject.CommonName != "test" {
+				t.Errorf("expected common name %q but got %q", "test", csr.Subject.CommonName)
+			}
+			if strings.Join(csr.DNSNames, ",") != strings.Join(template.DNSNames, ",") {
+				t.Errorf("expected dns names %v but got %v", template.DNSNames, csr.DNSNames)
+			}
+		})
+	}
+
+	tampered := append([]byte{}, der...)
+	tampered[len(tampered)-1] ^= 0xff
+	if _, err := DecodeCSR(tampered); !errors.IsInvalidData(err) {
+		t.Errorf("expected an invalid data error for a csr with an invalid signature but got: %v", err)
+	}
+	if _, err := DecodeCSR([]byte("not a csr")); !errors.IsInvalidData(err) {
+		t.Errorf("expected an invalid data error for malformed der but got: %v", err)
+	}
+	if _, err := DecodePEMCSR(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})); !errors.IsInvalidData(err) {
+		t.Errorf("expected an invalid data error for the wrong PEM block type but got: %v", err)
+	}
+}
+
+func TestEncodeDecodePrivateKeyRoundTrip(t *testing.T) {
+	tests := map[string]struct {
+		keyAlgo   v1alpha1.KeyAlgorithm
+		keySize   int
+		blockType string
+	}{
+		"rsa":       {keyAlgo: v1alpha1.RSAKeyAlgorithm, keySize: MinRSAKeySize, blockType: "RSA PRIVATE KEY"},
+		"ecdsa":     {keyAlgo: v1alpha1.ECDSAKeyAlgorithm, keySize: ECCurve256, blockType: "EC PRIVATE KEY"},
+		"ecdsa 521": {keyAlgo: v1alpha1.ECDSAKeyAlgorithm, keySize: ECCurve521, blockType: "EC PRIVATE KEY"},
+		"ed25519":   {keyAlgo: v1alpha1.Ed25519KeyAlgorithm, blockType: "PRIVATE KEY"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			key, err := GeneratePrivateKeyForCertificate(buildCertificateWithKeyParams(test.keyAlgo, test.keySize))
+			if err != nil {
+				t.Fatal(err)
+			}
+			keyBytes, err := EncodePrivateKey(key)
+			if err != nil {
+				t.Fatalf("error encoding private key: %v", err)
+			}
+			block, _ := pem.Decode(keyBytes)
+			if block == nil || block.Type != test.blockType {
+				t.Fatalf("expected a %q PEM block but got %+v", test.blockType, block)
+			}
+			decoded, err := DecodePrivateKeyBytes(keyBytes)
+			if err != nil {
+				t.Fatalf("error decoding private key: %v", err)
+			}
+			if !PublicKeysEqual(decoded.Public(), key.Public()) {
+				t.Errorf("expected the decoded private key to match the original")
+			}
+		})
+	}
+}
+
+func TestEncodePKCS8PrivateKeyRoundTrip(t *testing.T) {
+	tests := map[string]struct {
+		keyAlgo v1alpha1.KeyAlgorithm
+		keySize int
+	}{
+		"rsa":     {keyAlgo: v1alpha1.RSAKeyAlgorithm, keySize: MinRSAKeySize},
+		"ecdsa":   {keyAlgo: v1alpha1.ECDSAKeyAlgorithm, keySize: ECCurve384},
+		"ed25519": {keyAlgo: v1alpha1.Ed25519KeyAlgorithm},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			crt := buildCertificateWithKeyParams(test.keyAlgo, test.keySize)
+			crt.Spec.KeyEncoding = v1alpha1.PKCS8
+			key, err := GeneratePrivateKeyForCertificate(crt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			keyBytes, err := EncodePrivateKeyForCertificate(crt, key)
+			if err != nil {
+				t.Fatalf("error encoding private key: %v", err)
+			}
+			block, _ := pem.Decode(keyBytes)
+			if block == nil || block.Type != "PRIVATE KEY" {
+				t.Fatalf("expected a PRIVATE KEY PEM block but got %+v", block)
+			}
+			decoded, err := DecodePrivateKeyBytes(keyBytes)
+			if err != nil {
+				t.Fatalf("error decoding private key: %v", err)
+			}
+			if !PublicKeysEqual(decoded.Public(), key.Public()) {
+				t.Errorf("expected the decoded private key to match the original")
+			}
+		})
+	}
+
+	crt := buildCertificate("test")
+	crt.Spec.KeyEncoding = v1alpha1.KeyEncoding("der")
+	key, err := GeneratePrivateKeyForCertificate(crt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := EncodePrivateKeyForCertificate(crt, key); err == nil {
+		t.Errorf("expected an error encoding with an unsupported key encoding")
+	}
+}
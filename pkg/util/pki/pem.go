@@ -0,0 +1,41 @@
+/*
+Copyright 2019 The Jetstack cert-manager contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pki
+
+import (
+	"bytes"
+	"encoding/pem"
+)
+
+// ReencodePEM decodes all PEM blocks in the given data and re-encodes them
+// using the standard 64 character line width.
+// Any data that is not part of a PEM block is discarded. Re-encoding data that
+// is already conformant returns an identical copy.
+func ReencodePEM(data []byte) []byte {
+	buf := bytes.NewBuffer([]byte{})
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		// pem.Encode can only fail when writing to the buffer fails, or if a
+		// header contains a colon, which pem.Decode would not have produced
+		pem.Encode(buf, block)
+	}
+	return buf.Bytes()
+}
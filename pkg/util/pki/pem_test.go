@@ -0,0 +1,59 @@
+/*
+Copyright 2019 The Jetstack cert-manager contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pki
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+// wrapPEM encodes the given bytes as a PEM block of the given type, wrapping
+// the base64 body at width characters.
+func wrapPEM(blockType string, data []byte, width int) []byte {
+	body := base64.StdEncoding.EncodeToString(data)
+	var b strings.Builder
+	b.WriteString("-----BEGIN " + blockType + "-----\n")
+	for len(body) > width {
+		b.WriteString(body[:width] + "\n")
+		body = body[width:]
+	}
+	b.WriteString(body + "\n")
+	b.WriteString("-----END " + blockType + "-----\n")
+	return []byte(b.String())
+}
+
+func TestReencodePEM(t *testing.T) {
+	cert, _ := signTestCertificate(t, buildCertificate("test", "test.example.com"), nil, nil)
+	input := append(wrapPEM("CERTIFICATE", cert.Raw, 76), wrapPEM("CERTIFICATE", cert.Raw, 76)...)
+
+	output := ReencodePEM(input)
+	expected := append(wrapPEM("CERTIFICATE", cert.Raw, 64), wrapPEM("CERTIFICATE", cert.Raw, 64)...)
+	if !bytes.Equal(output, expected) {
+		t.Errorf("expected re-encoded PEM:\n%s\nbut got:\n%s", expected, output)
+	}
+	for _, line := range strings.Split(string(output), "\n") {
+		if len(line) > 64 {
+			t.Errorf("expected no lines longer than 64 characters but got %d: %q", len(line), line)
+		}
+	}
+
+	if again := ReencodePEM(output); !bytes.Equal(again, output) {
+		t.Errorf("expected re-encoding conformant PEM to be idempotent")
+	}
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2019 The Jetstack cert-manager contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pki
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+)
+
+var (
+	// OIDPKCS7Data is the content type of PKCS#7 data, as defined in RFC 5652.
+	OIDPKCS7Data = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+
+	// OIDPKCS7SignedData is the content type of PKCS#7 signed data, as
+	// defined in RFC 5652.
+	OIDPKCS7SignedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+)
+
+// pkcs7ContentInfo is the ContentInfo structure of RFC 5652.
+type pkcs7ContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"optional"`
+}
+
+// pkcs7SignedData is the SignedData structure of RFC 5652, without the
+// optional crls field.
+type pkcs7SignedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	ContentInfo      pkcs7ContentInfo
+	Certificates     asn1.RawValue   `asn1:"optional"`
+	SignerInfos      []asn1.RawValue `asn1:"set"`
+}
+
+// EncodePKCS7CertsOnly will encode the given certificates as a DER encoded
+// PKCS#7 "certs-only" bundle, as used by .p7b files. This is a degenerate
+// SignedData structure that holds only the certificates, with no content or
+// signatures.
+func EncodePKCS7CertsOnly(certs []*x509.Certificate) ([]byte, error) {
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificates to encode")
+	}
+
+	var raw bytes.Buffer
+	for _, cert := range certs {
+		raw.Write(cert.Raw)
+	}
+
+	signedData, err := asn1.Marshal(pkcs7SignedData{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{},
+		ContentInfo:      pkcs7ContentInfo{ContentType: OIDPKCS7Data},
+		// the certificates are an implicitly tagged SET OF Certificate
+		Certificates: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: raw.Bytes()},
+		SignerInfos:  []asn1.RawValue{},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error encoding pkcs#7 signed data: %s", err.Error())
+	}
+
+	der, err := asn1.Marshal(pkcs7ContentInfo{
+		ContentType: OIDPKCS7SignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: signedData},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error encoding pkcs#7 content info: %s", err.Error())
+	}
+
+	return der, nil
+}
+
+// EncodePKCS7CertsOnlyPEM will encode the given certificates as a PKCS#7
+// "certs-only" bundle, as EncodePKCS7CertsOnly does, wrapped in a "PKCS7" PEM
+// block.
+func EncodePKCS7CertsOnlyPEM(certs []*x509.Certificate) ([]byte, error) {
+	der, err := EncodePKCS7CertsOnly(certs)
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PKCS7", Bytes: der}), nil
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2019 The Jetstack cert-manager contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pki
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"testing"
+)
+
+// decodePKCS7CertsOnly parses a DER encoded PKCS#7 certs-only bundle and
+// returns its certificates.
+func decodePKCS7CertsOnly(t *testing.T, der []byte) []*x509.Certificate {
+	var contentInfo pkcs7ContentInfo
+	if rest, err := asn1.Unmarshal(der, &contentInfo); err != nil || len(rest) > 0 {
+		t.Fatalf("error parsing pkcs#7 content info: %v", err)
+	}
+	if !contentInfo.ContentType.Equal(OIDPKCS7SignedData) {
+		t.Fatalf("expected content type %s but got %s", OIDPKCS7SignedData, contentInfo.ContentType)
+	}
+	var signedData pkcs7SignedData
+	if _, err := asn1.Unmarshal(contentInfo.Content.Bytes, &signedData); err != nil {
+		t.Fatalf("error parsing pkcs#7 signed data: %v", err)
+	}
+	if len(signedData.SignerInfos) != 0 {
+		t.Errorf("expected no signer infos but got %d", len(signedData.SignerInfos))
+	}
+	certs, err := x509.ParseCertificates(signedData.Certificates.Bytes)
+	if err != nil {
+		t.Fatalf("error parsing certificates: %v", err)
+	}
+	return certs
+}
+
+func TestEncodePKCS7CertsOnly(t *testing.T) {
+	root, rootKey := signTestCertificate(t, buildCACertificate("root"), nil, nil)
+	intermediate, intermediateKey := signTestCertificate(t, buildCACertificate("intermediate"), root, rootKey)
+	leaf, _ := signTestCertificate(t, buildCertificate("leaf"), intermediate, intermediateKey)
+	chain := []*x509.Certificate{leaf, intermediate, root}
+
+	der, err := EncodePKCS7CertsOnly(chain)
+	if err != nil {
+		t.Fatalf("error encoding pkcs#7 bundle: %v", err)
+	}
+	certs := decodePKCS7CertsOnly(t, der)
+	if len(certs) != len(chain) {
+		t.Fatalf("expected %d certificates but got %d", len(chain), len(certs))
+	}
+	for i := range chain {
+		if !certs[i].Equal(chain[i]) {
+			t.Errorf("expected certificate %d to be %q but got %q", i, chain[i].Subject, certs[i].Subject)
+		}
+	}
+
+	pemBytes, err := EncodePKCS7CertsOnlyPEM(chain)
+	if err != nil {
+		t.Fatalf("error encoding pkcs#7 bundle as PEM: %v", err)
+	}
+	block, _ := pem.Decode(pemBytes)
+	if block == nil || block.Type != "PKCS7" {
+		t.Fatalf("expected a PKCS7 PEM block but got %+v", block)
+	}
+	if len(decodePKCS7CertsOnly(t, block.Bytes)) != len(chain) {
+		t.Errorf("expected %d certificates in the PEM bundle", len(chain))
+	}
+
+	if _, err := EncodePKCS7CertsOnly(nil); err == nil {
+		t.Errorf("expected an error encoding no certificates")
+	}
+}
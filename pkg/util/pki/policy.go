@@ -0,0 +1,358 @@
+/*
+Copyright 2019 The Jetstack cert-manager contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pki
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+
+	"github.com/jetstack/cert-manager/pkg/apis/certmanager/v1alpha1"
+	"github.com/jetstack/cert-manager/pkg/util/errors"
+	"github.com/jetstack/cert-manager/pkg/util/x509util"
+)
+
+// DefaultAllowedSignatureAlgorithms are the signature algorithms that may be
+// used by generated certificates and CSRs unless an allowlist is set with
+// WithAllowedSignatureAlgorithms.
+var DefaultAllowedSignatureAlgorithms = []x509.SignatureAlgorithm{
+	x509.SHA256WithRSA,
+	x509.SHA384WithRSA,
+	x509.SHA512WithRSA,
+	x509.SHA256WithRSAPSS,
+	x509.SHA384WithRSAPSS,
+	x509.SHA512WithRSAPSS,
+	x509.ECDSAWithSHA256,
+	x509.ECDSAWithSHA384,
+	x509.ECDSAWithSHA512,
+	x509.PureEd25519,
+}
+
+// ParseSignatureAlgorithm returns the signature algorithm with the given
+// name, such as "SHA384WithRSA". An error is returned if the name is not one
+// of the signature algorithms in DefaultAllowedSignatureAlgorithms.
+func ParseSignatureAlgorithm(name string) (x509.SignatureAlgorithm, error) {
+	return x509util.ParseSignatureAlgorithm(name)
+}
+
+// validateSignatureAlgorithm returns an error if the given signature
+// algorithm is not in the allowed set.
+func validateSignatureAlgorithm(alg x509.SignatureAlgorithm, allowed []x509.SignatureAlgorithm) error {
+	for _, a := range allowed {
+		if a == alg {
+			return nil
+		}
+	}
+	return fmt.Errorf("signature algorithm %s is not permitted", alg)
+}
+
+// DisallowedCurvesInChain returns the subjects of all certificates in the
+// given chain that have an ECDSA public key on a curve that is not in the
+// allowed set. Certificates with non-ECDSA public keys are skipped.
+func DisallowedCurvesInChain(certs []*x509.Certificate, allowed []elliptic.Curve) []string {
+	var disallowed []string
+	for _, cert := range certs {
+		pub, ok := cert.PublicKey.(*ecdsa.PublicKey)
+		if !ok {
+			continue
+		}
+		if !curveAllowed(pub.Curve, allowed) {
+			disallowed = append(disallowed, cert.Subject.String())
+		}
+	}
+	return disallowed
+}
+
+func curveAllowed(curve elliptic.Curve, allowed []elliptic.Curve) bool {
+	for _, c := range allowed {
+		if c.Params().Name == curve.Params().Name {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateSANsWithinSuffix returns an error if any DNS name of the given
+// Certificate, or its common name if it is a hostname, is not within one of
+// the allowed domain suffixes. Names are checked as they will be issued, as
+// returned by issuedHostnames.
+// A suffix such as "example.com" allows the domain itself and any
+// subdomain, including wildcards. A suffix such as "*.example.com" only
+// allows subdomains.
+func ValidateSANsWithinSuffix(crt *v1alpha1.Certificate, allowedSuffixes []string) error {
+	for _, name := range issuedHostnames(crt) {
+		if !withinAnySuffix(normaliseDNSName(name), allowedSuffixes) {
+			return fmt.Errorf("%q is not within any of the allowed domain suffixes: %s", name, strings.Join(allowedSuffixes, ", "))
+		}
+	}
+	return nil
+}
+
+// issuedHostnames returns the DNS names that will be issued for the given
+// Certificate, preceded by its common name if that is a hostname. The names
+// are trimmed and lower cased by the same helpers GenerateTemplate uses, so
+// that policy checks apply to exactly the names that are issued.
+func issuedHostnames(crt *v1alpha1.Certificate) []string {
+	names := DNSNamesForCertificateWithPolicy(crt, CommonNameSANPolicyOmit)
+	if cn := strings.ToLower(CommonNameForCertificate(crt)); isHostname(cn) {
+		names = append([]string{cn}, names...)
+	}
+	return removeDuplicates(names)
+}
+
+func withinAnySuffix(name string, suffixes []string) bool {
+	for _, suffix := range suffixes {
+		suffix = normaliseDNSName(suffix)
+		if strings.HasPrefix(suffix, "*.") {
+			if strings.HasSuffix(name, suffix[1:]) {
+				return true
+			}
+			continue
+		}
+		if name == suffix || strings.HasSuffix(name, "."+suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// PublicSuffixList provides the public suffix of a domain, such as "co.uk"
+// for "www.example.co.uk". It is satisfied by the List of
+// golang.org/x/net/publicsuffix and by net/http/cookiejar.PublicSuffixList.
+type PublicSuffixList interface {
+	PublicSuffix(domain string) string
+}
+
+// PublicSuffixes returns a PublicSuffixList that treats each of the given
+// suffixes as public, and otherwise falls back to list, such as
+// publicsuffix.List. list may be nil, in which case only the given suffixes
+// are public.
+// This allows internal suffixes, which are not in the Public Suffix List, to
+// be protected in the same way.
+func PublicSuffixes(list PublicSuffixList, suffixes ...string) PublicSuffixList {
+	return staticPublicSuffixList{list: list, suffixes: suffixes}
+}
+
+type staticPublicSuffixList struct {
+	list     PublicSuffixList
+	suffixes []string
+}
+
+// PublicSuffix returns the longest of the configured suffixes that the
+// domain is within, or the suffix returned by the fallback list if it is
+// longer.
+func (l staticPublicSuffixList) PublicSuffix(domain string) string {
+	longest := ""
+	for _, suffix := range l.suffixes {
+		suffix = normaliseDNSName(suffix)
+		if (domain == suffix || strings.HasSuffix(domain, "."+suffix)) && len(suffix) > len(longest) {
+			longest = suffix
+		}
+	}
+	if l.list != nil {
+		if suffix := l.list.PublicSuffix(domain); len(suffix) > len(longest) {
+			longest = suffix
+		}
+	}
+	return longest
+}
+
+// ValidateNoWildcardOnPublicSuffix returns an error if any wildcard DNS name
+// of the given Certificate, or its common name if it is a hostname, would
+// match every domain directly under a public suffix, such as "*.com" or
+// "*.co.uk". Names are checked as they will be issued, as returned by
+// issuedHostnames.
+// If suffixes is nil, the Public Suffix List of golang.org/x/net/publicsuffix
+// is used. Use PublicSuffixes to also protect internal suffixes.
+func ValidateNoWildcardOnPublicSuffix(crt *v1alpha1.Certificate, suffixes PublicSuffixList) error {
+	if suffixes == nil {
+		suffixes = publicsuffix.List
+	}
+	for _, name := range issuedHostnames(crt) {
+		normalised := normaliseDNSName(name)
+		if !strings.HasPrefix(normalised, "*.") {
+			continue
+		}
+		parent := normalised[2:]
+		if suffixes.PublicSuffix(parent) == parent {
+			return fmt.Errorf("wildcard %q spans the public suffix %q", name, parent)
+		}
+	}
+	return nil
+}
+
+// CALeafUsagePolicy determines how ValidateCAExtKeyUsages reports a CA
+// certificate that has extended key usages typical of a leaf certificate.
+type CALeafUsagePolicy int
+
+const (
+	// CALeafUsageWarn returns an error for which errors.IsWarning is true,
+	// so that the misconfiguration can be reported without blocking
+	// issuance. This is the default.
+	CALeafUsageWarn CALeafUsagePolicy = iota
+
+	// CALeafUsageError returns a plain error.
+	CALeafUsageError
+)
+
+// leafExtKeyUsages are the extended key usages that identify an end entity,
+// and so are not expected on a CA certificate.
+var leafExtKeyUsages = []x509.ExtKeyUsage{
+	x509.ExtKeyUsageServerAuth,
+	x509.ExtKeyUsageClientAuth,
+}
+
+// ValidateCAExtKeyUsages returns an error if the given template is a CA but
+// has the serverAuth or clientAuth extended key usages, which is usually the
+// result of copying the configuration of a leaf certificate.
+// The kind of error returned is determined by policy.
+func ValidateCAExtKeyUsages(tmpl *x509.Certificate, policy CALeafUsagePolicy) error {
+	if !tmpl.IsCA {
+		return nil
+	}
+	var found []string
+	for _, leaf := range leafExtKeyUsages {
+		for _, usage := range tmpl.ExtKeyUsage {
+			if usage == leaf {
+				found = append(found, extKeyUsageName(usage))
+				break
+			}
+		}
+	}
+	if len(found) == 0 {
+		return nil
+	}
+	msg := fmt.Sprintf("CA certificate has leaf extended key usages: %s", strings.Join(found, ", "))
+	if policy == CALeafUsageError {
+		return fmt.Errorf("%s", msg)
+	}
+	return errors.NewWarning("%s", msg)
+}
+
+// ValidateKeyUsageConsistency returns an error if the given key usages are
+// contradictory, with one error for each violation:
+//   - the usage set is empty
+//   - certSign or cRLSign is set on a certificate that is not a CA
+//   - encipherOnly or decipherOnly is set without keyAgreement, as RFC 5280
+//     only defines their meaning when keyAgreement is set
+func ValidateKeyUsageConsistency(keyUsage x509.KeyUsage, isCA bool) error {
+	if keyUsage == 0 {
+		return fmt.Errorf("no key usages set")
+	}
+	var errs []error
+	if !isCA {
+		if keyUsage&x509.KeyUsageCertSign != 0 {
+			errs = append(errs, fmt.Errorf("certSign key usage set on a certificate that is not a CA"))
+		}
+		if keyUsage&x509.KeyUsageCRLSign != 0 {
+			errs = append(errs, fmt.Errorf("cRLSign key usage set on a certificate that is not a CA"))
+		}
+	}
+	if keyUsage&x509.KeyUsageKeyAgreement == 0 {
+		if keyUsage&x509.KeyUsageEncipherOnly != 0 {
+			errs = append(errs, fmt.Errorf("encipherOnly key usage set without keyAgreement"))
+		}
+		if keyUsage&x509.KeyUsageDecipherOnly != 0 {
+			errs = append(errs, fmt.Errorf("decipherOnly key usage set without keyAgreement"))
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// ValidateBasicConstraintsForRole returns an error if the basic constraints of
+// the given certificate do not match its intended role, as a CA if expectCA
+// is true or as a leaf otherwise.
+// A CA must have a BasicConstraints extension with the cA flag set, and RFC
+// 5280 requires the extension to be critical. A CA whose BasicConstraints
+// extension is not critical results in an error for which errors.IsWarning is
+// true, as some clients accept such CAs.
+func ValidateBasicConstraintsForRole(cert *x509.Certificate, expectCA bool) error {
+	if !expectCA {
+		if cert.IsCA {
+			return fmt.Errorf("certificate %q is intended to be a leaf, but is a CA", cert.Subject.String())
+		}
+		return nil
+	}
+	if !cert.BasicConstraintsValid {
+		return fmt.Errorf("certificate %q is intended to be a CA, but has no basic constraints", cert.Subject.String())
+	}
+	if !cert.IsCA {
+		return fmt.Errorf("certificate %q is intended to be a CA, but is not a CA", cert.Subject.String())
+	}
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(OIDExtensionBasicConstraints) && !ext.Critical {
+			return errors.NewWarning("CA certificate %q has a non-critical basic constraints extension", cert.Subject.String())
+		}
+	}
+	return nil
+}
+
+// isHostname returns true if the given common name looks like a DNS name,
+// rather than a descriptive name or an IP address.
+func isHostname(cn string) bool {
+	if !strings.Contains(cn, ".") || net.ParseIP(cn) != nil {
+		return false
+	}
+	for _, r := range cn {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-', r == '.', r == '*':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// ValidateCSRSubject returns an error if the subject of the given certificate
+// request does not include each of the required organizations and countries,
+// e.g. to gate externally submitted CSRs against subject policy before
+// issuance. Values are matched exactly. Any other attributes or values in the
+// subject are allowed.
+// The error lists every missing value.
+func ValidateCSRSubject(csr *x509.CertificateRequest, requiredOrg, requiredCountry []string) error {
+	var missing []string
+	for _, org := range requiredOrg {
+		if !containsString(csr.Subject.Organization, org) {
+			missing = append(missing, fmt.Sprintf("organization %q", org))
+		}
+	}
+	for _, country := range requiredCountry {
+		if !containsString(csr.Subject.Country, country) {
+			missing = append(missing, fmt.Sprintf("country %q", country))
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("certificate request subject %q is missing required attributes: %s", csr.Subject.String(), strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
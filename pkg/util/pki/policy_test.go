@@ -0,0 +1,564 @@
+/*
+Copyright 2019 The Jetstack cert-manager contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pki
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/publicsuffix"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+
+	"github.com/jetstack/cert-manager/pkg/apis/certmanager/v1alpha1"
+	"github.com/jetstack/cert-manager/pkg/util/errors"
+)
+
+func TestDisallowedCurvesInChain(t *testing.T) {
+	p384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p224Key, err := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := GenerateRSAPrivateKey(MinRSAKeySize)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root, _ := signTestCertificate(t, buildCACertificate("root"), nil, nil, withSignTestKey(p384Key))
+	intermediate, _ := signTestCertificate(t, buildCACertificate("intermediate"), root, p384Key, withSignTestKey(p224Key))
+	leaf, _ := signTestCertificate(t, buildCertificate("leaf"), intermediate, p224Key, withSignTestKey(rsaKey))
+
+	allowed := []elliptic.Curve{elliptic.P256(), elliptic.P384()}
+
+	disallowed := DisallowedCurvesInChain([]*x509.Certificate{leaf, intermediate, root}, allowed)
+	expected := []string{intermediate.Subject.String()}
+	if !reflect.DeepEqual(disallowed, expected) {
+		t.Errorf("expected %q but got %q", expected, disallowed)
+	}
+
+	if disallowed := DisallowedCurvesInChain([]*x509.Certificate{leaf, root}, allowed); len(disallowed) != 0 {
+		t.Errorf("expected no disallowed curves but got %q", disallowed)
+	}
+}
+
+func TestValidateSANsWithinSuffix(t *testing.T) {
+	allowed := []string{"tenant-a.example.com", "*.apps.example.com"}
+	type testT struct {
+		name        string
+		cn          string
+		dnsNames    []string
+		expectedErr bool
+	}
+	tests := []testT{
+		{
+			name:     "names within the suffix",
+			cn:       "tenant-a.example.com",
+			dnsNames: []string{"www.tenant-a.example.com", "*.tenant-a.example.com", "API.Tenant-A.example.com."},
+		},
+		{
+			name:     "subdomain of a wildcard suffix",
+			dnsNames: []string{"foo.apps.example.com", "*.apps.example.com"},
+		},
+		{
+			name:        "apex of a wildcard suffix",
+			dnsNames:    []string{"apps.example.com"},
+			expectedErr: true,
+		},
+		{
+			name:        "san outside the suffix",
+			dnsNames:    []string{"www.tenant-a.example.com", "www.tenant-b.example.com"},
+			expectedErr: true,
+		},
+		{
+			name:        "wildcard covering other tenants",
+			dnsNames:    []string{"*.example.com"},
+			expectedErr: true,
+		},
+		{
+			name:        "suffix matching without a label boundary",
+			dnsNames:    []string{"eviltenant-a.example.com"},
+			expectedErr: true,
+		},
+		{
+			name:        "hostname common name outside the suffix",
+			cn:          "www.tenant-b.example.com",
+			dnsNames:    []string{"www.tenant-a.example.com"},
+			expectedErr: true,
+		},
+		{
+			name:     "padded and upper cased names within the suffix",
+			cn:       " WWW.Tenant-A.example.com",
+			dnsNames: []string{"api.tenant-a.example.com ", "\tFoo.Apps.Example.com"},
+		},
+		{
+			name:        "padded dns name outside the suffix",
+			dnsNames:    []string{"www.tenant-a.example.com", " www.tenant-b.example.com "},
+			expectedErr: true,
+		},
+		{
+			name:        "hostname common name outside the suffix with trailing space",
+			cn:          "evil.com ",
+			dnsNames:    []string{"a.tenant-a.example.com"},
+			expectedErr: true,
+		},
+		{
+			name:     "descriptive common name is ignored",
+			cn:       "Tenant A web server",
+			dnsNames: []string{"www.tenant-a.example.com"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := ValidateSANsWithinSuffix(buildCertificate(test.cn, test.dnsNames...), allowed)
+			if err != nil && !test.expectedErr {
+				t.Errorf("expected no error but got: %v", err)
+			}
+			if err == nil && test.expectedErr {
+				t.Errorf("expected an error but got none")
+			}
+		})
+	}
+}
+
+func TestIssuedHostnamesMatchTemplate(t *testing.T) {
+	crt := buildCertificate(" WWW.Example.com ", "API.example.com\t", " www.example.com")
+	template, err := GenerateTemplate(nil, crt)
+	if err != nil {
+		t.Fatalf("error generating template: %v", err)
+	}
+	if names := issuedHostnames(crt); !reflect.DeepEqual(names, template.DNSNames) {
+		t.Errorf("expected policy checks to apply to the issued names %q but got %q", template.DNSNames, names)
+	}
+}
+
+func TestValidateNoWildcardOnPublicSuffix(t *testing.T) {
+	suffixes := PublicSuffixes(publicsuffix.List, "svc.cluster.local")
+	type testT struct {
+		name        string
+		cn          string
+		dnsNames    []string
+		suffixes    PublicSuffixList
+		expectedErr bool
+	}
+	tests := []testT{
+		{
+			name:        "wildcard on a top level domain",
+			dnsNames:    []string{"example.com", "*.com"},
+			suffixes:    suffixes,
+			expectedErr: true,
+		},
+		{
+			name:     "wildcard under a registered domain",
+			dnsNames: []string{"*.example.com", "*.example.co.uk"},
+			suffixes: suffixes,
+		},
+		{
+			name:        "wildcard on a multi-label public suffix",
+			dnsNames:    []string{"*.CO.UK."},
+			suffixes:    suffixes,
+			expectedErr: true,
+		},
+		{
+			name:        "wildcard on a configured internal suffix",
+			dnsNames:    []string{"*.svc.cluster.local"},
+			suffixes:    suffixes,
+			expectedErr: true,
+		},
+		{
+			name:        "wildcard common name on a public suffix",
+			cn:          "*.com",
+			dnsNames:    []string{"www.example.com"},
+			suffixes:    suffixes,
+			expectedErr: true,
+		},
+		{
+			name:     "padded wildcards under a registered domain",
+			cn:       " *.Example.com",
+			dnsNames: []string{"*.example.co.uk\n"},
+			suffixes: suffixes,
+		},
+		{
+			name:        "padded wildcard on a public suffix",
+			dnsNames:    []string{" *.com"},
+			suffixes:    suffixes,
+			expectedErr: true,
+		},
+		{
+			name:        "padded wildcard common name on a public suffix",
+			cn:          "*.com ",
+			suffixes:    suffixes,
+			expectedErr: true,
+		},
+		{
+			name:        "public suffix list used by default",
+			dnsNames:    []string{"*.co.uk"},
+			expectedErr: true,
+		},
+		{
+			name:     "registered domain under the default public suffix list",
+			dnsNames: []string{"*.example.co.uk"},
+		},
+		{
+			name:     "internal suffix not in the public suffix list",
+			dnsNames: []string{"*.svc.cluster.local"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := ValidateNoWildcardOnPublicSuffix(buildCertificate(test.cn, test.dnsNames...), test.suffixes)
+			if err != nil && !test.expectedErr {
+				t.Errorf("expected no error but got: %v", err)
+			}
+			if err == nil && test.expectedErr {
+				t.Errorf("expected an error but got none")
+			}
+		})
+	}
+}
+
+func TestGenerateTemplatePublicSuffixWildcardCheck(t *testing.T) {
+	crt := buildCertificate("", "*.co.uk")
+	if _, err := GenerateTemplate(nil, crt); err != nil {
+		t.Errorf("expected the check to be disabled by default but got: %v", err)
+	}
+	if _, err := GenerateTemplate(nil, crt, WithPublicSuffixWildcardCheck(nil)); err == nil || !strings.Contains(err.Error(), "*.co.uk") {
+		t.Errorf("expected an error naming the wildcard but got: %v", err)
+	}
+	if _, err := GenerateTemplateWithProfile(nil, crt, &IssuanceProfile{RejectPublicSuffixWildcards: true}); err == nil {
+		t.Errorf("expected an error from the profile")
+	}
+	if _, err := GenerateTemplate(nil, buildCertificate("", "*.example.co.uk"), WithPublicSuffixWildcardCheck(nil)); err != nil {
+		t.Errorf("expected no error for a registered domain but got: %v", err)
+	}
+}
+
+func TestSignatureAlgorithmAllowlist(t *testing.T) {
+	crt := buildCertificate("test", "test.example.com")
+
+	if _, err := GenerateTemplate(nil, crt, WithSignatureAlgorithm(x509.SHA1WithRSA)); err == nil {
+		t.Errorf("expected an error generating a template with a SHA-1 signature")
+	}
+	if _, err := GenerateCSR(nil, crt, WithSignatureAlgorithm(x509.MD5WithRSA)); err == nil {
+		t.Errorf("expected an error generating a csr with an MD5 signature")
+	}
+
+	template, err := GenerateTemplate(nil, crt, WithSignatureAlgorithm(x509.SHA384WithRSA))
+	if err != nil {
+		t.Fatalf("expected no error generating a template with an allowed signature algorithm, but got: %v", err)
+	}
+	if template.SignatureAlgorithm != x509.SHA384WithRSA {
+		t.Errorf("expected signature algorithm %s but got %s", x509.SHA384WithRSA, template.SignatureAlgorithm)
+	}
+
+	// the default signature algorithm for a CSR must also be permitted
+	_, err = GenerateCSR(nil, crt, WithAllowedSignatureAlgorithms(x509.SHA512WithRSA))
+	if err == nil {
+		t.Errorf("expected an error generating a csr with a signature algorithm outside a custom allowlist")
+	}
+	csr, err := GenerateCSR(nil, crt, WithAllowedSignatureAlgorithms(x509.SHA512WithRSA), WithSignatureAlgorithm(x509.SHA512WithRSA))
+	if err != nil {
+		t.Fatalf("expected no error generating a csr with a custom allowlist, but got: %v", err)
+	}
+	if csr.SignatureAlgorithm != x509.SHA512WithRSA {
+		t.Errorf("expected signature algorithm %s but got %s", x509.SHA512WithRSA, csr.SignatureAlgorithm)
+	}
+}
+
+func TestValidateCAExtKeyUsages(t *testing.T) {
+	type testT struct {
+		name          string
+		isCA          bool
+		usages        []x509.ExtKeyUsage
+		policy        CALeafUsagePolicy
+		expectErr     bool
+		expectWarning bool
+	}
+	tests := []testT{
+		{
+			name:          "ca requesting serverAuth warns by default",
+			isCA:          true,
+			usages:        []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+			expectErr:     true,
+			expectWarning: true,
+		},
+		{
+			name:      "ca requesting clientAuth with error policy",
+			isCA:      true,
+			usages:    []x509.ExtKeyUsage{x509.ExtKeyUsageOCSPSigning, x509.ExtKeyUsageClientAuth},
+			policy:    CALeafUsageError,
+			expectErr: true,
+		},
+		{
+			name:   "ca without leaf usages",
+			isCA:   true,
+			usages: []x509.ExtKeyUsage{x509.ExtKeyUsageOCSPSigning},
+			policy: CALeafUsageError,
+		},
+		{
+			name:   "leaf requesting serverAuth",
+			usages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+			policy: CALeafUsageError,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := ValidateCAExtKeyUsages(&x509.Certificate{IsCA: test.isCA, ExtKeyUsage: test.usages}, test.policy)
+			if (err != nil) != test.expectErr {
+				t.Fatalf("expected error %v but got: %v", test.expectErr, err)
+			}
+			if err != nil && errors.IsWarning(err) != test.expectWarning {
+				t.Errorf("expected warning %v but got: %v", test.expectWarning, err)
+			}
+		})
+	}
+}
+
+func TestGenerateTemplateCALeafUsagePolicy(t *testing.T) {
+	crt := buildCACertificate("ca")
+	crt.Spec.Usages = []v1alpha1.KeyUsage{v1alpha1.UsageCertSign, v1alpha1.UsageServerAuth}
+
+	// the default policy only warns, so the certificate is still issued
+	template, err := GenerateTemplate(nil, crt)
+	if err != nil {
+		t.Fatalf("expected no error with the default policy but got: %v", err)
+	}
+	if len(template.ExtKeyUsage) != 1 || template.ExtKeyUsage[0] != x509.ExtKeyUsageServerAuth {
+		t.Errorf("expected the serverAuth extended key usage but got %v", template.ExtKeyUsage)
+	}
+
+	if _, err := GenerateTemplate(nil, crt, WithCALeafUsagePolicy(CALeafUsageError)); err == nil {
+		t.Errorf("expected an error with the error policy but got none")
+	}
+	if _, err := GenerateTemplateWithProfile(nil, crt, &IssuanceProfile{CALeafUsagePolicy: CALeafUsageError}); err == nil {
+		t.Errorf("expected an error with the error policy of the profile but got none")
+	}
+
+	// leaf certificates are expected to have serverAuth
+	leaf := buildCertificate("leaf", "example.com")
+	leaf.Spec.Usages = []v1alpha1.KeyUsage{v1alpha1.UsageDigitalSignature, v1alpha1.UsageServerAuth}
+	if _, err := GenerateTemplate(nil, leaf, WithCALeafUsagePolicy(CALeafUsageError)); err != nil {
+		t.Errorf("expected no error for a leaf certificate but got: %v", err)
+	}
+}
+
+func TestValidateKeyUsageConsistency(t *testing.T) {
+	type testT struct {
+		name           string
+		keyUsage       x509.KeyUsage
+		isCA           bool
+		expectedErrors int
+	}
+	tests := []testT{
+		{
+			name:     "leaf usages",
+			keyUsage: x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		},
+		{
+			name:     "ca usages",
+			keyUsage: x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+			isCA:     true,
+		},
+		{
+			name:     "encipherOnly with keyAgreement",
+			keyUsage: x509.KeyUsageKeyAgreement | x509.KeyUsageEncipherOnly,
+		},
+		{
+			name:           "empty usage set",
+			expectedErrors: 1,
+		},
+		{
+			name:           "certSign without isCA",
+			keyUsage:       x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+			expectedErrors: 1,
+		},
+		{
+			name:           "crlSign without isCA",
+			keyUsage:       x509.KeyUsageCRLSign,
+			expectedErrors: 1,
+		},
+		{
+			name:           "encipherOnly without keyAgreement",
+			keyUsage:       x509.KeyUsageDigitalSignature | x509.KeyUsageEncipherOnly,
+			expectedErrors: 1,
+		},
+		{
+			name:           "decipherOnly without keyAgreement",
+			keyUsage:       x509.KeyUsageDigitalSignature | x509.KeyUsageDecipherOnly,
+			expectedErrors: 1,
+		},
+		{
+			name:           "multiple violations",
+			keyUsage:       x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageEncipherOnly,
+			expectedErrors: 3,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := ValidateKeyUsageConsistency(test.keyUsage, test.isCA)
+			if test.expectedErrors == 0 {
+				if err != nil {
+					t.Errorf("expected no error but got: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected %d errors but got none", test.expectedErrors)
+			}
+			errs := 1
+			if agg, ok := err.(utilerrors.Aggregate); ok {
+				errs = len(agg.Errors())
+			}
+			if errs != test.expectedErrors {
+				t.Errorf("expected %d errors but got %d: %v", test.expectedErrors, errs, err)
+			}
+		})
+	}
+}
+
+func TestValidateBasicConstraintsForRole(t *testing.T) {
+	pk, err := GenerateECPrivateKey(ECCurve256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, _ := signTestCertificate(t, buildCACertificate("ca"), nil, nil, withSignTestKey(pk))
+	leaf, _ := signTestCertificate(t, buildCertificate("leaf"), ca, pk, withSignTestKey(pk))
+
+	// Go always marks the basic constraints extension critical, so a
+	// non-critical one is only seen on imported certificates
+	nonCriticalCA := *ca
+	nonCriticalCA.Extensions = []pkix.Extension{{Id: OIDExtensionBasicConstraints, Critical: false}}
+
+	noConstraints := *ca
+	noConstraints.BasicConstraintsValid = false
+	noConstraints.IsCA = false
+
+	type testT struct {
+		name          string
+		cert          *x509.Certificate
+		expectCA      bool
+		expectErr     bool
+		expectWarning bool
+	}
+	tests := []testT{
+		{
+			name:     "ca expected to be a ca",
+			cert:     ca,
+			expectCA: true,
+		},
+		{
+			name: "leaf expected to be a leaf",
+			cert: leaf,
+		},
+		{
+			name:      "ca expected to be a leaf",
+			cert:      ca,
+			expectErr: true,
+		},
+		{
+			name:      "leaf expected to be a ca",
+			cert:      leaf,
+			expectCA:  true,
+			expectErr: true,
+		},
+		{
+			name:      "ca without basic constraints",
+			cert:      &noConstraints,
+			expectCA:  true,
+			expectErr: true,
+		},
+		{
+			name:          "ca with non-critical basic constraints",
+			cert:          &nonCriticalCA,
+			expectCA:      true,
+			expectErr:     true,
+			expectWarning: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := ValidateBasicConstraintsForRole(test.cert, test.expectCA)
+			if (err != nil) != test.expectErr {
+				t.Fatalf("expected error %v but got: %v", test.expectErr, err)
+			}
+			if err != nil && errors.IsWarning(err) != test.expectWarning {
+				t.Errorf("expected warning %v but got: %v", test.expectWarning, err)
+			}
+		})
+	}
+}
+
+func TestValidateCSRSubject(t *testing.T) {
+	type testT struct {
+		name            string
+		subject         pkix.Name
+		expectedMissing []string
+	}
+	tests := []testT{
+		{
+			name: "required attributes present with extra attributes",
+			subject: pkix.Name{
+				CommonName:         "test",
+				Organization:       []string{"Other", "Example Corp"},
+				OrganizationalUnit: []string{"Engineering"},
+				Country:            []string{"GB"},
+			},
+		},
+		{
+			name: "missing organization",
+			subject: pkix.Name{
+				CommonName:   "test",
+				Organization: []string{"Other"},
+				Country:      []string{"GB"},
+			},
+			expectedMissing: []string{`organization "Example Corp"`},
+		},
+		{
+			name:            "missing organization and country",
+			subject:         pkix.Name{CommonName: "test"},
+			expectedMissing: []string{`organization "Example Corp"`, `country "GB"`},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			csr := &x509.CertificateRequest{Subject: test.subject}
+			err := ValidateCSRSubject(csr, []string{"Example Corp"}, []string{"GB"})
+			if len(test.expectedMissing) == 0 {
+				if err != nil {
+					t.Errorf("expected no error but got: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected an error but got none")
+			}
+			for _, missing := range test.expectedMissing {
+				if !strings.Contains(err.Error(), missing) {
+					t.Errorf("expected error to list %s but got: %v", missing, err)
+				}
+			}
+		})
+	}
+}
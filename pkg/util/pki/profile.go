@@ -0,0 +1,93 @@
+/*
+Copyright 2019 The Jetstack cert-manager contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pki
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+// Profile describes the algorithms and key sizes that the certificates in a
+// chain must use.
+type Profile struct {
+	// Name is a human readable name for the profile, used in errors.
+	Name string
+
+	// SignatureAlgorithms are the permitted signature algorithms.
+	SignatureAlgorithms []x509.SignatureAlgorithm
+
+	// MinRSAKeySize is the minimum size of RSA public keys, in bits.
+	MinRSAKeySize int
+
+	// Curves are the permitted curves of ECDSA public keys.
+	Curves []elliptic.Curve
+}
+
+var (
+	// ProfileModern requires SHA-256 or stronger signatures, RSA keys of at
+	// least 2048 bits and ECDSA keys on P-256 or larger curves.
+	ProfileModern = Profile{
+		Name:                "modern",
+		SignatureAlgorithms: DefaultAllowedSignatureAlgorithms,
+		MinRSAKeySize:       MinRSAKeySize,
+		Curves:              []elliptic.Curve{elliptic.P256(), elliptic.P384(), elliptic.P521()},
+	}
+
+	// ProfileLegacy additionally permits SHA-1 signatures, RSA keys of at
+	// least 1024 bits and ECDSA keys on P-224, for interoperability with
+	// older hierarchies.
+	ProfileLegacy = Profile{
+		Name: "legacy",
+		SignatureAlgorithms: append([]x509.SignatureAlgorithm{
+			x509.SHA1WithRSA,
+			x509.ECDSAWithSHA1,
+		}, DefaultAllowedSignatureAlgorithms...),
+		MinRSAKeySize: 1024,
+		Curves:        []elliptic.Curve{elliptic.P224(), elliptic.P256(), elliptic.P384(), elliptic.P521()},
+	}
+)
+
+// ChainMeetsProfile checks every certificate in the given chain against the
+// given profile. All violations across the chain are returned as a single
+// aggregate error, or nil if the chain meets the profile.
+func ChainMeetsProfile(certs []*x509.Certificate, profile Profile) error {
+	var errs []error
+	for _, cert := range certs {
+		if err := validateSignatureAlgorithm(cert.SignatureAlgorithm, profile.SignatureAlgorithms); err != nil {
+			errs = append(errs, fmt.Errorf("%q does not meet the %s profile: %v", cert.Subject.String(), profile.Name, err))
+		}
+
+		switch pub := cert.PublicKey.(type) {
+		case *rsa.PublicKey:
+			if pub.N.BitLen() < profile.MinRSAKeySize {
+				errs = append(errs, fmt.Errorf("%q does not meet the %s profile: rsa key size %d is less than %d",
+					cert.Subject.String(), profile.Name, pub.N.BitLen(), profile.MinRSAKeySize))
+			}
+		case *ecdsa.PublicKey:
+			if !curveAllowed(pub.Curve, profile.Curves) {
+				errs = append(errs, fmt.Errorf("%q does not meet the %s profile: ecdsa curve %s is not permitted",
+					cert.Subject.String(), profile.Name, pub.Curve.Params().Name))
+			}
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
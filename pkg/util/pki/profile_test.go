@@ -0,0 +1,77 @@
+/*
+Copyright 2019 The Jetstack cert-manager contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pki
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"testing"
+
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+func TestChainMeetsProfile(t *testing.T) {
+	rootKey, err := GenerateECPrivateKey(ECCurve384)
+	if err != nil {
+		t.Fatal(err)
+	}
+	weakKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	strongKey, err := GenerateRSAPrivateKey(MinRSAKeySize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafKey, err := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root, _ := signTestCertificate(t, buildCACertificate("root"), nil, nil, withSignTestKey(rootKey))
+	weakIntermediate, _ := signTestCertificate(t, buildCACertificate("weak-intermediate"), root, rootKey, withSignTestKey(weakKey))
+	strongIntermediate, _ := signTestCertificate(t, buildCACertificate("strong-intermediate"), root, rootKey, withSignTestKey(strongKey))
+	leaf, _ := signTestCertificate(t, buildCertificate("leaf"), weakIntermediate, weakKey, withSignTestKey(leafKey))
+
+	if err := ChainMeetsProfile([]*x509.Certificate{strongIntermediate, root}, ProfileModern); err != nil {
+		t.Errorf("expected chain to meet the modern profile but got: %v", err)
+	}
+
+	err = ChainMeetsProfile([]*x509.Certificate{weakIntermediate, root}, ProfileModern)
+	if err == nil {
+		t.Fatalf("expected chain with a weak intermediate to fail the modern profile")
+	}
+	if errs := err.(utilerrors.Aggregate).Errors(); len(errs) != 1 {
+		t.Errorf("expected 1 violation but got %d: %v", len(errs), err)
+	}
+
+	// violations across the whole chain are reported together
+	err = ChainMeetsProfile([]*x509.Certificate{leaf, weakIntermediate, root}, ProfileModern)
+	if err == nil {
+		t.Fatalf("expected chain with a weak intermediate and leaf to fail the modern profile")
+	}
+	if errs := err.(utilerrors.Aggregate).Errors(); len(errs) != 2 {
+		t.Errorf("expected 2 violations but got %d: %v", len(errs), err)
+	}
+
+	if err := ChainMeetsProfile([]*x509.Certificate{leaf, weakIntermediate, root}, ProfileLegacy); err != nil {
+		t.Errorf("expected chain to meet the legacy profile but got: %v", err)
+	}
+}
@@ -0,0 +1,512 @@
+/*
+Copyright 2019 The Jetstack cert-manager contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pki
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/jetstack/cert-manager/pkg/apis/certmanager/v1alpha1"
+	"github.com/jetstack/cert-manager/pkg/util/x509util"
+)
+
+// SANSetHash returns a stable hash over the set of subject alternative names
+// that would be present on a certificate issued for the given Certificate
+// resource, covering its DNS names, IP addresses, email addresses and URIs.
+// SANs are normalised and sorted before hashing, so reordering the SANs on
+// the spec will not change the hash. This allows changes to the SANs to be
+// detected independently of other changes to the spec.
+func SANSetHash(crt *v1alpha1.Certificate) string {
+	var sans []string
+	for _, dnsName := range DNSNamesForCertificate(crt) {
+		sans = append(sans, "dns:"+normaliseDNSName(dnsName))
+	}
+	for _, ip := range IPAddressesForCertificate(crt) {
+		sans = append(sans, "ip:"+ip.String())
+	}
+	_, _, emailAddresses := canonicalSANs(nil, nil, EmailAddressesForCertificate(crt))
+	for _, email := range emailAddresses {
+		sans = append(sans, "email:"+email)
+	}
+	for _, uri := range URIsForCertificate(crt) {
+		sans = append(sans, "uri:"+uri.String())
+	}
+	sans = removeDuplicates(sans)
+	sort.Strings(sans)
+
+	h := sha256.Sum256([]byte(strings.Join(sans, "\n")))
+	return hex.EncodeToString(h[:])
+}
+
+// normaliseDNSName returns the canonical form of a DNS name for comparison,
+// which is lower case and without a trailing dot.
+func normaliseDNSName(name string) string {
+	return strings.TrimSuffix(strings.ToLower(name), ".")
+}
+
+// canonicalSANs returns the given subject alternative names in canonical
+// form, so that logically identical Certificates produce identical SAN
+// extensions. DNS names are normalised as by normaliseDNSName, IP addresses
+// are reduced to 4 bytes if they are IPv4, the domains of email addresses are
+// lowercased, and duplicates are removed, keeping the first occurrence.
+func canonicalSANs(dnsNames []string, ipAddresses []net.IP, emailAddresses []string) ([]string, []net.IP, []string) {
+	var canonicalDNSNames []string
+	for _, name := range dnsNames {
+		canonicalDNSNames = append(canonicalDNSNames, normaliseDNSName(name))
+	}
+
+	var canonicalIPs []net.IP
+Outer:
+	for _, ip := range ipAddresses {
+		if ip4 := ip.To4(); ip4 != nil {
+			ip = ip4
+		}
+		for _, found := range canonicalIPs {
+			if found.Equal(ip) {
+				continue Outer
+			}
+		}
+		canonicalIPs = append(canonicalIPs, ip)
+	}
+
+	var canonicalEmails []string
+	for _, email := range emailAddresses {
+		if i := strings.LastIndex(email, "@"); i >= 0 {
+			// the local part may be case sensitive, but the domain is not
+			email = email[:i] + strings.ToLower(email[i:])
+		}
+		canonicalEmails = append(canonicalEmails, email)
+	}
+
+	return removeDuplicates(canonicalDNSNames), canonicalIPs, removeDuplicates(canonicalEmails)
+}
+
+// MatchesServerName reports whether the given certificate is valid for the
+// given TLS server name, such as that requested by a client using SNI, using
+// the hostname matching rules of RFC 6125.
+// If serverName is an IP address it is matched against the IP address SANs
+// of the certificate, otherwise it is matched case insensitively against the
+// DNS name SANs. A wildcard DNS name matches exactly one label on the left,
+// so "*.example.com" matches "www.example.com" but neither "example.com" nor
+// "a.b.example.com". The common name is ignored, as modern clients do.
+func MatchesServerName(cert *x509.Certificate, serverName string) bool {
+	serverName = strings.TrimSpace(serverName)
+	if ip := net.ParseIP(strings.TrimSuffix(strings.TrimPrefix(serverName, "["), "]")); ip != nil {
+		for _, certIP := range cert.IPAddresses {
+			if certIP.Equal(ip) {
+				return true
+			}
+		}
+		return false
+	}
+
+	serverName = normaliseDNSName(serverName)
+	if len(serverName) == 0 {
+		return false
+	}
+	for _, dnsName := range cert.DNSNames {
+		if matchesDNSName(normaliseDNSName(dnsName), serverName) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesDNSName reports whether the normalised host matches the normalised
+// DNS name pattern, which may have a wildcard as its leftmost label.
+func matchesDNSName(pattern, host string) bool {
+	if !strings.HasPrefix(pattern, "*.") {
+		return pattern == host
+	}
+	// the wildcard must not cover a whole domain such as "*.com", and
+	// matches a single, non-empty label
+	if strings.Count(pattern, ".") < 2 {
+		return false
+	}
+	i := strings.Index(host, ".")
+	return i > 0 && host[i:] == pattern[1:]
+}
+
+// validateSANCharacters returns an error if the given SAN value contains
+// invalid UTF-8 or a control character, such as a null byte or newline, which
+// could be interpreted ambiguously by other parsers. Leading and trailing
+// whitespace is ignored, as it is trimmed from SANs. The error names the kind
+// of SAN, the value and the byte offset of the offending character.
+func validateSANCharacters(kind, value string) error {
+	start := len(value) - len(strings.TrimLeftFunc(value, unicode.IsSpace))
+	trimmed := strings.TrimSpace(value)
+	for i := 0; i < len(trimmed); {
+		r, size := utf8.DecodeRuneInString(trimmed[i:])
+		if r == utf8.RuneError && size == 1 {
+			return fmt.Errorf("%s %q contains invalid UTF-8 at byte offset %d", kind, value, start+i)
+		}
+		if unicode.IsControl(r) {
+			return fmt.Errorf("%s %q contains a control character at byte offset %d", kind, value, start+i)
+		}
+		i += size
+	}
+	return nil
+}
+
+// OIDExtensionSubjectAltName is the OID of the X.509 SubjectAltName
+// extension.
+var OIDExtensionSubjectAltName = asn1.ObjectIdentifier{2, 5, 29, 17}
+
+// GeneralName tags, as defined in RFC 5280 section 4.2.1.6.
+const (
+	nameTypeOther   = 0
+	nameTypeEmail   = 1
+	nameTypeDNS     = 2
+	nameTypeDirName = 4
+	nameTypeURI     = 6
+	nameTypeIP      = 7
+)
+
+// OIDMicrosoftUPN is the type of an otherName subject alternative name that
+// holds a Microsoft user principal name, as used for Windows smartcard logon.
+var OIDMicrosoftUPN = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 20, 2, 3}
+
+// otherName is an otherName subject alternative name with a UTF8String value.
+type otherName struct {
+	typeID asn1.ObjectIdentifier
+	value  string
+}
+
+// otherNamesForCertificate returns the otherName subject alternative names of
+// the given Certificate, or an error if any type is not a valid OID.
+func otherNamesForCertificate(crt *v1alpha1.Certificate) ([]otherName, error) {
+	var names []otherName
+	for _, name := range crt.Spec.OtherNames {
+		typeID, err := ParseObjectIdentifier(name.OID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid otherName oid %q: %s", name.OID, err.Error())
+		}
+		if err := validateSANCharacters("otherName", name.UTF8Value); err != nil {
+			return nil, err
+		}
+		names = append(names, otherName{typeID: typeID, value: name.UTF8Value})
+	}
+	return names, nil
+}
+
+// ParseObjectIdentifier parses an OID in dotted decimal form, such as
+// "1.3.6.1.4.1.311.20.2.3".
+func ParseObjectIdentifier(s string) (asn1.ObjectIdentifier, error) {
+	return x509util.ParseObjectIdentifier(s)
+}
+
+// marshalOtherName returns the GeneralName encoding of the given otherName.
+// As defined in RFC 5280, this is an implicitly tagged OtherName SEQUENCE of
+// the type OID and the value, which is itself explicitly tagged.
+func marshalOtherName(name otherName) (asn1.RawValue, error) {
+	typeID, err := asn1.Marshal(name.typeID)
+	if err != nil {
+		return asn1.RawValue{}, fmt.Errorf("error encoding otherName type: %s", err.Error())
+	}
+	value, err := asn1.MarshalWithParams(name.value, "utf8")
+	if err != nil {
+		return asn1.RawValue{}, fmt.Errorf("error encoding otherName value: %s", err.Error())
+	}
+	explicitValue, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: value})
+	if err != nil {
+		return asn1.RawValue{}, fmt.Errorf("error encoding otherName value: %s", err.Error())
+	}
+	return asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: nameTypeOther, IsCompound: true, Bytes: append(typeID, explicitValue...)}, nil
+}
+
+// IPAddressSANEncoding selects how IP addresses are encoded in the
+// SubjectAltName extension.
+type IPAddressSANEncoding int
+
+const (
+	// IPAddressSANEncodingNative encodes IPv4 addresses as 4 bytes and IPv6
+	// addresses as 16 bytes, as crypto/x509 does.
+	IPAddressSANEncodingNative IPAddressSANEncoding = iota
+
+	// IPAddressSANEncodingIPv4MappedIPv6 encodes all IP addresses as 16
+	// bytes, with IPv4 addresses in their IPv4-mapped IPv6 form.
+	// Note that newer versions of crypto/x509 refuse to parse certificates
+	// containing IPv4-mapped IPv6 addresses, so this is only suitable for
+	// clients that require it.
+	IPAddressSANEncodingIPv4MappedIPv6
+)
+
+// marshalIPAddress returns the bytes of the given IP address using the given
+// encoding.
+func marshalIPAddress(ip net.IP, enc IPAddressSANEncoding) ([]byte, error) {
+	switch enc {
+	case IPAddressSANEncodingNative:
+		if ip4 := ip.To4(); ip4 != nil {
+			return ip4, nil
+		}
+		return ip.To16(), nil
+	case IPAddressSANEncodingIPv4MappedIPv6:
+		return ip.To16(), nil
+	default:
+		return nil, fmt.Errorf("unsupported IP address SAN encoding: %d", enc)
+	}
+}
+
+// requiresManualSANExtension returns true if the given options require the
+// SubjectAltName extension to be built by subjectAltNameExtension rather
+// than by crypto/x509.
+func requiresManualSANExtension(o *templateOptions) bool {
+	return o.ipAddressSANEncoding != IPAddressSANEncodingNative ||
+		len(o.directoryNameSANs) > 0 ||
+		len(o.otherNames) > 0
+}
+
+// subjectAltNameExtension builds the SubjectAltName extension for the given
+// template. ok is false if the template has no subject alternative names, in
+// which case the extension must be omitted entirely.
+func subjectAltNameExtension(template *x509.Certificate, o *templateOptions) (ext pkix.Extension, ok bool, err error) {
+	var names []asn1.RawValue
+	for _, name := range template.DNSNames {
+		names = append(names, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: nameTypeDNS, Bytes: []byte(name)})
+	}
+	for _, email := range template.EmailAddresses {
+		names = append(names, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: nameTypeEmail, Bytes: []byte(email)})
+	}
+	for _, ip := range template.IPAddresses {
+		b, err := marshalIPAddress(ip, o.ipAddressSANEncoding)
+		if err != nil {
+			return pkix.Extension{}, false, err
+		}
+		if b == nil {
+			return pkix.Extension{}, false, fmt.Errorf("invalid IP address: %v", ip)
+		}
+		names = append(names, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: nameTypeIP, Bytes: b})
+	}
+	for _, uri := range template.URIs {
+		names = append(names, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: nameTypeURI, Bytes: []byte(uri.String())})
+	}
+	for _, dirName := range o.directoryNameSANs {
+		// directoryName is an explicitly tagged Name
+		b, err := asn1.Marshal(dirName.ToRDNSequence())
+		if err != nil {
+			return pkix.Extension{}, false, fmt.Errorf("error encoding directory name: %s", err.Error())
+		}
+		names = append(names, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: nameTypeDirName, IsCompound: true, Bytes: b})
+	}
+	for _, other := range o.otherNames {
+		name, err := marshalOtherName(other)
+		if err != nil {
+			return pkix.Extension{}, false, err
+		}
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return pkix.Extension{}, false, nil
+	}
+
+	value, err := asn1.Marshal(names)
+	if err != nil {
+		return pkix.Extension{}, false, fmt.Errorf("error encoding subject alternative names: %s", err.Error())
+	}
+	return pkix.Extension{
+		Id: OIDExtensionSubjectAltName,
+		// RFC 5280 requires the extension to be critical if the subject is
+		// empty, which crypto/x509 does for the extension it generates
+		Critical: subjectIsEmpty(template),
+		Value:    value,
+	}, true, nil
+}
+
+// subjectIsEmpty returns true if the subject of the given template is an
+// empty distinguished name.
+func subjectIsEmpty(template *x509.Certificate) bool {
+	if len(template.RawSubject) > 0 {
+		var rdns pkix.RDNSequence
+		if _, err := asn1.Unmarshal(template.RawSubject, &rdns); err != nil {
+			return false
+		}
+		return len(rdns) == 0
+	}
+	return len(template.Subject.ToRDNSequence()) == 0
+}
+
+// SANSet is a set of subject alternative names.
+type SANSet struct {
+	DNSNames       []string
+	IPAddresses    []net.IP
+	EmailAddresses []string
+	URIs           []string
+}
+
+// MergePolicy determines how MergeSANs combines the subject alternative names
+// of a Certificate resource with those requested by a CSR.
+type MergePolicy int
+
+const (
+	// MergePolicySpecOnly uses only the SANs of the Certificate, ignoring
+	// those requested by the CSR. This is the default.
+	MergePolicySpecOnly MergePolicy = iota
+
+	// MergePolicyCSROnly uses only the SANs requested by the CSR, ignoring
+	// those of the Certificate.
+	MergePolicyCSROnly
+
+	// MergePolicyMergeAllowlisted uses the union of the SANs of the
+	// Certificate and those requested by the CSR. The DNS names and IP
+	// addresses of the Certificate also act as an allowlist for the CSR: a
+	// requested DNS name must be one of the Certificate's DNS names, ignoring
+	// case and any trailing dot, or be matched by one of its wildcard DNS
+	// names, which cover a single label as for MatchesServerName. A requested
+	// IP address must be one of the Certificate's IP addresses, and a
+	// requested email address or URI must be one of the Certificate's email
+	// addresses or URIs.
+	MergePolicyMergeAllowlisted
+)
+
+// MergeSANs returns the subject alternative names that should be issued for
+// the given Certificate resource and CSR under the given policy.
+// Duplicate names are removed, keeping the first occurrence, with the SANs of
+// the Certificate first. An error is returned if a SAN requested by the CSR
+// is not allowed under MergePolicyMergeAllowlisted.
+func MergeSANs(crt *v1alpha1.Certificate, csr *x509.CertificateRequest, policy MergePolicy) (SANSet, error) {
+	spec := SANSet{
+		DNSNames:       DNSNamesForCertificate(crt),
+		IPAddresses:    IPAddressesForCertificate(crt),
+		EmailAddresses: EmailAddressesForCertificate(crt),
+	}
+	for _, uri := range URIsForCertificate(crt) {
+		spec.URIs = append(spec.URIs, uri.String())
+	}
+	requested := SANSet{
+		DNSNames:       csr.DNSNames,
+		IPAddresses:    csr.IPAddresses,
+		EmailAddresses: csr.EmailAddresses,
+	}
+	for _, uri := range csr.URIs {
+		requested.URIs = append(requested.URIs, uri.String())
+	}
+
+	for _, dnsName := range requested.DNSNames {
+		if err := validateSANCharacters("requested DNS name", dnsName); err != nil {
+			return SANSet{}, err
+		}
+	}
+	for _, email := range requested.EmailAddresses {
+		if err := validateSANCharacters("requested email address", email); err != nil {
+			return SANSet{}, err
+		}
+	}
+	for _, uri := range requested.URIs {
+		if err := validateSANCharacters("requested URI", uri); err != nil {
+			return SANSet{}, err
+		}
+	}
+
+	switch policy {
+	case MergePolicySpecOnly:
+		return mergeSANSets(spec), nil
+	case MergePolicyCSROnly:
+		return mergeSANSets(requested), nil
+	case MergePolicyMergeAllowlisted:
+		for _, dnsName := range requested.DNSNames {
+			if !allowedDNSName(dnsName, spec.DNSNames) {
+				return SANSet{}, fmt.Errorf("requested DNS name %q is not one of the allowed DNS names: %s", dnsName, strings.Join(spec.DNSNames, ", "))
+			}
+		}
+		for _, ip := range requested.IPAddresses {
+			if !containsIP(spec.IPAddresses, ip) {
+				return SANSet{}, fmt.Errorf("requested IP address %q is not one of the allowed IP addresses", ip)
+			}
+		}
+		for _, email := range requested.EmailAddresses {
+			if !containsString(spec.EmailAddresses, email) {
+				return SANSet{}, fmt.Errorf("requested email address %q is not one of the allowed email addresses", email)
+			}
+		}
+		for _, uri := range requested.URIs {
+			if !containsString(spec.URIs, uri) {
+				return SANSet{}, fmt.Errorf("requested URI %q is not one of the allowed URIs", uri)
+			}
+		}
+		return mergeSANSets(spec, requested), nil
+	default:
+		return SANSet{}, fmt.Errorf("unsupported SAN merge policy: %d", policy)
+	}
+}
+
+// mergeSANSets returns the union of the given sets, removing duplicates and
+// keeping the first occurrence of each name. DNS names are compared
+// case-insensitively and ignoring any trailing dot.
+func mergeSANSets(sets ...SANSet) SANSet {
+	var merged SANSet
+	seen := make(map[string]bool)
+	add := func(key string) bool {
+		if seen[key] {
+			return false
+		}
+		seen[key] = true
+		return true
+	}
+	for _, set := range sets {
+		for _, dnsName := range set.DNSNames {
+			if add("dns:" + normaliseDNSName(dnsName)) {
+				merged.DNSNames = append(merged.DNSNames, dnsName)
+			}
+		}
+		for _, ip := range set.IPAddresses {
+			if add("ip:" + ip.String()) {
+				merged.IPAddresses = append(merged.IPAddresses, ip)
+			}
+		}
+		for _, email := range set.EmailAddresses {
+			if add("email:" + email) {
+				merged.EmailAddresses = append(merged.EmailAddresses, email)
+			}
+		}
+		for _, uri := range set.URIs {
+			if add("uri:" + uri) {
+				merged.URIs = append(merged.URIs, uri)
+			}
+		}
+	}
+	return merged
+}
+
+// allowedDNSName returns true if name is one of the allowed DNS names, or is
+// matched by one of the allowed wildcard DNS names.
+func allowedDNSName(name string, allowed []string) bool {
+	name = normaliseDNSName(name)
+	for _, pattern := range allowed {
+		if matchesDNSName(normaliseDNSName(pattern), name) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsIP(ips []net.IP, ip net.IP) bool {
+	for _, i := range ips {
+		if i.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,790 @@
+/*
+Copyright 2019 The Jetstack cert-manager contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pki
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jetstack/cert-manager/pkg/apis/certmanager/v1alpha1"
+)
+
+func TestSANSetHash(t *testing.T) {
+	base := &v1alpha1.Certificate{
+		Spec: v1alpha1.CertificateSpec{
+			CommonName:     "a.example.com",
+			DNSNames:       []string{"b.example.com", "c.example.com"},
+			IPAddresses:    []string{"10.0.0.1", "10.0.0.2"},
+			EmailAddresses: []string{"a@example.com", "b@example.com"},
+			URISANs:        []string{"spiffe://example.com/a", "spiffe://example.com/b"},
+		},
+	}
+	baseHash := SANSetHash(base)
+
+	type testT struct {
+		name       string
+		spec       v1alpha1.CertificateSpec
+		expectSame bool
+	}
+	tests := []testT{
+		{
+			name: "reordered sans",
+			spec: v1alpha1.CertificateSpec{
+				CommonName:     "a.example.com",
+				DNSNames:       []string{"c.example.com", "b.example.com"},
+				IPAddresses:    []string{"10.0.0.2", "10.0.0.1"},
+				EmailAddresses: []string{"b@example.com", "a@example.com"},
+				URISANs:        []string{"spiffe://example.com/b", "spiffe://example.com/a"},
+			},
+			expectSame: true,
+		},
+		{
+			name: "common name listed in dns names",
+			spec: v1alpha1.CertificateSpec{
+				DNSNames:       []string{"c.example.com", "a.example.com", "b.example.com"},
+				IPAddresses:    []string{"10.0.0.1", "10.0.0.2"},
+				EmailAddresses: []string{"a@example.com", "b@example.com"},
+				URISANs:        []string{"spiffe://example.com/a", "spiffe://example.com/b"},
+			},
+			expectSame: true,
+		},
+		{
+			name: "differently cased dns names",
+			spec: v1alpha1.CertificateSpec{
+				CommonName:     "A.example.com",
+				DNSNames:       []string{"B.EXAMPLE.COM", "c.example.com."},
+				IPAddresses:    []string{"10.0.0.1", "10.0.0.2"},
+				EmailAddresses: []string{"a@example.com", "b@example.com"},
+				URISANs:        []string{"spiffe://example.com/a", "spiffe://example.com/b"},
+			},
+			expectSame: true,
+		},
+		{
+			name: "additional dns name",
+			spec: v1alpha1.CertificateSpec{
+				CommonName:     "a.example.com",
+				DNSNames:       []string{"b.example.com", "c.example.com", "d.example.com"},
+				IPAddresses:    []string{"10.0.0.1", "10.0.0.2"},
+				EmailAddresses: []string{"a@example.com", "b@example.com"},
+				URISANs:        []string{"spiffe://example.com/a", "spiffe://example.com/b"},
+			},
+		},
+		{
+			name: "ip address changed",
+			spec: v1alpha1.CertificateSpec{
+				CommonName:     "a.example.com",
+				DNSNames:       []string{"b.example.com", "c.example.com"},
+				IPAddresses:    []string{"10.0.0.1", "10.0.0.3"},
+				EmailAddresses: []string{"a@example.com", "b@example.com"},
+				URISANs:        []string{"spiffe://example.com/a", "spiffe://example.com/b"},
+			},
+		},
+		{
+			name: "dns name moved to ip address",
+			spec: v1alpha1.CertificateSpec{
+				CommonName:     "a.example.com",
+				DNSNames:       []string{"b.example.com", "c.example.com", "10.0.0.2"},
+				IPAddresses:    []string{"10.0.0.1"},
+				EmailAddresses: []string{"a@example.com", "b@example.com"},
+				URISANs:        []string{"spiffe://example.com/a", "spiffe://example.com/b"},
+			},
+		},
+		{
+			name: "differently cased email domain",
+			spec: v1alpha1.CertificateSpec{
+				CommonName:     "a.example.com",
+				DNSNames:       []string{"b.example.com", "c.example.com"},
+				IPAddresses:    []string{"10.0.0.1", "10.0.0.2"},
+				EmailAddresses: []string{"a@EXAMPLE.com", "b@example.com"},
+				URISANs:        []string{"spiffe://example.com/a", "spiffe://example.com/b"},
+			},
+			expectSame: true,
+		},
+		{
+			name: "email address changed",
+			spec: v1alpha1.CertificateSpec{
+				CommonName:     "a.example.com",
+				DNSNames:       []string{"b.example.com", "c.example.com"},
+				IPAddresses:    []string{"10.0.0.1", "10.0.0.2"},
+				EmailAddresses: []string{"a@example.com", "c@example.com"},
+				URISANs:        []string{"spiffe://example.com/a", "spiffe://example.com/b"},
+			},
+		},
+		{
+			name: "uri changed",
+			spec: v1alpha1.CertificateSpec{
+				CommonName:     "a.example.com",
+				DNSNames:       []string{"b.example.com", "c.example.com"},
+				IPAddresses:    []string{"10.0.0.1", "10.0.0.2"},
+				EmailAddresses: []string{"a@example.com", "b@example.com"},
+				URISANs:        []string{"spiffe://example.com/a", "spiffe://example.com/c"},
+			},
+		},
+		{
+			name: "uri removed",
+			spec: v1alpha1.CertificateSpec{
+				CommonName:     "a.example.com",
+				DNSNames:       []string{"b.example.com", "c.example.com"},
+				IPAddresses:    []string{"10.0.0.1", "10.0.0.2"},
+				EmailAddresses: []string{"a@example.com", "b@example.com"},
+				URISANs:        []string{"spiffe://example.com/a"},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hash := SANSetHash(&v1alpha1.Certificate{Spec: test.spec})
+			if test.expectSame && hash != baseHash {
+				t.Errorf("expected hash %q but got %q", baseHash, hash)
+			}
+			if !test.expectSame && hash == baseHash {
+				t.Errorf("expected hash to differ from %q", baseHash)
+			}
+		})
+	}
+}
+
+func TestWithIPAddressSANEncoding(t *testing.T) {
+	type testT struct {
+		name     string
+		encoding IPAddressSANEncoding
+		expected string
+	}
+	tests := []testT{
+		{
+			name:     "native",
+			encoding: IPAddressSANEncodingNative,
+			expected: "0a000001",
+		},
+		{
+			name:     "ipv4-mapped ipv6",
+			encoding: IPAddressSANEncodingIPv4MappedIPv6,
+			expected: "00000000000000000000ffff0a000001",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			crt := &v1alpha1.Certificate{
+				Spec: v1alpha1.CertificateSpec{
+					IPAddresses: []string{"10.0.0.1"},
+				},
+			}
+			template, err := GenerateTemplate(nil, crt, WithIPAddressSANEncoding(test.encoding))
+			if err != nil {
+				t.Fatal(err)
+			}
+			ext, ok, err := subjectAltNameExtension(template, newTemplateOptions([]TemplateOption{WithIPAddressSANEncoding(test.encoding)}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !ok {
+				t.Fatalf("expected subject alternative name extension to be built")
+			}
+			var names []asn1.RawValue
+			if _, err := asn1.Unmarshal(ext.Value, &names); err != nil {
+				t.Fatalf("error decoding subject alternative name extension: %v", err)
+			}
+			if len(names) != 1 || names[0].Tag != nameTypeIP {
+				t.Fatalf("expected a single IP address SAN but got %v", names)
+			}
+			if actual := hex.EncodeToString(names[0].Bytes); actual != test.expected {
+				t.Errorf("expected IP address SAN bytes %s but got %s", test.expected, actual)
+			}
+
+			var manual *pkix.Extension
+			for i, e := range template.ExtraExtensions {
+				if e.Id.Equal(OIDExtensionSubjectAltName) {
+					manual = &template.ExtraExtensions[i]
+				}
+			}
+			if test.encoding == IPAddressSANEncodingNative {
+				if manual != nil {
+					t.Errorf("expected the SAN extension to be left to crypto/x509 by default")
+				}
+				return
+			}
+			if manual == nil {
+				t.Fatalf("expected the SAN extension to be added to the template")
+			}
+			if !bytes.Equal(manual.Value, ext.Value) {
+				t.Errorf("expected template SAN extension %x but got %x", ext.Value, manual.Value)
+			}
+		})
+	}
+}
+
+func TestSubjectAltNameExtensionMatchesNative(t *testing.T) {
+	cert := signTestTemplate(t, func(template *x509.Certificate) {
+		template.IPAddresses = []net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("::1")}
+	})
+	ext, ok, err := subjectAltNameExtension(cert, newTemplateOptions(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatalf("expected subject alternative name extension to be built")
+	}
+	native := findExtension(t, cert.Extensions, OIDExtensionSubjectAltName)
+	if native == nil {
+		t.Fatalf("expected subject alternative name extension to be present")
+	}
+	if !bytes.Equal(ext.Value, native.Value) || ext.Critical != native.Critical {
+		t.Errorf("expected SAN extension %x to match crypto/x509's %x", ext.Value, native.Value)
+	}
+}
+
+func TestWithDirectoryNameSANs(t *testing.T) {
+	dirName := pkix.Name{
+		Country:      []string{"GB"},
+		Organization: []string{"Partner Ltd"},
+		CommonName:   "device-1",
+	}
+	cert := signTestTemplate(t, nil, WithDirectoryNameSANs(dirName))
+
+	if len(cert.DNSNames) != 2 || cert.DNSNames[0] != "test" || cert.DNSNames[1] != "test.example.com" {
+		t.Errorf("expected DNS names to be preserved but got %q", cert.DNSNames)
+	}
+
+	ext := findExtension(t, cert.Extensions, OIDExtensionSubjectAltName)
+	if ext == nil {
+		t.Fatalf("expected subject alternative name extension to be present")
+	}
+	var names []asn1.RawValue
+	if _, err := asn1.Unmarshal(ext.Value, &names); err != nil {
+		t.Fatalf("error decoding subject alternative name extension: %v", err)
+	}
+	var dirNames []pkix.Name
+	for _, name := range names {
+		if name.Class != asn1.ClassContextSpecific || name.Tag != nameTypeDirName {
+			continue
+		}
+		var rdns pkix.RDNSequence
+		if _, err := asn1.Unmarshal(name.Bytes, &rdns); err != nil {
+			t.Fatalf("error decoding directory name: %v", err)
+		}
+		var decoded pkix.Name
+		decoded.FillFromRDNSequence(&rdns)
+		dirNames = append(dirNames, decoded)
+	}
+	if len(dirNames) != 1 {
+		t.Fatalf("expected 1 directory name SAN but got %d", len(dirNames))
+	}
+	if dirNames[0].String() != dirName.String() {
+		t.Errorf("expected directory name %q but got %q", dirName.String(), dirNames[0].String())
+	}
+}
+
+func TestDirectoryNameOnlySAN(t *testing.T) {
+	template, err := GenerateTemplate(nil, &v1alpha1.Certificate{}, WithDirectoryNameSANs(pkix.Name{CommonName: "partner"}))
+	if err != nil {
+		t.Fatalf("expected a directory name to be enough to identify the certificate, but got: %v", err)
+	}
+	pk, err := GenerateECPrivateKey(ECCurve256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, cert, err := SignCertificate(template, template, pk.Public(), pk)
+	if err != nil {
+		t.Fatalf("error signing certificate: %v", err)
+	}
+	if findExtension(t, cert.Extensions, OIDExtensionSubjectAltName) == nil {
+		t.Errorf("expected a subject alternative name extension holding the directory name")
+	}
+
+	if _, err := GenerateTemplate(nil, &v1alpha1.Certificate{}); err == nil {
+		t.Errorf("expected an error for a certificate with no identity")
+	}
+}
+
+func TestNoEmptySubjectAltNameExtension(t *testing.T) {
+	type testT struct {
+		name string
+		opts []TemplateOption
+	}
+	tests := []testT{
+		{
+			name: "default",
+		},
+		{
+			name: "manually built extension",
+			opts: []TemplateOption{WithIPAddressSANEncoding(IPAddressSANEncodingIPv4MappedIPv6)},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			opts := append([]TemplateOption{WithCommonNameSANPolicy(CommonNameSANPolicyOmit)}, test.opts...)
+			template, err := GenerateTemplate(nil, buildCertificate("test"), opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pk, err := GenerateECPrivateKey(ECCurve256)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, cert, err := SignCertificate(template, template, pk.Public(), pk)
+			if err != nil {
+				t.Fatalf("error signing certificate: %v", err)
+			}
+			if cert.Subject.CommonName != "test" {
+				t.Errorf("expected common name %q but got %q", "test", cert.Subject.CommonName)
+			}
+			if ext := findExtension(t, cert.Extensions, OIDExtensionSubjectAltName); ext != nil {
+				t.Errorf("expected no subject alternative name extension but got %x", ext.Value)
+			}
+		})
+	}
+}
+
+func TestMergeSANs(t *testing.T) {
+	crt := buildCertificate("example.com", "*.apps.example.com")
+	crt.Spec.IPAddresses = []string{"10.0.0.1"}
+
+	type testT struct {
+		name        string
+		csr         *x509.CertificateRequest
+		policy      MergePolicy
+		expected    SANSet
+		expectedErr bool
+	}
+	tests := []testT{
+		{
+			name: "spec only ignores the csr",
+			csr: &x509.CertificateRequest{
+				DNSNames:       []string{"evil.com"},
+				EmailAddresses: []string{"test@example.com"},
+			},
+			policy: MergePolicySpecOnly,
+			expected: SANSet{
+				DNSNames:    []string{"example.com", "*.apps.example.com"},
+				IPAddresses: []net.IP{net.ParseIP("10.0.0.1")},
+			},
+		},
+		{
+			name: "csr only ignores the spec",
+			csr: &x509.CertificateRequest{
+				DNSNames:       []string{"evil.com", "EVIL.com."},
+				EmailAddresses: []string{"test@example.com"},
+			},
+			policy: MergePolicyCSROnly,
+			expected: SANSet{
+				DNSNames:       []string{"evil.com"},
+				EmailAddresses: []string{"test@example.com"},
+			},
+		},
+		{
+			name: "merge allowlisted takes the union",
+			csr: &x509.CertificateRequest{
+				DNSNames:    []string{"web.apps.example.com", "Example.com"},
+				IPAddresses: []net.IP{net.ParseIP("10.0.0.1")},
+			},
+			policy: MergePolicyMergeAllowlisted,
+			expected: SANSet{
+				DNSNames:    []string{"example.com", "*.apps.example.com", "web.apps.example.com"},
+				IPAddresses: []net.IP{net.ParseIP("10.0.0.1")},
+			},
+		},
+		{
+			name: "merge allowlisted rejects a dns name outside the spec",
+			csr: &x509.CertificateRequest{
+				DNSNames: []string{"web.apps.example.com", "example.org"},
+			},
+			policy:      MergePolicyMergeAllowlisted,
+			expectedErr: true,
+		},
+		{
+			name: "merge allowlisted rejects an unlisted subdomain of a dns name",
+			csr: &x509.CertificateRequest{
+				DNSNames: []string{"evil.example.com"},
+			},
+			policy:      MergePolicyMergeAllowlisted,
+			expectedErr: true,
+		},
+		{
+			name: "merge allowlisted rejects a name more than one label below a wildcard",
+			csr: &x509.CertificateRequest{
+				DNSNames: []string{"a.web.apps.example.com"},
+			},
+			policy:      MergePolicyMergeAllowlisted,
+			expectedErr: true,
+		},
+		{
+			name: "merge allowlisted rejects an ip address outside the spec",
+			csr: &x509.CertificateRequest{
+				IPAddresses: []net.IP{net.ParseIP("10.0.0.2")},
+			},
+			policy:      MergePolicyMergeAllowlisted,
+			expectedErr: true,
+		},
+		{
+			name: "merge allowlisted rejects an email address outside the spec",
+			csr: &x509.CertificateRequest{
+				EmailAddresses: []string{"test@example.com"},
+			},
+			policy:      MergePolicyMergeAllowlisted,
+			expectedErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sans, err := MergeSANs(crt, test.csr, test.policy)
+			if test.expectedErr {
+				if err == nil {
+					t.Errorf("expected an error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error but got: %v", err)
+			}
+			if !reflect.DeepEqual(sans.DNSNames, test.expected.DNSNames) {
+				t.Errorf("expected dns names %q but got %q", test.expected.DNSNames, sans.DNSNames)
+			}
+			if !reflect.DeepEqual(IPAddressesToString(sans.IPAddresses), IPAddressesToString(test.expected.IPAddresses)) {
+				t.Errorf("expected ip addresses %v but got %v", test.expected.IPAddresses, sans.IPAddresses)
+			}
+			if !reflect.DeepEqual(sans.EmailAddresses, test.expected.EmailAddresses) {
+				t.Errorf("expected email addresses %q but got %q", test.expected.EmailAddresses, sans.EmailAddresses)
+			}
+			if !reflect.DeepEqual(sans.URIs, test.expected.URIs) {
+				t.Errorf("expected uris %q but got %q", test.expected.URIs, sans.URIs)
+			}
+		})
+	}
+}
+
+func TestValidateSANCharacters(t *testing.T) {
+	type testT struct {
+		name           string
+		cn             string
+		dnsNames       []string
+		expectedErr    bool
+		expectedOffset string
+	}
+	tests := []testT{
+		{
+			name:     "valid names",
+			cn:       "test",
+			dnsNames: []string{"example.com", "bücher.example.com"},
+		},
+		{
+			name:     "trailing newline is trimmed",
+			dnsNames: []string{"example.com\n"},
+		},
+		{
+			name:           "embedded null byte",
+			dnsNames:       []string{"example.com", "exa\x00mple.com"},
+			expectedErr:    true,
+			expectedOffset: "byte offset 3",
+		},
+		{
+			name:           "embedded newline after leading space",
+			dnsNames:       []string{" example.com\nevil.com"},
+			expectedErr:    true,
+			expectedOffset: "byte offset 12",
+		},
+		{
+			name:           "common name with a control character",
+			cn:             "te\x1bst",
+			expectedErr:    true,
+			expectedOffset: "byte offset 2",
+		},
+		{
+			name:           "invalid utf-8",
+			dnsNames:       []string{"ex\xffample.com"},
+			expectedErr:    true,
+			expectedOffset: "byte offset 2",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := GenerateTemplate(nil, buildCertificate(test.cn, test.dnsNames...))
+			if !test.expectedErr {
+				if err != nil {
+					t.Errorf("expected no error but got: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected an error but got none")
+			}
+			if !strings.Contains(err.Error(), test.expectedOffset) {
+				t.Errorf("expected error to contain %q but got: %v", test.expectedOffset, err)
+			}
+		})
+	}
+
+	csr := &x509.CertificateRequest{EmailAddresses: []string{"user@example.com\x00.evil.com"}}
+	if _, err := MergeSANs(buildCertificate("example.com"), csr, MergePolicyCSROnly); err == nil {
+		t.Errorf("expected an error merging a requested email address containing a null byte")
+	}
+}
+
+func TestGenerateEmptySubjectCriticalSAN(t *testing.T) {
+	crt := &v1alpha1.Certificate{
+		Spec: v1alpha1.CertificateSpec{
+			DNSNames:    []string{"example.com"},
+			IPAddresses: []string{"10.0.0.1"},
+		},
+	}
+	pk, err := GeneratePrivateKeyForCertificate(crt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		opts             []TemplateOption
+		expectedCritical bool
+	}{
+		"default subject": {expectedCritical: false},
+		"empty subject":   {opts: []TemplateOption{WithoutSubjectDefaults()}, expectedCritical: true},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			template, err := GenerateTemplate(nil, crt, test.opts...)
+			if err != nil {
+				t.Fatalf("error generating template: %v", err)
+			}
+			_, cert, err := SignCertificate(template, template, pk.Public(), pk)
+			if err != nil {
+				t.Fatalf("error signing certificate: %v", err)
+			}
+			if emptySubject := len(cert.Subject.Names) == 0; emptySubject != test.expectedCritical {
+				t.Errorf("expected subject to be empty: %t, but got %q", test.expectedCritical, cert.Subject)
+			}
+			certExt := findExtension(t, cert.Extensions, OIDExtensionSubjectAltName)
+			if certExt == nil {
+				t.Fatalf("expected a subject alternative name extension")
+			}
+			if certExt.Critical != test.expectedCritical {
+				t.Errorf("expected certificate SAN extension critical to be %t", test.expectedCritical)
+			}
+
+			csr, err := GenerateCSR(nil, crt, test.opts...)
+			if err != nil {
+				t.Fatalf("error generating csr: %v", err)
+			}
+			csrDER, err := EncodeCSR(csr, pk)
+			if err != nil {
+				t.Fatalf("error encoding csr: %v", err)
+			}
+			parsedCSR, err := x509.ParseCertificateRequest(csrDER)
+			if err != nil {
+				t.Fatalf("error parsing csr: %v", err)
+			}
+			csrExt := findExtension(t, parsedCSR.Extensions, OIDExtensionSubjectAltName)
+			if csrExt == nil {
+				t.Fatalf("expected a subject alternative name extension")
+			}
+			if csrExt.Critical != test.expectedCritical {
+				t.Errorf("expected csr SAN extension critical to be %t", test.expectedCritical)
+			}
+		})
+	}
+}
+
+func TestGenerateTemplateCanonicalSANs(t *testing.T) {
+	signedSANExtension := func(crt *v1alpha1.Certificate, opts ...TemplateOption) (*x509.Certificate, *pkix.Extension) {
+		template, err := GenerateTemplate(nil, crt, opts...)
+		if err != nil {
+			t.Fatalf("error generating template: %v", err)
+		}
+		pk, err := GeneratePrivateKeyForCertificate(crt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, cert, err := SignCertificate(template, template, pk.Public(), pk)
+		if err != nil {
+			t.Fatalf("error signing certificate: %v", err)
+		}
+		ext := findExtension(t, cert.Extensions, OIDExtensionSubjectAltName)
+		if ext == nil {
+			t.Fatalf("expected a subject alternative name extension")
+		}
+		return cert, ext
+	}
+
+	messy := buildCertificate("", "Example.COM", "example.com.", "www.example.com")
+	messy.Spec.IPAddresses = []string{"10.0.0.1", "::ffff:10.0.0.1", "2001:DB8::1", "2001:db8:0::1"}
+	messy.Spec.EmailAddresses = []string{"Admin@Example.COM", "Admin@example.com"}
+	canonical := buildCertificate("", "example.com", "www.example.com")
+	canonical.Spec.IPAddresses = []string{"10.0.0.1", "2001:db8::1"}
+	canonical.Spec.EmailAddresses = []string{"Admin@example.com"}
+
+	messyCert, messyExt := signedSANExtension(messy)
+	_, canonicalExt := signedSANExtension(canonical)
+	if !bytes.Equal(messyExt.Value, canonicalExt.Value) {
+		t.Errorf("expected SAN extension %x to be canonical %x", messyExt.Value, canonicalExt.Value)
+	}
+	if expected := []string{"example.com", "www.example.com"}; !reflect.DeepEqual(messyCert.DNSNames, expected) {
+		t.Errorf("expected DNS names %v but got %v", expected, messyCert.DNSNames)
+	}
+	if expected := []string{"Admin@example.com"}; !reflect.DeepEqual(messyCert.EmailAddresses, expected) {
+		t.Errorf("expected email addresses %v but got %v", expected, messyCert.EmailAddresses)
+	}
+	if len(messyCert.IPAddresses) != 2 {
+		t.Errorf("expected 2 IP addresses but got %v", messyCert.IPAddresses)
+	}
+
+	verbatimCert, _ := signedSANExtension(messy, WithVerbatimSANs())
+	if len(verbatimCert.IPAddresses) != 4 {
+		t.Errorf("expected IP addresses to be verbatim but got %v", verbatimCert.IPAddresses)
+	}
+	if expected := []string{"Admin@Example.COM", "Admin@example.com"}; !reflect.DeepEqual(verbatimCert.EmailAddresses, expected) {
+		t.Errorf("expected email addresses to be verbatim %v but got %v", expected, verbatimCert.EmailAddresses)
+	}
+}
+
+func TestMatchesServerName(t *testing.T) {
+	cert := &x509.Certificate{
+		DNSNames:    []string{"Example.com", "*.apps.example.com", "*.com"},
+		IPAddresses: []net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("2001:db8::1")},
+	}
+	cert.Subject.CommonName = "cn.example.com"
+
+	tests := map[string]bool{
+		"example.com":            true,
+		"EXAMPLE.com.":           true,
+		"www.apps.example.com":   true,
+		"WWW.Apps.Example.com":   true,
+		"apps.example.com":       false,
+		"a.www.apps.example.com": false,
+		".apps.example.com":      false,
+		"www.example.com":        false,
+		"example.com.evil.com":   false,
+		"cn.example.com":         false,
+		"foo.com":                false,
+		"10.0.0.1":               true,
+		"10.0.0.2":               false,
+		"2001:DB8::1":            true,
+		"[2001:db8::1]":          true,
+		"::1":                    false,
+		"":                       false,
+	}
+	for serverName, expected := range tests {
+		if actual := MatchesServerName(cert, serverName); actual != expected {
+			t.Errorf("expected MatchesServerName(%q) to be %t but got %t", serverName, expected, actual)
+		}
+	}
+}
+
+// parseOtherNames returns the values of the otherName subject alternative
+// names of the given type in the given SubjectAltName extension value.
+func parseOtherNames(t *testing.T, sanValue []byte, typeID asn1.ObjectIdentifier) []string {
+	var names []asn1.RawValue
+	if _, err := asn1.Unmarshal(sanValue, &names); err != nil {
+		t.Fatalf("error parsing subject alternative names: %v", err)
+	}
+	var values []string
+	for _, name := range names {
+		if name.Class != asn1.ClassContextSpecific || name.Tag != nameTypeOther {
+			continue
+		}
+		var oid asn1.ObjectIdentifier
+		rest, err := asn1.Unmarshal(name.Bytes, &oid)
+		if err != nil {
+			t.Fatalf("error parsing otherName type: %v", err)
+		}
+		var explicit asn1.RawValue
+		if _, err := asn1.Unmarshal(rest, &explicit); err != nil {
+			t.Fatalf("error parsing otherName value: %v", err)
+		}
+		if explicit.Class != asn1.ClassContextSpecific || explicit.Tag != 0 {
+			t.Fatalf("expected otherName value to be explicitly tagged [0] but got %+v", explicit)
+		}
+		var value string
+		if _, err := asn1.UnmarshalWithParams(explicit.Bytes, &value, "utf8"); err != nil {
+			t.Fatalf("error parsing otherName UTF8String: %v", err)
+		}
+		if oid.Equal(typeID) {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func TestOtherNameSANs(t *testing.T) {
+	const upn = "alice@corp.example.com"
+	crt := buildCertificate("alice.example.com", "alice.example.com")
+	crt.Spec.IPAddresses = []string{"10.0.0.1"}
+	crt.Spec.OtherNames = []v1alpha1.OtherName{{OID: "1.3.6.1.4.1.311.20.2.3", UTF8Value: upn}}
+	pk, err := GeneratePrivateKeyForCertificate(crt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template, err := GenerateTemplate(nil, crt)
+	if err != nil {
+		t.Fatalf("error generating template: %v", err)
+	}
+	_, cert, err := SignCertificate(template, template, pk.Public(), pk)
+	if err != nil {
+		t.Fatalf("error signing certificate: %v", err)
+	}
+	ext := findExtension(t, cert.Extensions, OIDExtensionSubjectAltName)
+	if ext == nil {
+		t.Fatalf("expected a subject alternative name extension")
+	}
+	if upns := parseOtherNames(t, ext.Value, OIDMicrosoftUPN); !reflect.DeepEqual(upns, []string{upn}) {
+		t.Errorf("expected certificate UPNs %v but got %v", []string{upn}, upns)
+	}
+	// the other subject alternative names are kept alongside the otherName
+	if !reflect.DeepEqual(cert.DNSNames, []string{"alice.example.com"}) || len(cert.IPAddresses) != 1 {
+		t.Errorf("expected DNS and IP SANs to be kept but got %v and %v", cert.DNSNames, cert.IPAddresses)
+	}
+
+	csrTemplate, err := GenerateCSR(nil, crt)
+	if err != nil {
+		t.Fatalf("error generating csr: %v", err)
+	}
+	csrDER, err := EncodeCSR(csrTemplate, pk)
+	if err != nil {
+		t.Fatalf("error encoding csr: %v", err)
+	}
+	csr, err := x509.ParseCertificateRequest(csrDER)
+	if err != nil {
+		t.Fatalf("error parsing csr: %v", err)
+	}
+	csrExt := findExtension(t, csr.Extensions, OIDExtensionSubjectAltName)
+	if csrExt == nil {
+		t.Fatalf("expected a subject alternative name extension")
+	}
+	if upns := parseOtherNames(t, csrExt.Value, OIDMicrosoftUPN); !reflect.DeepEqual(upns, []string{upn}) {
+		t.Errorf("expected csr UPNs %v but got %v", []string{upn}, upns)
+	}
+	if !reflect.DeepEqual(csr.DNSNames, []string{"alice.example.com"}) || len(csr.IPAddresses) != 1 {
+		t.Errorf("expected csr DNS and IP SANs to be kept but got %v and %v", csr.DNSNames, csr.IPAddresses)
+	}
+
+	// a UPN is enough of an identity without a common name
+	upnOnly := buildCertificate("")
+	upnOnly.Spec.OtherNames = crt.Spec.OtherNames
+	if _, err := GenerateTemplate(nil, upnOnly); err != nil {
+		t.Errorf("unexpected error generating template with only a UPN: %v", err)
+	}
+
+	crt.Spec.OtherNames = []v1alpha1.OtherName{{OID: "1.3.6.x", UTF8Value: upn}}
+	if _, err := GenerateTemplate(nil, crt); err == nil {
+		t.Errorf("expected an error for an invalid otherName oid")
+	}
+}
@@ -0,0 +1,135 @@
+/*
+Copyright 2019 The Jetstack cert-manager contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pki
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"sort"
+
+	"github.com/jetstack/cert-manager/pkg/apis/certmanager/v1alpha1"
+)
+
+// SpecFromCertificate builds a Certificate resource that would result in a
+// certificate equivalent to the given x509 certificate being issued.
+// This is intended for adopting existing certificates, so that their renewal
+// can be taken over by cert-manager. The returned Certificate does not have
+// a secret name or issuer reference set.
+// If the certificate's public key is not an RSA or ECDSA key, the key
+// algorithm and size are left unset.
+func SpecFromCertificate(cert *x509.Certificate) *v1alpha1.Certificate {
+	spec := v1alpha1.CertificateSpec{
+		CommonName:   cert.Subject.CommonName,
+		Organization: cert.Subject.Organization,
+		DNSNames:     cert.DNSNames,
+		IPAddresses:  IPAddressesToString(cert.IPAddresses),
+		IsCA:         cert.IsCA,
+	}
+
+	switch pub := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		spec.KeyAlgorithm = v1alpha1.RSAKeyAlgorithm
+		spec.KeySize = pub.N.BitLen()
+	case *ecdsa.PublicKey:
+		spec.KeyAlgorithm = v1alpha1.ECDSAKeyAlgorithm
+		spec.KeySize = pub.Curve.Params().BitSize
+	}
+
+	return &v1alpha1.Certificate{Spec: spec}
+}
+
+// ReissuanceImpact compares the identity that would be issued for the given
+// Certificate resource against an existing certificate, and reports whether
+// re-issuing would change the certificate's public-facing identity.
+// The common name, DNS names, IP addresses, organization, key usages,
+// extended key usages and CA status are compared, and the names of any that differ are returned in the
+// order listed. Validity dates, serial numbers and keys are not compared,
+// so a pure renewal does not change the identity.
+// DNS names, IP addresses and extended key usages are compared as sets,
+// ignoring case and order.
+func ReissuanceImpact(oldCert *x509.Certificate, crt *v1alpha1.Certificate) (identityChanged bool, changedFields []string) {
+	if CommonNameForCertificate(crt) != oldCert.Subject.CommonName {
+		changedFields = append(changedFields, "commonName")
+	}
+	if !equalNameSets(DNSNamesForCertificate(crt), oldCert.DNSNames, normaliseDNSName) {
+		changedFields = append(changedFields, "dnsNames")
+	}
+	if !equalNameSets(IPAddressesToString(IPAddressesForCertificate(crt)), IPAddressesToString(oldCert.IPAddresses), nil) {
+		changedFields = append(changedFields, "ipAddresses")
+	}
+	if !equalNameSets(OrganizationForCertificate(crt), oldCert.Subject.Organization, nil) {
+		changedFields = append(changedFields, "organization")
+	}
+	keyUsages, extKeyUsages, err := KeyUsagesForCertificate(crt)
+	if err != nil || keyUsages != oldCert.KeyUsage {
+		changedFields = append(changedFields, "keyUsages")
+	}
+	if err != nil || !equalExtKeyUsageSets(extKeyUsages, oldCert.ExtKeyUsage) {
+		changedFields = append(changedFields, "extKeyUsages")
+	}
+	if crt.Spec.IsCA != oldCert.IsCA {
+		changedFields = append(changedFields, "isCA")
+	}
+	return len(changedFields) > 0, changedFields
+}
+
+// equalNameSets returns true if a and b contain the same set of names, after
+// applying normalise to each name if it is not nil.
+func equalNameSets(a, b []string, normalise func(string) string) bool {
+	set := func(names []string) []string {
+		seen := make(map[string]bool, len(names))
+		var out []string
+		for _, name := range names {
+			if normalise != nil {
+				name = normalise(name)
+			}
+			if !seen[name] {
+				seen[name] = true
+				out = append(out, name)
+			}
+		}
+		sort.Strings(out)
+		return out
+	}
+	sa, sb := set(a), set(b)
+	if len(sa) != len(sb) {
+		return false
+	}
+	for i := range sa {
+		if sa[i] != sb[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// equalExtKeyUsageSets returns true if a and b contain the same set of
+// extended key usages.
+func equalExtKeyUsageSets(a, b []x509.ExtKeyUsage) bool {
+	for _, u := range a {
+		if !containsExtKeyUsage(b, u) {
+			return false
+		}
+	}
+	for _, u := range b {
+		if !containsExtKeyUsage(a, u) {
+			return false
+		}
+	}
+	return true
+}
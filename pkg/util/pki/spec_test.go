@@ -0,0 +1,150 @@
+/*
+Copyright 2019 The Jetstack cert-manager contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pki
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jetstack/cert-manager/pkg/apis/certmanager/v1alpha1"
+)
+
+func TestSpecFromCertificate(t *testing.T) {
+	type testT struct {
+		name string
+		spec v1alpha1.CertificateSpec
+	}
+	tests := []testT{
+		{
+			name: "rsa certificate",
+			spec: v1alpha1.CertificateSpec{
+				CommonName:   "test.example.com",
+				Organization: []string{"test-org"},
+				DNSNames:     []string{"test.example.com", "alt.example.com"},
+				KeyAlgorithm: v1alpha1.RSAKeyAlgorithm,
+				KeySize:      2048,
+			},
+		},
+		{
+			name: "ecdsa ca certificate",
+			spec: v1alpha1.CertificateSpec{
+				CommonName:   "ca",
+				Organization: []string{"test-org"},
+				DNSNames:     []string{"ca"},
+				IPAddresses:  []string{"10.0.0.1"},
+				IsCA:         true,
+				KeyAlgorithm: v1alpha1.ECDSAKeyAlgorithm,
+				KeySize:      384,
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			crt := &v1alpha1.Certificate{Spec: test.spec}
+			pk, err := GeneratePrivateKeyForCertificate(crt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			template, err := GenerateTemplate(nil, crt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, cert, err := SignCertificate(template, template, pk.Public(), pk)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			adopted := SpecFromCertificate(cert)
+			if !reflect.DeepEqual(adopted.Spec, test.spec) {
+				t.Errorf("expected spec %+v but got %+v", test.spec, adopted.Spec)
+			}
+
+			// generating a template from the adopted spec should produce
+			// an equivalent certificate
+			regenerated, err := GenerateTemplate(nil, adopted)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if regenerated.Subject.CommonName != cert.Subject.CommonName ||
+				!reflect.DeepEqual(regenerated.Subject.Organization, cert.Subject.Organization) ||
+				!reflect.DeepEqual(regenerated.DNSNames, cert.DNSNames) ||
+				!reflect.DeepEqual(IPAddressesToString(regenerated.IPAddresses), IPAddressesToString(cert.IPAddresses)) ||
+				regenerated.IsCA != cert.IsCA ||
+				regenerated.PublicKeyAlgorithm != cert.PublicKeyAlgorithm {
+				t.Errorf("expected regenerated template to match the original certificate")
+			}
+		})
+	}
+}
+
+func TestReissuanceImpact(t *testing.T) {
+	crt := buildCertificate("test.example.com", "www.example.com")
+	oldCert, _ := signTestCertificate(t, crt, nil, nil)
+
+	type testT struct {
+		name           string
+		mutate         func(*v1alpha1.Certificate)
+		expectedFields []string
+	}
+	tests := []testT{
+		{
+			name:   "pure renewal",
+			mutate: func(*v1alpha1.Certificate) {},
+		},
+		{
+			name: "reordered and differently cased dns names",
+			mutate: func(crt *v1alpha1.Certificate) {
+				crt.Spec.DNSNames = []string{"WWW.example.com", "test.example.com"}
+			},
+		},
+		{
+			name: "san addition",
+			mutate: func(crt *v1alpha1.Certificate) {
+				crt.Spec.DNSNames = append(crt.Spec.DNSNames, "api.example.com")
+			},
+			expectedFields: []string{"dnsNames"},
+		},
+		{
+			name: "extended key usage change",
+			mutate: func(crt *v1alpha1.Certificate) {
+				crt.Spec.Usages = []v1alpha1.KeyUsage{v1alpha1.UsageDigitalSignature, v1alpha1.UsageKeyEncipherment, v1alpha1.UsageClientAuth}
+			},
+			expectedFields: []string{"extKeyUsages"},
+		},
+		{
+			name: "common name change and ca",
+			mutate: func(crt *v1alpha1.Certificate) {
+				crt.Spec.CommonName = "other.example.com"
+				crt.Spec.IsCA = true
+			},
+			expectedFields: []string{"commonName", "dnsNames", "keyUsages", "extKeyUsages", "isCA"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			updated := crt.DeepCopy()
+			test.mutate(updated)
+			changed, fields := ReissuanceImpact(oldCert, updated)
+			if changed != (len(test.expectedFields) > 0) {
+				t.Errorf("expected identity changed to be %v but got %v", len(test.expectedFields) > 0, changed)
+			}
+			if !reflect.DeepEqual(fields, test.expectedFields) {
+				t.Errorf("expected changed fields %v but got %v", test.expectedFields, fields)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+/*
+Copyright 2019 The Jetstack cert-manager contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pki
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+)
+
+// SubjectEncoding selects the ASN.1 string type used when encoding the
+// attribute values of a subject distinguished name.
+type SubjectEncoding int
+
+const (
+	// SubjectEncodingDefault leaves the encoding to crypto/x509, which uses
+	// PrintableString where the value allows it and UTF8String otherwise.
+	SubjectEncodingDefault SubjectEncoding = iota
+
+	// SubjectEncodingUTF8String encodes all DirectoryString attributes as
+	// UTF8String, which is required to byte-match the DN of an issuer that
+	// uses UTF8String.
+	SubjectEncodingUTF8String
+)
+
+// Object identifiers of the subject attributes set by GenerateTemplate and
+// GenerateCSR, for use with WithSubjectRDNOrder.
+var (
+	OIDAttributeCommonName         = asn1.ObjectIdentifier{2, 5, 4, 3}
+	OIDAttributeSerialNumber       = asn1.ObjectIdentifier{2, 5, 4, 5}
+	OIDAttributeCountry            = asn1.ObjectIdentifier{2, 5, 4, 6}
+	OIDAttributeLocality           = asn1.ObjectIdentifier{2, 5, 4, 7}
+	OIDAttributeProvince           = asn1.ObjectIdentifier{2, 5, 4, 8}
+	OIDAttributeStreetAddress      = asn1.ObjectIdentifier{2, 5, 4, 9}
+	OIDAttributeOrganization       = asn1.ObjectIdentifier{2, 5, 4, 10}
+	OIDAttributeOrganizationalUnit = asn1.ObjectIdentifier{2, 5, 4, 11}
+	OIDAttributePostalCode         = asn1.ObjectIdentifier{2, 5, 4, 17}
+)
+
+// directoryStringAttributes are the subject attributes defined as a
+// DirectoryString in RFC 5280, and so may be encoded as a UTF8String.
+// Attributes such as countryName and serialNumber must always be encoded as
+// PrintableString and are deliberately not included.
+var directoryStringAttributes = []asn1.ObjectIdentifier{
+	{2, 5, 4, 3},  // commonName
+	{2, 5, 4, 7},  // localityName
+	{2, 5, 4, 8},  // stateOrProvinceName
+	{2, 5, 4, 9},  // streetAddress
+	{2, 5, 4, 10}, // organizationName
+	{2, 5, 4, 11}, // organizationalUnitName
+	{2, 5, 4, 17}, // postalCode
+}
+
+func isDirectoryStringAttribute(oid asn1.ObjectIdentifier) bool {
+	for _, o := range directoryStringAttributes {
+		if o.Equal(oid) {
+			return true
+		}
+	}
+	return false
+}
+
+// marshalSubject will DER encode the given name using the given encoding,
+// with its relative distinguished names in the given order.
+// If the default encoding and order are requested, nil is returned so that
+// the caller can leave encoding of the subject to crypto/x509.
+func marshalSubject(name pkix.Name, enc SubjectEncoding, order []asn1.ObjectIdentifier) ([]byte, error) {
+	if enc == SubjectEncodingDefault && len(order) == 0 {
+		return nil, nil
+	}
+	rdns := name.ToRDNSequence()
+	if len(order) > 0 {
+		var err error
+		if rdns, err = orderRDNs(rdns, order); err != nil {
+			return nil, err
+		}
+	}
+	switch enc {
+	case SubjectEncodingDefault:
+	case SubjectEncodingUTF8String:
+		for _, rdn := range rdns {
+			for i, atv := range rdn {
+				s, ok := atv.Value.(string)
+				if !ok || !isDirectoryStringAttribute(atv.Type) {
+					continue
+				}
+				rdn[i].Value = asn1.RawValue{
+					Class: asn1.ClassUniversal,
+					Tag:   asn1.TagUTF8String,
+					Bytes: []byte(s),
+				}
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported subject encoding: %d", enc)
+	}
+	return asn1.Marshal(rdns)
+}
+
+// orderRDNs returns the given relative distinguished names reordered so that
+// their attribute types appear in the given order. Multiple values of the same
+// attribute type, such as two organizational units, keep their relative order
+// within a single multi-valued RDN, as crypto/x509 encodes them.
+// An error is returned if an attribute type is not included in order.
+func orderRDNs(rdns pkix.RDNSequence, order []asn1.ObjectIdentifier) (pkix.RDNSequence, error) {
+	ordered := make(pkix.RDNSequence, 0, len(rdns))
+	for _, oid := range order {
+		for _, rdn := range rdns {
+			if rdn[0].Type.Equal(oid) {
+				ordered = append(ordered, rdn)
+			}
+		}
+	}
+	if len(ordered) != len(rdns) {
+		for _, rdn := range rdns {
+			if !containsOID(order, rdn[0].Type) {
+				return nil, fmt.Errorf("subject attribute %s is not included in the RDN order", rdn[0].Type)
+			}
+		}
+		return nil, fmt.Errorf("subject RDN order must not list an attribute more than once")
+	}
+	return ordered, nil
+}
+
+func containsOID(oids []asn1.ObjectIdentifier, oid asn1.ObjectIdentifier) bool {
+	for _, o := range oids {
+		if o.Equal(oid) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,175 @@
+/*
+Copyright 2019 The Jetstack cert-manager contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pki
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"testing"
+)
+
+type testAttributeTypeAndRawValue struct {
+	Type  asn1.ObjectIdentifier
+	Value asn1.RawValue
+}
+
+// the "SET" suffix instructs encoding/asn1 to treat this as a SET OF
+type testRelativeDistinguishedNameSET []testAttributeTypeAndRawValue
+
+// subjectValueTags returns the ASN.1 string tag used for each attribute in
+// the given DER encoded distinguished name, keyed by the attribute's OID.
+func subjectValueTags(t *testing.T, der []byte) map[string]int {
+	var rdns []testRelativeDistinguishedNameSET
+	if _, err := asn1.Unmarshal(der, &rdns); err != nil {
+		t.Fatalf("error decoding subject: %v", err)
+	}
+	tags := make(map[string]int)
+	for _, rdn := range rdns {
+		for _, atv := range rdn {
+			tags[atv.Type.String()] = atv.Value.Tag
+		}
+	}
+	return tags
+}
+
+func TestGenerateTemplateSubjectEncoding(t *testing.T) {
+	const (
+		oidCommonName   = "2.5.4.3"
+		oidOrganization = "2.5.4.10"
+	)
+	type testT struct {
+		name       string
+		encoding   SubjectEncoding
+		expectTags map[string]int
+	}
+	tests := []testT{
+		{
+			name:     "default encoding uses PrintableString",
+			encoding: SubjectEncodingDefault,
+			expectTags: map[string]int{
+				oidCommonName:   asn1.TagPrintableString,
+				oidOrganization: asn1.TagPrintableString,
+			},
+		},
+		{
+			name:     "utf8 encoding uses UTF8String",
+			encoding: SubjectEncodingUTF8String,
+			expectTags: map[string]int{
+				oidCommonName:   asn1.TagUTF8String,
+				oidOrganization: asn1.TagUTF8String,
+			},
+		},
+	}
+
+	pk, err := GenerateECPrivateKey(ECCurve256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rawSubjects := make(map[SubjectEncoding][]byte)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			template, err := GenerateTemplate(nil, buildCertificate("test", "test.example.com"), WithSubjectEncoding(test.encoding))
+			if err != nil {
+				t.Fatalf("error generating template: %v", err)
+			}
+			_, cert, err := SignCertificate(template, template, pk.Public(), pk)
+			if err != nil {
+				t.Fatalf("error signing certificate: %v", err)
+			}
+			if !bytes.Equal(cert.RawSubject, cert.RawIssuer) {
+				t.Errorf("expected self-signed issuer DN to byte-match the subject DN")
+			}
+			tags := subjectValueTags(t, cert.RawSubject)
+			for oid, expected := range test.expectTags {
+				if tags[oid] != expected {
+					t.Errorf("expected attribute %s to have tag %d but got %d", oid, expected, tags[oid])
+				}
+			}
+			if cert.Subject.CommonName != "test" {
+				t.Errorf("expected common name %q but got %q", "test", cert.Subject.CommonName)
+			}
+			rawSubjects[test.encoding] = cert.RawSubject
+		})
+	}
+
+	if bytes.Equal(rawSubjects[SubjectEncodingDefault], rawSubjects[SubjectEncodingUTF8String]) {
+		t.Errorf("expected subject DN bytes to differ between encodings")
+	}
+}
+
+func TestGenerateCSRSubjectEncoding(t *testing.T) {
+	pk, err := GenerateRSAPrivateKey(MinRSAKeySize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, err := GenerateCSR(nil, buildCertificate("test"), WithSubjectEncoding(SubjectEncodingUTF8String))
+	if err != nil {
+		t.Fatalf("error generating csr: %v", err)
+	}
+	der, err := EncodeCSR(csr, pk)
+	if err != nil {
+		t.Fatalf("error encoding csr: %v", err)
+	}
+	decoded, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		t.Fatalf("error decoding csr: %v", err)
+	}
+	tags := subjectValueTags(t, decoded.RawSubject)
+	if tags["2.5.4.3"] != asn1.TagUTF8String {
+		t.Errorf("expected common name to be encoded as UTF8String but got tag %d", tags["2.5.4.3"])
+	}
+}
+
+func TestGenerateTemplateSubjectRDNOrder(t *testing.T) {
+	pk, err := GenerateECPrivateKey(ECCurve256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	crt := buildCertificate("test", "test.example.com")
+	crt.Spec.Organization = []string{"org-a", "org-b"}
+	template, err := GenerateTemplate(nil, crt, WithSubjectRDNOrder(OIDAttributeCommonName, OIDAttributeOrganization))
+	if err != nil {
+		t.Fatalf("error generating template: %v", err)
+	}
+	_, cert, err := SignCertificate(template, template, pk.Public(), pk)
+	if err != nil {
+		t.Fatalf("error signing certificate: %v", err)
+	}
+
+	expected, err := asn1.Marshal(pkix.RDNSequence{
+		{{Type: OIDAttributeCommonName, Value: "test"}},
+		// crypto/x509 encodes multiple values as a single multi-valued RDN
+		{{Type: OIDAttributeOrganization, Value: "org-a"}, {Type: OIDAttributeOrganization, Value: "org-b"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(cert.RawSubject, expected) {
+		t.Errorf("expected subject DN %x but got %x", expected, cert.RawSubject)
+	}
+	if !bytes.Equal(cert.RawSubject, cert.RawIssuer) {
+		t.Errorf("expected self-signed issuer DN to byte-match the subject DN")
+	}
+
+	if _, err := GenerateTemplate(nil, crt, WithSubjectRDNOrder(OIDAttributeCommonName)); err == nil {
+		t.Errorf("expected an error when the organization is not included in the RDN order")
+	}
+}
@@ -0,0 +1,193 @@
+/*
+Copyright 2019 The Jetstack cert-manager contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pki
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Summary is a compact description of an x509 certificate, suitable for
+// serialising to JSON for display in API status fields.
+type Summary struct {
+	SerialNumber       string    `json:"serialNumber"`
+	Subject            string    `json:"subject"`
+	Issuer             string    `json:"issuer"`
+	NotBefore          time.Time `json:"notBefore"`
+	NotAfter           time.Time `json:"notAfter"`
+	DNSNames           []string  `json:"dnsNames,omitempty"`
+	IPAddresses        []string  `json:"ipAddresses,omitempty"`
+	EmailAddresses     []string  `json:"emailAddresses,omitempty"`
+	URIs               []string  `json:"uris,omitempty"`
+	KeyAlgorithm       string    `json:"keyAlgorithm"`
+	KeySize            int       `json:"keySize,omitempty"`
+	SignatureAlgorithm string    `json:"signatureAlgorithm"`
+	SHA1Fingerprint    string    `json:"sha1Fingerprint"`
+	SHA256Fingerprint  string    `json:"sha256Fingerprint"`
+}
+
+// CertificateSummary returns a Summary of the given certificate.
+// The serial number and fingerprints are lower case hex encoded.
+func CertificateSummary(cert *x509.Certificate) Summary {
+	sha1Sum := sha1.Sum(cert.Raw)
+	sha256Sum := sha256.Sum256(cert.Raw)
+
+	s := Summary{
+		SerialNumber:       hex.EncodeToString(cert.SerialNumber.Bytes()),
+		Subject:            cert.Subject.String(),
+		Issuer:             cert.Issuer.String(),
+		NotBefore:          cert.NotBefore,
+		NotAfter:           cert.NotAfter,
+		DNSNames:           cert.DNSNames,
+		IPAddresses:        IPAddressesToString(cert.IPAddresses),
+		EmailAddresses:     cert.EmailAddresses,
+		KeyAlgorithm:       cert.PublicKeyAlgorithm.String(),
+		SignatureAlgorithm: cert.SignatureAlgorithm.String(),
+		SHA1Fingerprint:    hex.EncodeToString(sha1Sum[:]),
+		SHA256Fingerprint:  hex.EncodeToString(sha256Sum[:]),
+	}
+	for _, uri := range cert.URIs {
+		s.URIs = append(s.URIs, uri.String())
+	}
+
+	switch pub := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		s.KeySize = pub.N.BitLen()
+	case *ecdsa.PublicKey:
+		s.KeySize = pub.Curve.Params().BitSize
+	case ed25519.PublicKey:
+		s.KeySize = 256
+	}
+
+	return s
+}
+
+// SerialNumberString returns the serial number of the given certificate as
+// colon separated, lower case hex octets, as printed by openssl, e.g.
+// "0a:1b:2c". This form can be parsed by ParseSerialNumber.
+func SerialNumberString(cert *x509.Certificate) string {
+	b := cert.SerialNumber.Bytes()
+	if len(b) == 0 {
+		b = []byte{0}
+	}
+	octets := make([]string, len(b))
+	for i, octet := range b {
+		octets[i] = hex.EncodeToString([]byte{octet})
+	}
+	return strings.Join(octets, ":")
+}
+
+// CanonicalCertKey returns a stable key identifying the logical content of
+// the given certificate: its subject, subject alternative names, key usages,
+// extended key usages, CA status, validity period, serial number and public
+// key.
+// Differences in encoding that do not change this content, such as the
+// string types of the subject or the order of subject alternative names, do
+// not change the key, so that it can be used to detect meaningful changes to
+// a stored certificate. The signature is not included.
+func CanonicalCertKey(cert *x509.Certificate) string {
+	var extKeyUsages []string
+	for _, u := range cert.ExtKeyUsage {
+		extKeyUsages = append(extKeyUsages, extKeyUsageName(u))
+	}
+	for _, oid := range cert.UnknownExtKeyUsage {
+		extKeyUsages = append(extKeyUsages, oid.String())
+	}
+	var uris []string
+	for _, uri := range cert.URIs {
+		uris = append(uris, uri.String())
+	}
+	publicKey, err := x509.MarshalPKIXPublicKey(cert.PublicKey)
+	if err != nil {
+		// fall back to the encoding of the public key in the certificate
+		publicKey = cert.RawSubjectPublicKeyInfo
+	}
+	publicKeySum := sha256.Sum256(publicKey)
+
+	fields := []string{
+		"subject=" + cert.Subject.String(),
+		"dnsNames=" + sortedJoin(cert.DNSNames, strings.ToLower),
+		"ipAddresses=" + sortedJoin(IPAddressesToString(cert.IPAddresses), nil),
+		"emailAddresses=" + sortedJoin(cert.EmailAddresses, nil),
+		"uris=" + sortedJoin(uris, nil),
+		fmt.Sprintf("keyUsage=%d", cert.KeyUsage),
+		"extKeyUsages=" + sortedJoin(extKeyUsages, nil),
+		fmt.Sprintf("isCA=%t", cert.IsCA),
+		"notBefore=" + cert.NotBefore.UTC().Format(time.RFC3339),
+		"notAfter=" + cert.NotAfter.UTC().Format(time.RFC3339),
+		"serialNumber=" + hex.EncodeToString(cert.SerialNumber.Bytes()),
+		"publicKey=" + hex.EncodeToString(publicKeySum[:]),
+	}
+	sum := sha256.Sum256([]byte(strings.Join(fields, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// sortedJoin returns the given values, after applying normalise to each if it
+// is not nil, sorted and joined with commas.
+func sortedJoin(values []string, normalise func(string) string) string {
+	sorted := make([]string, len(values))
+	for i, v := range values {
+		if normalise != nil {
+			v = normalise(v)
+		}
+		sorted[i] = v
+	}
+	sort.Strings(sorted)
+	return strings.Join(sorted, ",")
+}
+
+// Fingerprint returns the SHA-256 fingerprint of the given certificate, as
+// lower case hex encoded bytes separated by colons. It is computed over the
+// Raw DER encoding of the certificate, and so matches the output of
+// `openssl x509 -fingerprint -sha256` other than in case.
+func Fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return formatFingerprint(sum[:])
+}
+
+// FingerprintSHA1 returns the SHA-1 fingerprint of the given certificate in
+// the same format as Fingerprint, for use with legacy tooling.
+func FingerprintSHA1(cert *x509.Certificate) string {
+	sum := sha1.Sum(cert.Raw)
+	return formatFingerprint(sum[:])
+}
+
+// CSRFingerprint returns the SHA-256 hash of the given DER encoded
+// certificate signing request, as lower case hex. As it is computed over the
+// exact bytes of the request, it can be used as a cache key to recognise a
+// request that has already been processed.
+func CSRFingerprint(csrDER []byte) string {
+	sum := sha256.Sum256(csrDER)
+	return hex.EncodeToString(sum[:])
+}
+
+func formatFingerprint(sum []byte) string {
+	parts := make([]string, len(sum))
+	for i, b := range sum {
+		parts[i] = hex.EncodeToString([]byte{b})
+	}
+	return strings.Join(parts, ":")
+}
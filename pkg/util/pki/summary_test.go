@@ -0,0 +1,211 @@
+/*
+Copyright 2019 The Jetstack cert-manager contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pki
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"net"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCertificateSummary(t *testing.T) {
+	notBefore := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+	cert := signTestTemplate(t, func(template *x509.Certificate) {
+		template.SerialNumber = big.NewInt(0x0102abcd)
+		template.NotBefore = notBefore
+		template.NotAfter = notBefore.Add(24 * time.Hour)
+		template.IPAddresses = []net.IP{net.ParseIP("10.0.0.1")}
+		template.EmailAddresses = []string{"admin@example.com"}
+		template.URIs = []*url.URL{{Scheme: "spiffe", Host: "example.com", Path: "/workload"}}
+	})
+
+	summary := CertificateSummary(cert)
+	sha1Sum := sha1.Sum(cert.Raw)
+	sha256Sum := sha256.Sum256(cert.Raw)
+	expected := Summary{
+		SerialNumber:       "0102abcd",
+		Subject:            "CN=test,O=cert-manager",
+		Issuer:             "CN=test,O=cert-manager",
+		NotBefore:          notBefore,
+		NotAfter:           notBefore.Add(24 * time.Hour),
+		DNSNames:           []string{"test", "test.example.com"},
+		IPAddresses:        []string{"10.0.0.1"},
+		EmailAddresses:     []string{"admin@example.com"},
+		URIs:               []string{"spiffe://example.com/workload"},
+		KeyAlgorithm:       "ECDSA",
+		KeySize:            256,
+		SignatureAlgorithm: "ECDSA-SHA256",
+		SHA1Fingerprint:    hex.EncodeToString(sha1Sum[:]),
+		SHA256Fingerprint:  hex.EncodeToString(sha256Sum[:]),
+	}
+	if !reflect.DeepEqual(summary, expected) {
+		t.Errorf("expected summary %+v but got %+v", expected, summary)
+	}
+
+	b, err := json.Marshal(summary)
+	if err != nil {
+		t.Fatalf("error marshalling summary: %v", err)
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(b, &fields); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"serialNumber", "subject", "issuer", "notBefore", "notAfter", "dnsNames", "ipAddresses", "emailAddresses", "uris", "keyAlgorithm", "keySize", "signatureAlgorithm", "sha1Fingerprint", "sha256Fingerprint"} {
+		if _, ok := fields[key]; !ok {
+			t.Errorf("expected JSON summary to contain %q", key)
+		}
+	}
+	if fields["notAfter"] != "2019-01-02T00:00:00Z" {
+		t.Errorf("expected notAfter to be encoded as RFC 3339 but got %v", fields["notAfter"])
+	}
+}
+
+func TestCanonicalCertKey(t *testing.T) {
+	pk, err := GenerateECPrivateKey(ECCurve256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign := func(template *x509.Certificate) *x509.Certificate {
+		_, cert, err := SignCertificate(template, template, pk.Public(), pk)
+		if err != nil {
+			t.Fatalf("error signing certificate: %v", err)
+		}
+		return cert
+	}
+	template, err := GenerateTemplate(nil, buildCertificate("test", "test.example.com", "www.example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := sign(template)
+
+	// re-encode the same certificate with a UTF8String subject and the dns
+	// names in a different order
+	reencoded := *template
+	reencoded.RawSubject, err = marshalSubject(template.Subject, SubjectEncodingUTF8String, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reencoded.DNSNames = []string{"www.example.com", "TEST.example.com", "test"}
+	reencodedCert := sign(&reencoded)
+	if bytes.Equal(cert.Raw, reencodedCert.Raw) {
+		t.Fatalf("expected the re-encoded certificate to differ")
+	}
+	if CanonicalCertKey(cert) != CanonicalCertKey(reencodedCert) {
+		t.Errorf("expected re-encoding to not change the canonical key")
+	}
+
+	changed := *template
+	changed.DNSNames = append(changed.DNSNames, "api.example.com")
+	if CanonicalCertKey(cert) == CanonicalCertKey(sign(&changed)) {
+		t.Errorf("expected an added dns name to change the canonical key")
+	}
+	changed = *template
+	changed.NotAfter = changed.NotAfter.Add(time.Hour)
+	if CanonicalCertKey(cert) == CanonicalCertKey(sign(&changed)) {
+		t.Errorf("expected a changed validity period to change the canonical key")
+	}
+}
+
+// fingerprintTestCert is a self signed certificate whose fingerprints were
+// computed with `openssl x509 -noout -fingerprint`.
+const fingerprintTestCert = `-----BEGIN CERTIFICATE-----
+MIIBmTCCAT+gAwIBAgIUK68zbFJT/fO2h6bIN7fB0prLUWUwCgYIKoZIzj0EAwIw
+IjEgMB4GA1UEAwwXZmluZ2VycHJpbnQuZXhhbXBsZS5jb20wHhcNMjYxMDE2MTUz
+MTMxWhcNMzYxMDEzMTUzMTMxWjAiMSAwHgYDVQQDDBdmaW5nZXJwcmludC5leGFt
+cGxlLmNvbTBZMBMGByqGSM49AgEGCCqGSM49AwEHA0IABDsPO/3yZdfHWeTqwTtz
+JQmbXO1p81mSgdD9hoklPO212uBYWk5eKpfsIwnE2xosYidSvXgLT5gFLBB9hUcb
+1cujUzBRMB0GA1UdDgQWBBS/owkOLH/0fHjeAdHzx//5JgpNCzAfBgNVHSMEGDAW
+gBS/owkOLH/0fHjeAdHzx//5JgpNCzAPBgNVHRMBAf8EBTADAQH/MAoGCCqGSM49
+BAMCA0gAMEUCIQDMRpq9SEq39Ktel0cad5hIhU41j5U/CyoG00XiZ5RWGQIgEmI6
+J7nbCZhbtjwPASgWNI3JcZpLclIkTcnsXPOvjPE=
+-----END CERTIFICATE-----
+`
+
+func TestFingerprint(t *testing.T) {
+	cert, err := DecodeX509CertificateBytes([]byte(fingerprintTestCert))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "ef:41:bf:61:e9:02:c3:fe:70:8e:4e:82:3a:82:52:4e:64:66:28:38:e4:60:7c:ac:dd:f4:12:98:99:02:af:81"
+	if actual := Fingerprint(cert); actual != expected {
+		t.Errorf("expected sha256 fingerprint %s but got %s", expected, actual)
+	}
+	expected = "6d:61:f9:85:2b:82:03:c8:16:47:c6:0b:0f:72:94:72:e0:f7:6e:fc"
+	if actual := FingerprintSHA1(cert); actual != expected {
+		t.Errorf("expected sha1 fingerprint %s but got %s", expected, actual)
+	}
+}
+
+func TestCSRFingerprint(t *testing.T) {
+	crt := buildCertificate("example.com")
+	pk, err := GeneratePrivateKeyForCertificate(crt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, err := GenerateCSR(nil, crt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := EncodeCSR(csr, pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fingerprint := CSRFingerprint(der)
+	if len(fingerprint) != 64 {
+		t.Errorf("expected a 64 character hex fingerprint but got %q", fingerprint)
+	}
+	if actual := CSRFingerprint(append([]byte(nil), der...)); actual != fingerprint {
+		t.Errorf("expected identical csrs to have the same fingerprint, but got %s and %s", fingerprint, actual)
+	}
+
+	changed := append([]byte(nil), der...)
+	changed[len(changed)-1] ^= 0x01
+	if actual := CSRFingerprint(changed); actual == fingerprint {
+		t.Errorf("expected a one byte change to alter the fingerprint %s", fingerprint)
+	}
+}
+
+func TestSerialNumberString(t *testing.T) {
+	tests := map[string]*big.Int{
+		"00":          big.NewInt(0),
+		"01":          big.NewInt(1),
+		"0a:1b:2c":    big.NewInt(0x0a1b2c),
+		"01:00:00:00": big.NewInt(0x01000000),
+	}
+	for expected, serial := range tests {
+		cert := &x509.Certificate{SerialNumber: serial}
+		if actual := SerialNumberString(cert); actual != expected {
+			t.Errorf("expected serial number %s to be %q but got %q", serial, expected, actual)
+		}
+		if serial.Sign() == 0 {
+			continue
+		}
+		if parsed, err := ParseSerialNumber(SerialNumberString(cert)); err != nil || parsed.Cmp(serial) != 0 {
+			t.Errorf("expected %q to parse back to %s but got %v, %v", expected, serial, parsed, err)
+		}
+	}
+}
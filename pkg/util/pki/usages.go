@@ -0,0 +1,158 @@
+/*
+Copyright 2019 The Jetstack cert-manager contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pki
+
+import (
+	"crypto/x509"
+	"fmt"
+
+	"github.com/jetstack/cert-manager/pkg/apis/certmanager/v1alpha1"
+)
+
+// keyUsageValues maps each key usage of a Certificate resource to its
+// x509.KeyUsage.
+var keyUsageValues = map[v1alpha1.KeyUsage]x509.KeyUsage{
+	v1alpha1.UsageDigitalSignature:  x509.KeyUsageDigitalSignature,
+	v1alpha1.UsageContentCommitment: x509.KeyUsageContentCommitment,
+	v1alpha1.UsageKeyEncipherment:   x509.KeyUsageKeyEncipherment,
+	v1alpha1.UsageDataEncipherment:  x509.KeyUsageDataEncipherment,
+	v1alpha1.UsageKeyAgreement:      x509.KeyUsageKeyAgreement,
+	v1alpha1.UsageCertSign:          x509.KeyUsageCertSign,
+	v1alpha1.UsageCRLSign:           x509.KeyUsageCRLSign,
+	v1alpha1.UsageEncipherOnly:      x509.KeyUsageEncipherOnly,
+	v1alpha1.UsageDecipherOnly:      x509.KeyUsageDecipherOnly,
+}
+
+// extKeyUsageValues maps each extended key usage of a Certificate resource to
+// its x509.ExtKeyUsage.
+var extKeyUsageValues = map[v1alpha1.KeyUsage]x509.ExtKeyUsage{
+	v1alpha1.UsageServerAuth:      x509.ExtKeyUsageServerAuth,
+	v1alpha1.UsageClientAuth:      x509.ExtKeyUsageClientAuth,
+	v1alpha1.UsageCodeSigning:     x509.ExtKeyUsageCodeSigning,
+	v1alpha1.UsageEmailProtection: x509.ExtKeyUsageEmailProtection,
+	v1alpha1.UsageTimeStamping:    x509.ExtKeyUsageTimeStamping,
+	v1alpha1.UsageOCSPSigning:     x509.ExtKeyUsageOCSPSigning,
+}
+
+const defaultKeyUsages = x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment
+
+var defaultExtKeyUsages = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+
+// caKeyUsages are the key usages that allow a certificate to sign other
+// certificates or CRLs, and so must only be set on a CA.
+const caKeyUsages = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+
+// LeafCAKeyUsagePolicy determines how GenerateTemplate and GenerateCSR handle
+// a Certificate that is not a CA but whose Usages include certSign or
+// cRLSign.
+type LeafCAKeyUsagePolicy int
+
+const (
+	// LeafCAKeyUsageReject returns an error, so that a leaf certificate that
+	// can sign other certificates is never issued. This is the default.
+	LeafCAKeyUsageReject LeafCAKeyUsagePolicy = iota
+
+	// LeafCAKeyUsageStrip removes the certSign and cRLSign key usages. If no
+	// other key usages remain, the default key usages are used.
+	LeafCAKeyUsageStrip
+)
+
+// KeyUsagesForCertificate returns the key usages and extended key usages
+// that should be set on certificates issued for the given Certificate
+// resource, translated from its Usages.
+// If no key usages are listed, digitalSignature and keyEncipherment are used.
+// If Usages is not set, the serverAuth and clientAuth extended key usages are
+// used, unless the Certificate is a CA. The certSign usage of a CA is always
+// included.
+// An error is returned if any of the usages is not known.
+func KeyUsagesForCertificate(crt *v1alpha1.Certificate) (x509.KeyUsage, []x509.ExtKeyUsage, error) {
+	var keyUsages x509.KeyUsage
+	var extKeyUsages []x509.ExtKeyUsage
+	for _, u := range crt.Spec.Usages {
+		if ku, ok := keyUsageValues[u]; ok {
+			keyUsages |= ku
+			continue
+		}
+		eku, ok := extKeyUsageValues[u]
+		if !ok {
+			return 0, nil, fmt.Errorf("unknown key usage: %q", u)
+		}
+		if !containsExtKeyUsage(extKeyUsages, eku) {
+			extKeyUsages = append(extKeyUsages, eku)
+		}
+	}
+
+	if keyUsages == 0 {
+		keyUsages = defaultKeyUsages
+	}
+	if crt.Spec.IsCA {
+		keyUsages |= x509.KeyUsageCertSign
+	}
+	if len(crt.Spec.Usages) == 0 && !crt.Spec.IsCA {
+		extKeyUsages = defaultExtKeyUsages
+	}
+	return keyUsages, extKeyUsages, nil
+}
+
+// keyUsagesForOptions returns the key usages and extended key usages that
+// should be set on certificates issued for the given Certificate resource,
+// taking into account any usages set by an IssuanceProfile.
+// The Usages of the Certificate take precedence over those of the profile.
+// The certSign usage of a CA is always included. If the Certificate is not a
+// CA, certSign and cRLSign are handled according to the LeafCAKeyUsagePolicy.
+func keyUsagesForOptions(crt *v1alpha1.Certificate, o *templateOptions) (x509.KeyUsage, []x509.ExtKeyUsage, error) {
+	keyUsages, extKeyUsages, err := KeyUsagesForCertificate(crt)
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(crt.Spec.Usages) == 0 {
+		if o.keyUsage != 0 {
+			keyUsages = o.keyUsage
+			if crt.Spec.IsCA {
+				keyUsages |= x509.KeyUsageCertSign
+			}
+		}
+		if len(o.extKeyUsages) > 0 {
+			extKeyUsages = o.extKeyUsages
+		}
+	}
+	return leafKeyUsagesForPolicy(keyUsages, crt.Spec.IsCA, o.leafCAKeyUsagePolicy), extKeyUsages, nil
+}
+
+// leafKeyUsagesForPolicy returns the given key usages with certSign and
+// cRLSign removed if the certificate is not a CA and policy is
+// LeafCAKeyUsageStrip. Otherwise the key usages are returned unchanged, to be
+// rejected by ValidateKeyUsageConsistency.
+func leafKeyUsagesForPolicy(keyUsages x509.KeyUsage, isCA bool, policy LeafCAKeyUsagePolicy) x509.KeyUsage {
+	if isCA || policy != LeafCAKeyUsageStrip {
+		return keyUsages
+	}
+	keyUsages &^= caKeyUsages
+	if keyUsages == 0 {
+		keyUsages = defaultKeyUsages
+	}
+	return keyUsages
+}
+
+func containsExtKeyUsage(usages []x509.ExtKeyUsage, u x509.ExtKeyUsage) bool {
+	for _, usage := range usages {
+		if usage == u {
+			return true
+		}
+	}
+	return false
+}
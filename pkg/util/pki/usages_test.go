@@ -0,0 +1,164 @@
+/*
+Copyright 2019 The Jetstack cert-manager contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pki
+
+import (
+	"crypto/x509"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jetstack/cert-manager/pkg/apis/certmanager/v1alpha1"
+)
+
+func TestKeyUsagesForCertificate(t *testing.T) {
+	type testT struct {
+		name                string
+		usages              []v1alpha1.KeyUsage
+		isCA                bool
+		expectedKeyUsage    x509.KeyUsage
+		expectedExtKeyUsage []x509.ExtKeyUsage
+		expectErr           bool
+	}
+	tests := []testT{
+		{
+			name:                "defaults",
+			expectedKeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+			expectedExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		},
+		{
+			name:             "ca defaults",
+			isCA:             true,
+			expectedKeyUsage: x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment | x509.KeyUsageCertSign,
+		},
+		{
+			name:                "extended key usages only",
+			usages:              []v1alpha1.KeyUsage{v1alpha1.UsageCodeSigning, v1alpha1.UsageEmailProtection, v1alpha1.UsageOCSPSigning, v1alpha1.UsageCodeSigning},
+			expectedKeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+			expectedExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning, x509.ExtKeyUsageEmailProtection, x509.ExtKeyUsageOCSPSigning},
+		},
+		{
+			name:             "key usages only",
+			usages:           []v1alpha1.KeyUsage{v1alpha1.UsageDigitalSignature},
+			expectedKeyUsage: x509.KeyUsageDigitalSignature,
+		},
+		{
+			name:                "ca with requested usages",
+			usages:              []v1alpha1.KeyUsage{v1alpha1.UsageCRLSign, v1alpha1.UsageServerAuth},
+			isCA:                true,
+			expectedKeyUsage:    x509.KeyUsageCRLSign | x509.KeyUsageCertSign,
+			expectedExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		},
+		{
+			name:      "unknown usage",
+			usages:    []v1alpha1.KeyUsage{"teleportation"},
+			expectErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			crt := buildCertificate("test")
+			crt.Spec.Usages = test.usages
+			crt.Spec.IsCA = test.isCA
+			keyUsage, extKeyUsage, err := KeyUsagesForCertificate(crt)
+			if err != nil {
+				if !test.expectErr {
+					t.Errorf("expected no error but got: %v", err)
+				}
+				return
+			}
+			if test.expectErr {
+				t.Fatalf("expected an error but got none")
+			}
+			if keyUsage != test.expectedKeyUsage {
+				t.Errorf("expected key usage %d but got %d", test.expectedKeyUsage, keyUsage)
+			}
+			if !reflect.DeepEqual(extKeyUsage, test.expectedExtKeyUsage) {
+				t.Errorf("expected extended key usages %v but got %v", test.expectedExtKeyUsage, extKeyUsage)
+			}
+		})
+	}
+}
+
+func TestGenerateTemplateUsages(t *testing.T) {
+	crt := buildCertificate("test")
+	crt.Spec.Usages = []v1alpha1.KeyUsage{v1alpha1.UsageDigitalSignature, v1alpha1.UsageClientAuth}
+	template, err := GenerateTemplate(nil, crt)
+	if err != nil {
+		t.Fatalf("error generating template: %v", err)
+	}
+	if template.KeyUsage != x509.KeyUsageDigitalSignature {
+		t.Errorf("expected key usage %d but got %d", x509.KeyUsageDigitalSignature, template.KeyUsage)
+	}
+	expected := []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	if !reflect.DeepEqual(template.ExtKeyUsage, expected) {
+		t.Errorf("expected extended key usages %v but got %v", expected, template.ExtKeyUsage)
+	}
+
+	csr, err := GenerateCSR(nil, crt)
+	if err != nil {
+		t.Fatalf("error generating csr: %v", err)
+	}
+	found := false
+	for _, ext := range csr.ExtraExtensions {
+		if ext.Id.Equal(OIDExtensionExtendedKeyUsage) {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected the csr to request the extended key usages")
+	}
+}
+
+func TestGenerateTemplateLeafCAKeyUsagePolicy(t *testing.T) {
+	crt := buildCertificate("test")
+	crt.Spec.Usages = []v1alpha1.KeyUsage{v1alpha1.UsageDigitalSignature, v1alpha1.UsageCertSign}
+
+	if _, err := GenerateTemplate(nil, crt); err == nil || !strings.Contains(err.Error(), "certSign") {
+		t.Errorf("expected error rejecting certSign on a leaf certificate, but got: %v", err)
+	}
+	if _, err := GenerateCSR(nil, crt); err == nil || !strings.Contains(err.Error(), "certSign") {
+		t.Errorf("expected error rejecting certSign on a leaf csr, but got: %v", err)
+	}
+
+	template, err := GenerateTemplate(nil, crt, WithLeafCAKeyUsagePolicy(LeafCAKeyUsageStrip))
+	if err != nil {
+		t.Fatalf("error generating template: %v", err)
+	}
+	if template.KeyUsage != x509.KeyUsageDigitalSignature {
+		t.Errorf("expected key usage %d but got %d", x509.KeyUsageDigitalSignature, template.KeyUsage)
+	}
+
+	crt.Spec.Usages = []v1alpha1.KeyUsage{v1alpha1.UsageCertSign, v1alpha1.UsageCRLSign}
+	template, err = GenerateTemplate(nil, crt, WithLeafCAKeyUsagePolicy(LeafCAKeyUsageStrip))
+	if err != nil {
+		t.Fatalf("error generating template: %v", err)
+	}
+	if template.KeyUsage != defaultKeyUsages {
+		t.Errorf("expected default key usage %d once CA usages are stripped but got %d", defaultKeyUsages, template.KeyUsage)
+	}
+
+	ca := buildCACertificate("ca")
+	ca.Spec.Usages = []v1alpha1.KeyUsage{v1alpha1.UsageCertSign, v1alpha1.UsageCRLSign}
+	template, err = GenerateTemplate(nil, ca, WithLeafCAKeyUsagePolicy(LeafCAKeyUsageStrip))
+	if err != nil {
+		t.Fatalf("error generating CA template: %v", err)
+	}
+	if template.KeyUsage != x509.KeyUsageCertSign|x509.KeyUsageCRLSign {
+		t.Errorf("expected CA usages to be kept but got %d", template.KeyUsage)
+	}
+}
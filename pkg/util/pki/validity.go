@@ -0,0 +1,174 @@
+/*
+Copyright 2019 The Jetstack cert-manager contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pki
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"fmt"
+	"time"
+)
+
+// NotBeforePolicy determines how a certificate that would be valid before its
+// issuer is handled when signing. Some validators reject chains where a
+// certificate's validity period starts before its issuer's.
+type NotBeforePolicy int
+
+const (
+	// NotBeforePolicyClamp moves the NotBefore of the certificate forward to
+	// the NotBefore of its issuer.
+	NotBeforePolicyClamp NotBeforePolicy = iota
+
+	// NotBeforePolicyError returns an error from SignCertificate.
+	NotBeforePolicyError
+)
+
+// DefaultPublicTrustMaxValidity is the maximum validity period of a publicly
+// trusted TLS certificate, as set by the CA/Browser Forum Baseline
+// Requirements.
+const DefaultPublicTrustMaxValidity = 398 * 24 * time.Hour
+
+// WouldExceedPublicTrustLimit returns an error if a certificate issued now
+// with the given duration would have a validity period longer than limit. A
+// limit of zero means DefaultPublicTrustMaxValidity.
+// This is advisory for internal issuers, but certificates that exceed the
+// limit will be rejected by browsers if issued by a publicly trusted CA.
+func WouldExceedPublicTrustLimit(duration, limit time.Duration, now time.Time) error {
+	if limit == 0 {
+		limit = DefaultPublicTrustMaxValidity
+	}
+	if duration > limit {
+		return fmt.Errorf("requested duration %s would expire at %s, exceeding the maximum validity of %s for publicly trusted certificates",
+			duration, now.Add(duration).UTC().Format(time.RFC3339), limit)
+	}
+	return nil
+}
+
+// ValidateDurationAgainstIssuer returns an error if a certificate issued now
+// with the given duration would outlive the issuer certificate.
+func ValidateDurationAgainstIssuer(duration time.Duration, issuerCert *x509.Certificate, now time.Time) error {
+	notAfter := now.Add(duration)
+	if notAfter.After(issuerCert.NotAfter) {
+		return fmt.Errorf("requested duration %s would expire at %s, after the issuer expires at %s",
+			duration, notAfter.UTC().Format(time.RFC3339), issuerCert.NotAfter.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// EffectiveValidityWindow returns the validity period of the given
+// certificate as seen by a relying party whose clock may be skewed by up to
+// skew in either direction.
+func EffectiveValidityWindow(cert *x509.Certificate, skew time.Duration) (notBefore, notAfter time.Time) {
+	return cert.NotBefore.Add(skew), cert.NotAfter.Add(-skew)
+}
+
+// ValidityOverlap returns the period during which both of the given
+// certificates are valid. ok is false if their validity periods do not
+// overlap.
+func ValidityOverlap(oldCert, newCert *x509.Certificate) (start, end time.Time, ok bool) {
+	start = oldCert.NotBefore
+	if newCert.NotBefore.After(start) {
+		start = newCert.NotBefore
+	}
+	end = oldCert.NotAfter
+	if newCert.NotAfter.Before(end) {
+		end = newCert.NotAfter
+	}
+	if end.Before(start) {
+		return time.Time{}, time.Time{}, false
+	}
+	return start, end, true
+}
+
+// CertificateAge returns how long the given certificate has been valid for at
+// now. It is negative if the certificate is not yet valid.
+// now is passed in so that related metrics can be computed from a single
+// sample of the clock.
+func CertificateAge(cert *x509.Certificate, now time.Time) time.Duration {
+	return now.Sub(cert.NotBefore)
+}
+
+// TimeToExpiry returns how long the given certificate remains valid for at
+// now. It is negative if the certificate has expired.
+func TimeToExpiry(cert *x509.Certificate, now time.Time) time.Duration {
+	return cert.NotAfter.Sub(now)
+}
+
+// RenewalTime returns the time at which the given certificate should be
+// renewed, which is renewBefore before it expires. If renewBefore is longer
+// than the lifetime of the certificate, the renewal time is clamped to when
+// the certificate becomes valid, rather than a time before it was issued.
+func RenewalTime(cert *x509.Certificate, renewBefore time.Duration) time.Time {
+	renewalTime := cert.NotAfter.Add(-renewBefore)
+	if renewalTime.Before(cert.NotBefore) {
+		return cert.NotBefore
+	}
+	return renewalTime
+}
+
+// NeedsRenewal returns true if the given certificate is due for renewal at
+// now, i.e. if now is at or after its RenewalTime.
+func NeedsRenewal(cert *x509.Certificate, renewBefore time.Duration, now time.Time) bool {
+	return !now.Before(RenewalTime(cert, renewBefore))
+}
+
+// ExtendValidity re-signs the given certificate with a later NotAfter of
+// newNotAfter. Everything else, including the subject, subject alternative
+// names, public key, serial number and extensions, is reproduced exactly.
+// The certificate must have been issued by issuerCert, and publicKey must be
+// its public key. newNotAfter must be after the current NotAfter of the
+// certificate, and must not be after the NotAfter of issuerCert unless the
+// certificate is self signed.
+//
+// This is intended only for the narrow case where a certificate's validity
+// must be extended without any other change. As the serial number is reused,
+// the original and extended certificates are indistinguishable to CRLs and
+// OCSP: revoking either revokes both, and RFC 5280 requires serial numbers to
+// be unique for each issuer. The original certificate also remains valid
+// until it expires. Issue a new certificate instead wherever possible.
+func ExtendValidity(cert *x509.Certificate, publicKey crypto.PublicKey, issuerCert *x509.Certificate, issuerKey interface{}, newNotAfter time.Time) ([]byte, *x509.Certificate, error) {
+	matches, err := PublicKeyMatchesCertificate(publicKey, cert)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !matches {
+		return nil, nil, fmt.Errorf("public key does not match certificate %q", cert.Subject.String())
+	}
+	if err := issuerCert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature); err != nil {
+		return nil, nil, fmt.Errorf("certificate %q was not issued by %q: %s", cert.Subject.String(), issuerCert.Subject.String(), err.Error())
+	}
+	if !newNotAfter.After(cert.NotAfter) {
+		return nil, nil, fmt.Errorf("new expiry %s is not after the current expiry %s",
+			newNotAfter.UTC().Format(time.RFC3339), cert.NotAfter.UTC().Format(time.RFC3339))
+	}
+	selfSigned := bytes.Equal(cert.Raw, issuerCert.Raw)
+	if !selfSigned && newNotAfter.After(issuerCert.NotAfter) {
+		return nil, nil, fmt.Errorf("new expiry %s is after the issuer expires at %s",
+			newNotAfter.UTC().Format(time.RFC3339), issuerCert.NotAfter.UTC().Format(time.RFC3339))
+	}
+
+	template := *cert
+	template.NotAfter = newNotAfter
+	// crypto/x509 will not generate any extension present in
+	// ExtraExtensions, so this reproduces the extensions verbatim
+	template.ExtraExtensions = cert.Extensions
+	if selfSigned {
+		return SignCertificate(&template, &template, publicKey, issuerKey)
+	}
+	return SignCertificate(&template, issuerCert, publicKey, issuerKey)
+}
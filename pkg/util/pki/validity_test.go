@@ -0,0 +1,401 @@
+/*
+Copyright 2019 The Jetstack cert-manager contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pki
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"reflect"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestValidateDurationAgainstIssuer(t *testing.T) {
+	now := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+	issuer := &x509.Certificate{
+		NotBefore: now.Add(-time.Hour),
+		NotAfter:  now.Add(30 * 24 * time.Hour),
+	}
+	type testT struct {
+		name        string
+		duration    time.Duration
+		expectedErr bool
+	}
+	tests := []testT{
+		{
+			name:     "duration within the issuer's remaining validity",
+			duration: 7 * 24 * time.Hour,
+		},
+		{
+			name:     "duration exactly matching the issuer's remaining validity",
+			duration: 30 * 24 * time.Hour,
+		},
+		{
+			name:        "duration exceeding the issuer's remaining validity",
+			duration:    90 * 24 * time.Hour,
+			expectedErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := ValidateDurationAgainstIssuer(test.duration, issuer, now)
+			if err != nil && !test.expectedErr {
+				t.Errorf("expected no error but got: %v", err)
+			}
+			if err == nil && test.expectedErr {
+				t.Errorf("expected an error but got none")
+			}
+		})
+	}
+}
+
+func TestEffectiveValidityWindow(t *testing.T) {
+	start := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+	cert := &x509.Certificate{
+		NotBefore: start,
+		NotAfter:  start.Add(24 * time.Hour),
+	}
+	notBefore, notAfter := EffectiveValidityWindow(cert, 5*time.Minute)
+	if expected := start.Add(5 * time.Minute); !notBefore.Equal(expected) {
+		t.Errorf("expected notBefore %s but got %s", expected, notBefore)
+	}
+	if expected := start.Add(24*time.Hour - 5*time.Minute); !notAfter.Equal(expected) {
+		t.Errorf("expected notAfter %s but got %s", expected, notAfter)
+	}
+}
+
+func TestWouldExceedPublicTrustLimit(t *testing.T) {
+	now := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	type testT struct {
+		name        string
+		duration    time.Duration
+		limit       time.Duration
+		expectedErr bool
+	}
+	tests := []testT{
+		{
+			name:     "one year",
+			duration: 365 * day,
+		},
+		{
+			name:     "exactly 398 days",
+			duration: 398 * day,
+		},
+		{
+			name:        "just over 398 days",
+			duration:    398*day + time.Second,
+			expectedErr: true,
+		},
+		{
+			name:        "two years",
+			duration:    2 * 365 * day,
+			expectedErr: true,
+		},
+		{
+			name:     "two years with a longer limit",
+			duration: 2 * 365 * day,
+			limit:    3 * 365 * day,
+		},
+		{
+			name:        "one year with a shorter limit",
+			duration:    365 * day,
+			limit:       90 * day,
+			expectedErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := WouldExceedPublicTrustLimit(test.duration, test.limit, now)
+			if err != nil && !test.expectedErr {
+				t.Errorf("expected no error but got: %v", err)
+			}
+			if err == nil && test.expectedErr {
+				t.Errorf("expected an error but got none")
+			}
+		})
+	}
+}
+
+func TestValidityOverlap(t *testing.T) {
+	base := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	certFor := func(from, to time.Duration) *x509.Certificate {
+		return &x509.Certificate{NotBefore: base.Add(from), NotAfter: base.Add(to)}
+	}
+	type testT struct {
+		name          string
+		oldCert       *x509.Certificate
+		newCert       *x509.Certificate
+		expectedStart time.Time
+		expectedEnd   time.Time
+		expectedOK    bool
+	}
+	tests := []testT{
+		{
+			name:          "new certificate issued before the old expires",
+			oldCert:       certFor(0, 90*day),
+			newCert:       certFor(60*day, 150*day),
+			expectedStart: base.Add(60 * day),
+			expectedEnd:   base.Add(90 * day),
+			expectedOK:    true,
+		},
+		{
+			name:          "new certificate within the old",
+			oldCert:       certFor(0, 90*day),
+			newCert:       certFor(10*day, 20*day),
+			expectedStart: base.Add(10 * day),
+			expectedEnd:   base.Add(20 * day),
+			expectedOK:    true,
+		},
+		{
+			name:       "new certificate issued after the old expires",
+			oldCert:    certFor(0, 90*day),
+			newCert:    certFor(91*day, 180*day),
+			expectedOK: false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			start, end, ok := ValidityOverlap(test.oldCert, test.newCert)
+			if ok != test.expectedOK {
+				t.Fatalf("expected ok to be %t but got %t", test.expectedOK, ok)
+			}
+			if !start.Equal(test.expectedStart) || !end.Equal(test.expectedEnd) {
+				t.Errorf("expected overlap %s to %s but got %s to %s", test.expectedStart, test.expectedEnd, start, end)
+			}
+		})
+	}
+}
+
+func TestSignCertificateNotBeforePolicy(t *testing.T) {
+	caKey, err := GenerateECPrivateKey(ECCurve256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate, err := GenerateTemplate(nil, buildCACertificate("ca"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a freshly created CA, whose validity starts slightly in the future
+	caTemplate.NotBefore = time.Now().Add(time.Minute).Truncate(time.Second)
+	_, caCert, err := SignCertificate(caTemplate, caTemplate, caKey.Public(), caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newLeafTemplate := func() *x509.Certificate {
+		template, err := GenerateTemplate(nil, buildCertificate("leaf", "leaf.example.com"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// backdate the leaf to allow for clock skew
+		template.NotBefore = time.Now().Add(-5 * time.Minute)
+		return template
+	}
+	leafKey, err := GenerateECPrivateKey(ECCurve256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := newLeafTemplate()
+	notBefore := template.NotBefore
+	_, cert, err := SignCertificate(template, caCert, leafKey.Public(), caKey)
+	if err != nil {
+		t.Fatalf("expected leaf to be signed but got: %v", err)
+	}
+	if !cert.NotBefore.Equal(caCert.NotBefore) {
+		t.Errorf("expected leaf NotBefore to be clamped to %s but got %s", caCert.NotBefore, cert.NotBefore)
+	}
+	if !template.NotBefore.Equal(notBefore) {
+		t.Errorf("expected template to not be modified")
+	}
+
+	if _, _, err := SignCertificate(newLeafTemplate(), caCert, leafKey.Public(), caKey, WithNotBeforePolicy(NotBeforePolicyError)); err == nil {
+		t.Errorf("expected an error signing a leaf valid before its issuer")
+	}
+}
+
+func TestCertificateAgeAndTimeToExpiry(t *testing.T) {
+	now := time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC)
+	type testT struct {
+		name           string
+		notBefore      time.Time
+		notAfter       time.Time
+		expectedAge    time.Duration
+		expectedExpiry time.Duration
+	}
+	tests := []testT{
+		{
+			name:           "valid certificate",
+			notBefore:      now.Add(-24 * time.Hour),
+			notAfter:       now.Add(48 * time.Hour),
+			expectedAge:    24 * time.Hour,
+			expectedExpiry: 48 * time.Hour,
+		},
+		{
+			name:           "expired certificate",
+			notBefore:      now.Add(-72 * time.Hour),
+			notAfter:       now.Add(-time.Hour),
+			expectedAge:    72 * time.Hour,
+			expectedExpiry: -time.Hour,
+		},
+		{
+			name:           "not yet valid certificate",
+			notBefore:      now.Add(time.Hour),
+			notAfter:       now.Add(2 * time.Hour),
+			expectedAge:    -time.Hour,
+			expectedExpiry: 2 * time.Hour,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cert := &x509.Certificate{NotBefore: test.notBefore, NotAfter: test.notAfter}
+			if age := CertificateAge(cert, now); age != test.expectedAge {
+				t.Errorf("expected age %s but got %s", test.expectedAge, age)
+			}
+			if remaining := TimeToExpiry(cert, now); remaining != test.expectedExpiry {
+				t.Errorf("expected time to expiry %s but got %s", test.expectedExpiry, remaining)
+			}
+		})
+	}
+}
+
+func TestRenewalTimeAndNeedsRenewal(t *testing.T) {
+	notBefore := time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC)
+	cert := &x509.Certificate{NotBefore: notBefore, NotAfter: notBefore.Add(90 * 24 * time.Hour)}
+
+	type testT struct {
+		name                string
+		renewBefore         time.Duration
+		now                 time.Time
+		expectedRenewalTime time.Time
+		expectedRenewal     bool
+	}
+	tests := []testT{
+		{
+			name:                "before the renewal time",
+			renewBefore:         30 * 24 * time.Hour,
+			now:                 notBefore.Add(59 * 24 * time.Hour),
+			expectedRenewalTime: notBefore.Add(60 * 24 * time.Hour),
+			expectedRenewal:     false,
+		},
+		{
+			name:                "at the renewal time",
+			renewBefore:         30 * 24 * time.Hour,
+			now:                 notBefore.Add(60 * 24 * time.Hour),
+			expectedRenewalTime: notBefore.Add(60 * 24 * time.Hour),
+			expectedRenewal:     true,
+		},
+		{
+			name:                "expired",
+			renewBefore:         30 * 24 * time.Hour,
+			now:                 notBefore.Add(91 * 24 * time.Hour),
+			expectedRenewalTime: notBefore.Add(60 * 24 * time.Hour),
+			expectedRenewal:     true,
+		},
+		{
+			name:                "renewBefore longer than the lifetime",
+			renewBefore:         365 * 24 * time.Hour,
+			now:                 notBefore.Add(time.Hour),
+			expectedRenewalTime: notBefore,
+			expectedRenewal:     true,
+		},
+		{
+			name:                "renewBefore longer than the lifetime, before the certificate is valid",
+			renewBefore:         365 * 24 * time.Hour,
+			now:                 notBefore.Add(-time.Hour),
+			expectedRenewalTime: notBefore,
+			expectedRenewal:     false,
+		},
+		{
+			name:                "no renewBefore",
+			now:                 notBefore.Add(89 * 24 * time.Hour),
+			expectedRenewalTime: cert.NotAfter,
+			expectedRenewal:     false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if renewalTime := RenewalTime(cert, test.renewBefore); !renewalTime.Equal(test.expectedRenewalTime) {
+				t.Errorf("expected renewal time %s but got %s", test.expectedRenewalTime, renewalTime)
+			}
+			if renewal := NeedsRenewal(cert, test.renewBefore, test.now); renewal != test.expectedRenewal {
+				t.Errorf("expected needs renewal to be %t but got %t", test.expectedRenewal, renewal)
+			}
+		})
+	}
+}
+
+func TestExtendValidity(t *testing.T) {
+	caCrt := buildCACertificate("ca")
+	caCrt.Spec.Duration = &metav1.Duration{Duration: 365 * 24 * time.Hour}
+	ca, caKey := signTestCertificate(t, caCrt, nil, nil)
+	leaf, leafKey := signTestCertificate(t, buildCertificate("leaf", "leaf.example.com"), ca, caKey)
+
+	newNotAfter := leaf.NotAfter.Add(30 * 24 * time.Hour).Truncate(time.Second)
+	_, extended, err := ExtendValidity(leaf, leafKey.Public(), ca, caKey, newNotAfter)
+	if err != nil {
+		t.Fatalf("expected no error but got: %v", err)
+	}
+	if !extended.NotAfter.Equal(newNotAfter) {
+		t.Errorf("expected NotAfter %s but got %s", newNotAfter, extended.NotAfter)
+	}
+	if err := extended.CheckSignatureFrom(ca); err != nil {
+		t.Errorf("expected the extended certificate to be signed by the issuer: %v", err)
+	}
+	if !extended.NotBefore.Equal(leaf.NotBefore) {
+		t.Errorf("expected NotBefore %s to be unchanged but got %s", leaf.NotBefore, extended.NotBefore)
+	}
+	// other than the validity period, the TBSCertificates must be identical
+	var original, updated certificateAlgorithms
+	if _, err := asn1.Unmarshal(leaf.Raw, &original); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := asn1.Unmarshal(extended.Raw, &updated); err != nil {
+		t.Fatal(err)
+	}
+	original.TBSCertificate.Validity = asn1.RawValue{}
+	updated.TBSCertificate.Validity = asn1.RawValue{}
+	if !reflect.DeepEqual(original.TBSCertificate, updated.TBSCertificate) {
+		t.Errorf("expected only NotAfter to change, but got %+v and %+v", original.TBSCertificate, updated.TBSCertificate)
+	}
+
+	if _, _, err := ExtendValidity(leaf, leafKey.Public(), ca, caKey, leaf.NotAfter); err == nil {
+		t.Errorf("expected an error for a NotAfter that is not later than the current one")
+	}
+	if _, _, err := ExtendValidity(leaf, leafKey.Public(), ca, caKey, ca.NotAfter.Add(time.Hour)); err == nil {
+		t.Errorf("expected an error for a NotAfter after the issuer expires")
+	}
+	if _, _, err := ExtendValidity(leaf, caKey.Public(), ca, caKey, newNotAfter); err == nil {
+		t.Errorf("expected an error for a public key that does not match the certificate")
+	}
+	if _, _, err := ExtendValidity(leaf, leafKey.Public(), leaf, leafKey, newNotAfter); err == nil {
+		t.Errorf("expected an error for an issuer that did not issue the certificate")
+	}
+
+	// a self signed certificate is not limited by the lifetime of its issuer
+	_, extendedCA, err := ExtendValidity(ca, caKey.Public(), ca, caKey, ca.NotAfter.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("expected no error extending a self signed certificate but got: %v", err)
+	}
+	if err := extendedCA.CheckSignatureFrom(extendedCA); err != nil {
+		t.Errorf("expected the extended certificate to be self signed: %v", err)
+	}
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2019 The Jetstack cert-manager contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package x509util parses the values of X.509 fields as they are written on
+// Certificate resources. It has no dependencies outside the standard library,
+// so that it can be used by API validation as well as by pkg/util/pki.
+package x509util
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MaxSerialNumberBits is the maximum length of a serial number. RFC 5280
+// limits serial numbers to 20 octets, and they must be positive.
+const MaxSerialNumberBits = 159
+
+// ParseSerialNumber parses a certificate serial number, such as one assigned
+// by an external allocator. Serial numbers prefixed with "0x", or written as
+// colon separated hex octets as printed by openssl, are parsed as hex, and
+// all others as decimal. An error is returned if the serial number is
+// malformed, is not positive, or is longer than the 20 octets allowed by RFC
+// 5280.
+func ParseSerialNumber(s string) (*big.Int, error) {
+	s = strings.TrimSpace(s)
+	digits, base := s, 10
+	switch {
+	case strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X"):
+		digits, base = s[2:], 16
+	case strings.Contains(s, ":"):
+		digits, base = strings.Replace(s, ":", "", -1), 16
+	}
+	serialNumber, ok := new(big.Int).SetString(digits, base)
+	if !ok {
+		return nil, fmt.Errorf("invalid serial number %q: must be a decimal or hex number", s)
+	}
+	if serialNumber.Sign() <= 0 {
+		return nil, fmt.Errorf("invalid serial number %q: must be positive", s)
+	}
+	if serialNumber.BitLen() > MaxSerialNumberBits {
+		return nil, fmt.Errorf("invalid serial number %q: must be no longer than 20 octets", s)
+	}
+	return serialNumber, nil
+}
+
+// signatureAlgorithmNames are the names by which signature algorithms may be
+// given on a Certificate, which are those of the crypto/x509 constants.
+var signatureAlgorithmNames = map[string]x509.SignatureAlgorithm{
+	"SHA256WithRSA":    x509.SHA256WithRSA,
+	"SHA384WithRSA":    x509.SHA384WithRSA,
+	"SHA512WithRSA":    x509.SHA512WithRSA,
+	"SHA256WithRSAPSS": x509.SHA256WithRSAPSS,
+	"SHA384WithRSAPSS": x509.SHA384WithRSAPSS,
+	"SHA512WithRSAPSS": x509.SHA512WithRSAPSS,
+	"ECDSAWithSHA256":  x509.ECDSAWithSHA256,
+	"ECDSAWithSHA384":  x509.ECDSAWithSHA384,
+	"ECDSAWithSHA512":  x509.ECDSAWithSHA512,
+	"PureEd25519":      x509.PureEd25519,
+}
+
+// ParseSignatureAlgorithm returns the signature algorithm with the given
+// name, such as "SHA384WithRSA". An error is returned if the name is not one
+// of the supported signature algorithms.
+func ParseSignatureAlgorithm(name string) (x509.SignatureAlgorithm, error) {
+	if alg, ok := signatureAlgorithmNames[name]; ok {
+		return alg, nil
+	}
+	var names []string
+	for n := range signatureAlgorithmNames {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return x509.UnknownSignatureAlgorithm, fmt.Errorf("unsupported signature algorithm %q: must be one of %s", name, strings.Join(names, ", "))
+}
+
+// ParseObjectIdentifier parses an OID in dotted decimal form, such as
+// "1.3.6.1.4.1.311.20.2.3".
+func ParseObjectIdentifier(s string) (asn1.ObjectIdentifier, error) {
+	parts := strings.Split(strings.TrimSpace(s), ".")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("must have at least two components")
+	}
+	oid := make(asn1.ObjectIdentifier, len(parts))
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("component %q is not a non-negative integer", part)
+		}
+		oid[i] = n
+	}
+	if oid[0] > 2 || (oid[0] < 2 && oid[1] > 39) {
+		return nil, fmt.Errorf("invalid leading components")
+	}
+	return oid, nil
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2019 The Jetstack cert-manager contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package x509util
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"math/big"
+	"testing"
+)
+
+func TestParseSerialNumber(t *testing.T) {
+	max := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), MaxSerialNumberBits), big.NewInt(1))
+
+	tests := map[string]struct {
+		serial      string
+		expected    *big.Int
+		expectedErr bool
+	}{
+		"decimal":                   {serial: "12345", expected: big.NewInt(12345)},
+		"decimal with leading zero": {serial: "010", expected: big.NewInt(10)},
+		"hex":                       {serial: "0x3039", expected: big.NewInt(12345)},
+		"upper case hex":            {serial: "0X3A", expected: big.NewInt(58)},
+		"colon separated hex":       {serial: "30:39", expected: big.NewInt(12345)},
+		"surrounding whitespace":    {serial: " 12345 ", expected: big.NewInt(12345)},
+		"20 octets":                 {serial: "0x" + max.Text(16), expected: max},
+		"too long":                  {serial: "0x" + new(big.Int).Add(max, big.NewInt(1)).Text(16), expectedErr: true},
+		"zero":                      {serial: "0", expectedErr: true},
+		"negative":                  {serial: "-1", expectedErr: true},
+		"hex without a prefix":      {serial: "3a", expectedErr: true},
+		"malformed colon separated": {serial: "30:zz", expectedErr: true},
+		"empty":                     {serial: "", expectedErr: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			serialNumber, err := ParseSerialNumber(test.serial)
+			if test.expectedErr {
+				if err == nil {
+					t.Errorf("expected an error but got serial number %s", serialNumber)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if serialNumber.Cmp(test.expected) != 0 {
+				t.Errorf("expected serial number %s but got %s", test.expected, serialNumber)
+			}
+		})
+	}
+}
+
+func TestParseSignatureAlgorithm(t *testing.T) {
+	if alg, err := ParseSignatureAlgorithm("SHA384WithRSA"); err != nil || alg != x509.SHA384WithRSA {
+		t.Errorf("expected %s but got %s, %v", x509.SHA384WithRSA, alg, err)
+	}
+	for _, invalid := range []string{"", "sha384withrsa", "MD5WithRSA"} {
+		if _, err := ParseSignatureAlgorithm(invalid); err == nil {
+			t.Errorf("expected an error parsing %q", invalid)
+		}
+	}
+}
+
+func TestParseObjectIdentifier(t *testing.T) {
+	upn := asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 20, 2, 3}
+	if oid, err := ParseObjectIdentifier("1.3.6.1.4.1.311.20.2.3"); err != nil || !oid.Equal(upn) {
+		t.Errorf("expected %s but got %s, %v", upn, oid, err)
+	}
+	for _, invalid := range []string{"", "1", "1..2", "1.-2", "3.1", "1.40", "a.b"} {
+		if _, err := ParseObjectIdentifier(invalid); err == nil {
+			t.Errorf("expected an error parsing %q", invalid)
+		}
+	}
+}
@@ -112,3 +112,9 @@ func SetCertificateNotAfter(p metav1.Time) CertificateModifier {
 		crt.Status.NotAfter = &p
 	}
 }
+
+func SetCertificateSerialNumber(serialNumber string) CertificateModifier {
+	return func(crt *v1alpha1.Certificate) {
+		crt.Status.SerialNumber = serialNumber
+	}
+}